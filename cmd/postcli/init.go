@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/oracle"
+)
+
+const edKeyFileName = "key.bin"
+
+// initResult is the result of the init command.
+type initResult struct {
+	Status           string
+	NumLabelsWritten uint64
+	Nonce            *uint64 `json:",omitempty"`
+	Providers        []oracle.DeviceHealth
+}
+
+func runInit(args []string) error {
+	flags := newSettingsFlags("init")
+	flags.initFlags()
+	printConfig := flags.Bool("printConfig", false, "print the config, the init options and the number of files to initialize, without initializing")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+	s := &flags.settings
+
+	if *printConfig {
+		result := struct {
+			Config   config.Config
+			InitOpts config.InitOpts
+			NumFiles int
+		}{s.Config, s.InitOpts, s.InitOpts.TotalFiles(s.Config.LabelsPerUnit)}
+		if *asJSON {
+			return printJSON(result)
+		}
+		spew.Dump(result.Config)
+		spew.Dump(result.InitOpts)
+		fmt.Println("number of files:", result.NumFiles)
+		return nil
+	}
+
+	welcome()
+	if s.NodeId == "" {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return fmt.Errorf("failed to generate identity: %w", err)
+		}
+		s.NodeId = hex.EncodeToString(pub)
+		log.Printf("cli: generated id %s\n", s.NodeId)
+		if err := saveKey(s.InitOpts.DataDir, priv); err != nil {
+			return err
+		}
+	}
+	nodeId, commitmentAtxId, err := s.identity()
+	if err != nil {
+		return err
+	}
+
+	zapLog, err := zap.NewProduction()
+	if err != nil {
+		return fmt.Errorf("failed to initialize zap logger: %w", err)
+	}
+
+	init, err := initialization.NewInitializer(
+		initialization.WithConfig(s.Config),
+		initialization.WithInitOpts(s.InitOpts),
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithLogger(zapLog),
+		initialization.WithProgressHandler(printProgress),
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if len(s.InitOpts.ProviderIDs) == 0 {
+		log.Println("cli: initializing with the fastest provider")
+	} else {
+		log.Println("cli: initializing with providers", s.InitOpts.ProviderIDs)
+	}
+	err = init.Initialize(ctx)
+	for _, d := range init.DeviceHealth() {
+		log.Printf("cli: provider %d: %d batches computed, %d failures, %d mismatches, blacklisted: %v\n",
+			d.ProviderID, d.Successes, d.Failures, d.Mismatches, d.Blacklisted)
+	}
+	var interrupted bool
+	switch {
+	case errors.Is(err, context.Canceled):
+		interrupted = true
+	case err != nil:
+		return err
+	default:
+		log.Println("cli: initialization completed")
+	}
+
+	if *asJSON {
+		if err := printJSON(initResult{
+			Status:           statusName(init.Status()),
+			NumLabelsWritten: init.NumLabelsWritten(),
+			Nonce:            init.Nonce(),
+			Providers:        init.DeviceHealth(),
+		}); err != nil {
+			return err
+		}
+	}
+	if interrupted {
+		return &exitError{code: exitInterrupted, msg: "initialization interrupted"}
+	}
+	return nil
+}
+
+func runReset(args []string) error {
+	flags := newSettingsFlags("reset")
+	flags.dataDirFlag()
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+
+	zapLog, err := zap.NewProduction()
+	if err != nil {
+		return fmt.Errorf("failed to initialize zap logger: %w", err)
+	}
+	init, _, err := initializerFromMetadata(&flags.settings, zapLog)
+	if err != nil {
+		return err
+	}
+	if err := init.Reset(); err != nil {
+		return err
+	}
+	log.Println("cli: reset completed")
+	return nil
+}
+
+func printProgress(e initialization.Event) {
+	switch e.Kind {
+	case initialization.EventFileCompleted:
+		p := e.Progress
+		log.Printf("cli: file %d completed, %d/%d labels written (%.2f%%), %.0f labels/s, eta %s\n",
+			e.FileIndex, p.NumLabelsWritten, p.TargetNumLabels,
+			float64(p.NumLabelsWritten)/float64(p.TargetNumLabels)*100,
+			p.LabelsPerSecond, p.ETA.Round(time.Second),
+		)
+	case initialization.EventNonceFound:
+		log.Printf("cli: found nonce %d on provider %d\n", e.Nonce, e.ProviderID)
+	case initialization.EventDeviceFailed:
+		log.Printf("cli: provider %d failed, its work is taken over by the remaining providers: %v\n", e.ProviderID, e.Err)
+	}
+}
+
+func saveKey(dataDir string, key ed25519.PrivateKey) error {
+	if err := os.MkdirAll(dataDir, 0o700); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("mkdir error: %w", err)
+	}
+
+	filename := filepath.Join(dataDir, edKeyFileName)
+	if err := os.WriteFile(filename, []byte(hex.EncodeToString(key)), 0o600); err != nil {
+		return fmt.Errorf("key write to disk error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/proving"
+	"github.com/spacemeshos/post/shared"
+	"github.com/spacemeshos/post/verifying"
+)
+
+// proofFile is the content of the file written by `postcli prove` and read by `postcli verify`. The proof and its
+// metadata are stored in their versioned encoding.
+type proofFile struct {
+	Proof    shared.VersionedProof
+	Metadata shared.VersionedProofMetadata
+	// VRFNonce is the nonce found during initialization, it is checked by `postcli verify` if set.
+	VRFNonce *uint64 `json:",omitempty"`
+}
+
+func writeProofFile(path string, f *proofFile) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func readProofFile(path string) (*proofFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &proofFile{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("invalid proof file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// runProve generates a proof for a challenge from an initialized datadir and writes it to a file.
+func runProve(args []string) error {
+	flags := newSettingsFlags("prove")
+	flags.dataDirFlag()
+	challengeHex := flags.String("challenge", "", "the challenge to prove, 32 bytes in hex (required)")
+	out := flags.String("out", "proof.json", "the file to write the proof to, - for stdout")
+	threads := flags.Uint("threads", 0, "the number of threads to generate the proof with, 0 for all cores")
+	nonces := flags.Uint("nonces", 16, "the number of nonces to try in parallel")
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+	cfg, opts := flags.settings.Config, flags.settings.InitOpts
+
+	if *challengeHex == "" {
+		return errors.New("-challenge flag is required")
+	}
+	challenge, err := hex.DecodeString(*challengeHex)
+	if err != nil {
+		return fmt.Errorf("invalid challenge: %w", err)
+	}
+	if len(challenge) != 32 {
+		return fmt.Errorf("invalid challenge length; expected: 32 bytes, given: %d", len(challenge))
+	}
+
+	// The identity and the layout of the data are taken from the metadata of the datadir.
+	m, err := initialization.LoadMetadata(opts.DataDir)
+	if err != nil {
+		return fmt.Errorf("failed to load metadata: %w", err)
+	}
+	cfg.LabelsPerUnit = m.LabelsPerUnit
+
+	zapLog, err := zap.NewProduction()
+	if err != nil {
+		return fmt.Errorf("failed to initialize zap logger: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	log.Printf("cli: generating proof for challenge %x\n", challenge)
+	proof, proofMetadata, err := proving.Generate(ctx, challenge, cfg, zapLog,
+		proving.WithDataSource(cfg, m.NodeId, m.CommitmentAtxId, opts.DataDir),
+		proving.WithThreads(*threads),
+		proving.WithNonces(*nonces),
+	)
+	if err != nil {
+		return fmt.Errorf("proof generation error: %w", err)
+	}
+
+	f := &proofFile{
+		Proof:    shared.VersionedProof(*proof),
+		Metadata: shared.VersionedProofMetadata(*proofMetadata),
+		VRFNonce: m.Nonce,
+	}
+	if err := writeProofFile(*out, f); err != nil {
+		return fmt.Errorf("failed to write proof: %w", err)
+	}
+	if *out != "-" {
+		log.Println("cli: proof written to", *out)
+	}
+	return nil
+}
+
+// verifyResult is the result of the verify command.
+type verifyResult struct {
+	Valid bool
+	// VRFNonceValid is nil if the proof file has no VRF nonce.
+	VRFNonceValid *bool  `json:",omitempty"`
+	Error         string `json:",omitempty"`
+}
+
+// runVerify checks a proof file written by prove, and the VRF nonce in it. It exits with exitFailed if either is
+// invalid.
+func runVerify(args []string) error {
+	flags := newSettingsFlags("verify")
+	path := flags.String("proof", "proof.json", "the proof file to verify")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+	cfg, opts := flags.settings.Config, flags.settings.InitOpts
+
+	f, err := readProofFile(*path)
+	if err != nil {
+		return fmt.Errorf("failed to read proof: %w", err)
+	}
+	cfg.LabelsPerUnit = f.Metadata.LabelsPerUnit
+
+	zapLog, err := zap.NewProduction()
+	if err != nil {
+		return fmt.Errorf("failed to initialize zap logger: %w", err)
+	}
+
+	result := verifyResult{}
+	if f.VRFNonce == nil {
+		log.Println("cli: the proof file has no VRF nonce, it is not checked")
+	} else {
+		err := verifying.VerifyVRFNonce(f.VRFNonce, &shared.VRFNonceMetadata{
+			NodeId:          f.Metadata.NodeId,
+			CommitmentAtxId: f.Metadata.CommitmentAtxId,
+			NumUnits:        f.Metadata.NumUnits,
+			LabelsPerUnit:   f.Metadata.LabelsPerUnit,
+		}, verifying.WithLabelScryptParams(opts.Scrypt))
+		valid := err == nil
+		result.VRFNonceValid = &valid
+		if err != nil {
+			result.Error = fmt.Sprintf("invalid VRF nonce: %v", err)
+		}
+	}
+
+	if result.Error == "" {
+		verifier, err := verifying.NewProofVerifier()
+		if err != nil {
+			return fmt.Errorf("failed to create verifier: %w", err)
+		}
+		defer verifier.Close()
+
+		proof, metadata := shared.Proof(f.Proof), shared.ProofMetadata(f.Metadata)
+		err = verifier.Verify(&proof, &metadata, cfg, zapLog, verifying.WithLabelScryptParams(opts.Scrypt))
+		switch {
+		case errors.Is(err, verifying.ErrInvalidProof):
+			result.Error = err.Error()
+		case err != nil:
+			return fmt.Errorf("failed to verify proof: %w", err)
+		default:
+			result.Valid = true
+		}
+	}
+
+	if *asJSON {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	} else if result.Valid {
+		log.Println("cli: proof is valid")
+	}
+	if !result.Valid {
+		return &exitError{code: exitFailed, msg: result.Error}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+)
+
+func runProviders(args []string) error {
+	flags := flag.NewFlagSet("providers", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	flags.Parse(args)
+
+	providers, err := initialization.OpenCLProviders()
+	if err != nil {
+		return fmt.Errorf("failed to get OpenCL providers: %w", err)
+	}
+	if *asJSON {
+		return printJSON(providers)
+	}
+	spew.Dump(providers)
+	return nil
+}
+
+func runBench(args []string) error {
+	flags := newSettingsFlags("bench")
+	flags.dataDirFlag()
+	flags.providersFlag()
+	cfg, opts := &flags.settings.Config, &flags.settings.InitOpts
+	flags.Var((*uint32Value)(&opts.NumUnits), "numUnits", "number of units the init time is projected for")
+	flags.Uint64Var(&cfg.LabelsPerUnit, "labelsPerUnit", cfg.LabelsPerUnit, "the number of labels per unit")
+	var batchSizes uintsValue
+	flags.Var(&batchSizes, "batchSizes", "comma separated numbers of labels per call every provider is measured with")
+	diskBytes := flags.Uint64("diskBytes", 256*config.MiB, "the number of bytes written to -datadir to measure the disk, 0 to skip")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+
+	providers, err := initialization.OpenCLProviders()
+	if err != nil {
+		return fmt.Errorf("failed to get OpenCL providers: %w", err)
+	}
+	// only the selected providers are measured, all of them if none is selected
+	if selected := opts.ProviderIDs; len(selected) > 0 {
+		filtered := providers[:0]
+		for _, p := range providers {
+			if containsID(selected, p.ID) {
+				filtered = append(filtered, p)
+			}
+		}
+		providers = filtered
+	}
+
+	benchOpts := initialization.DefaultBenchmarkOpts(*cfg, *opts)
+	benchOpts.DiskBytes = *diskBytes
+	if len(batchSizes) > 0 {
+		benchOpts.BatchSizes = benchOpts.BatchSizes[:0]
+		for _, size := range batchSizes {
+			benchOpts.BatchSizes = append(benchOpts.BatchSizes, uint64(size))
+		}
+	}
+
+	zapLog, err := zap.NewProduction()
+	if err != nil {
+		return fmt.Errorf("failed to initialize zap logger: %w", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := initialization.RunBenchmark(ctx, providers, benchOpts, zapLog)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(report)
+	}
+	return printBenchmark(report)
+}
+
+// printBenchmark prints a benchmark report as tables.
+func printBenchmark(r *initialization.BenchmarkReport) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROVIDER\tMODEL\tTYPE\tBATCH SIZE\tDURATION\tLABELS/S")
+	for _, p := range r.Providers {
+		for _, b := range p.Batches {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%.0f\n", p.ID, p.Model, p.DeviceType, b.BatchSize, b.Duration.Round(time.Millisecond), b.LabelsPerSecond)
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "PROVIDER\tBEST BATCH SIZE\tLABELS/S WITH CHECK\tPROJECTED TIME FOR %d LABELS\n", r.TotalLabels)
+	for _, p := range r.Providers {
+		fmt.Fprintf(w, "%d\t%d\t%.0f\t%s\n", p.ID, p.BestBatchSize, p.LabelsPerSecond, p.ProjectedDuration.Round(time.Second))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "reference check\t%.0f labels/s\n", r.ReferenceLabelsPerSecond)
+	if r.DiskBytesPerSecond > 0 {
+		fmt.Fprintf(w, "disk write\t%.1f MiB/s\n", r.DiskBytesPerSecond/config.MiB)
+	}
+	fmt.Fprintf(w, "all providers\t%.0f labels/s\n", r.LabelsPerSecond)
+	fmt.Fprintf(w, "projected time\t%s\n", r.ProjectedDuration.Round(time.Second))
+	return w.Flush()
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/spacemeshos/post/config"
+)
+
+// defaultCommitmentAtxId is used if no commitment atx id is given.
+const defaultCommitmentAtxId = "9eebff023abb17ccb775c602daade8ed708f0a50d3149a42801184f5b74f2865"
+
+// settings are the parameters of a command. They are the mainnet defaults, overridden by the values in the config
+// file, overridden by the flags.
+type settings struct {
+	Config   config.Config
+	InitOpts config.InitOpts
+
+	// NodeId is the miner's id (public key) in hex.
+	NodeId string
+	// CommitmentAtxId is the id of the commitment atx in hex.
+	CommitmentAtxId string
+}
+
+func defaultSettings() settings {
+	return settings{
+		Config:          config.MainnetConfig(),
+		InitOpts:        config.MainnetInitOpts(),
+		CommitmentAtxId: defaultCommitmentAtxId,
+	}
+}
+
+// loadSettingsFile overrides s with the values in a YAML or JSON file, selected by the extension of the file. Values
+// that aren't in the file keep their current value. Keys are the names of the fields, e.g.:
+//
+//	Config:
+//	  LabelsPerUnit: 4294967296
+//	InitOpts:
+//	  DataDir: /data/post
+//	  NumUnits: 4
+//	  ProviderIDs: [0, 1]
+func loadSettingsFile(path string, s *settings) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		// YAML is translated to JSON, so that both formats use the same keys.
+		var v any
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file %s: expected a .json, .yaml or .yml file", path)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(s); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// identity decodes the node id and commitment atx id of the settings.
+func (s *settings) identity() (nodeId, commitmentAtxId []byte, err error) {
+	if s.NodeId == "" {
+		return nil, nil, errors.New("the node id is required")
+	}
+	if nodeId, err = hex.DecodeString(s.NodeId); err != nil {
+		return nil, nil, fmt.Errorf("invalid node id: %w", err)
+	}
+	if s.CommitmentAtxId == "" {
+		return nil, nil, errors.New("the commitment atx id is required")
+	}
+	if commitmentAtxId, err = hex.DecodeString(s.CommitmentAtxId); err != nil {
+		return nil, nil, fmt.Errorf("invalid commitment atx id: %w", err)
+	}
+	return nodeId, commitmentAtxId, nil
+}
+
+// settingsFlags binds the flags of a command to its settings.
+type settingsFlags struct {
+	*flag.FlagSet
+	settings   settings
+	configPath string
+}
+
+func newSettingsFlags(name string) *settingsFlags {
+	f := &settingsFlags{
+		FlagSet:  flag.NewFlagSet(name, flag.ExitOnError),
+		settings: defaultSettings(),
+	}
+	f.StringVar(&f.configPath, "config", "", "YAML or JSON file with the config and init options, flags override its values")
+	return f
+}
+
+// parse parses the flags of the command. If a config file is given, the settings are loaded from the file and the
+// flags are applied again on top of them.
+func (f *settingsFlags) parse(args []string) error {
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	if f.configPath == "" {
+		return nil
+	}
+
+	f.settings = defaultSettings()
+	if err := loadSettingsFile(f.configPath, &f.settings); err != nil {
+		return err
+	}
+	return f.Parse(args)
+}
+
+func (f *settingsFlags) dataDirFlag() {
+	f.StringVar(&f.settings.InitOpts.DataDir, "datadir", f.settings.InitOpts.DataDir, "filesystem datadir path")
+}
+
+func (f *settingsFlags) identityFlags() {
+	f.StringVar(&f.settings.NodeId, "id", "", "miner's id (public key), in hex (will be auto-generated if not provided)")
+	f.StringVar(&f.settings.CommitmentAtxId, "commitmentAtxId", f.settings.CommitmentAtxId, "commitment atx id, in hex")
+}
+
+func (f *settingsFlags) providersFlag() {
+	f.Var((*uintsValue)(&f.settings.InitOpts.ProviderIDs), "provider", "comma separated compute provider ids, example: 0,1,2; the fastest provider is selected if not set")
+}
+
+func (f *settingsFlags) initFlags() {
+	cfg, opts := &f.settings.Config, &f.settings.InitOpts
+
+	f.dataDirFlag()
+	f.identityFlags()
+	f.providersFlag()
+	f.BoolVar(&opts.ProviderSelection.ExcludeCPU, "excludeCPU", opts.ProviderSelection.ExcludeCPU, "without -provider, don't select the CPU provider")
+	f.Var((*uintsValue)(&opts.ProviderSelection.Exclude), "excludeProviders", "without -provider, comma separated ids of providers that aren't selected")
+	f.Var((*stringsValue)(&opts.DataDirs), "datadirs", "comma separated directories to spread the files over, e.g. on several disks; the metadata stays in -datadir")
+	f.Var((*placementValue)(&opts.Placement), "placeByCapacity", "with -datadirs, place every file in the directory with the most free space instead of round robin")
+	f.BoolVar(&opts.Preallocate, "preallocate", opts.Preallocate, "allocate the disk space of all files before computing labels")
+	f.Uint64Var(&opts.MaxFileSize, "maxFileSize", opts.MaxFileSize, "max file size")
+	f.Uint64Var(&cfg.LabelsPerUnit, "labelsPerUnit", cfg.LabelsPerUnit, "the number of labels per unit")
+	f.Var((*uint32Value)(&opts.NumUnits), "numUnits", "number of units")
+
+	f.Func("checkLabels", "number of random labels per batch that are checked on the CPU during initialization, in addition to the last one", func(s string) error {
+		n, err := strconv.ParseUint(s, 10, 0)
+		if err != nil {
+			return err
+		}
+		opts.Verification.Labels = uint(n)
+		opts.Verification.Mode = config.VerifyRandomLabels
+		return nil
+	})
+	f.Func("checkPercentage", "percentage of labels per batch that are checked on the CPU during initialization, in addition to the last one", func(s string) error {
+		p, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		opts.Verification.Percentage = p
+		opts.Verification.Mode = config.VerifyPercentage
+		return nil
+	})
+	f.Uint64Var(&opts.ComputeBatchSize, "batchSize", opts.ComputeBatchSize, "number of labels computed per call to a provider, unless -tuneBatchSize is set")
+	f.BoolVar(&opts.BatchSizeTuning.Enabled, "tuneBatchSize", opts.BatchSizeTuning.Enabled, "tune the batch size of every provider, the tuned sizes are recorded in -datadir and reused")
+	f.DurationVar(&opts.BatchSizeTuning.TargetDuration, "tuneTarget", opts.BatchSizeTuning.TargetDuration, "with -tuneBatchSize, the duration computing a batch should stay below")
+	f.IntVar(&opts.Verification.MaxRetries, "checkRetries", opts.Verification.MaxRetries, "number of times a batch that failed the check is computed again on the same provider")
+
+	f.IntVar(&opts.FromFileIdx, "fromFile", opts.FromFileIdx, "index of the first file to init (inclusive)")
+	f.Func("toFile", "index of the last file to init (inclusive). Will init to the end of declared space if not provided.", func(s string) error {
+		to, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		opts.ToFileIdx = &to
+		return nil
+	})
+}
+
+// uintsValue is a flag of comma separated uints.
+type uintsValue []uint
+
+func (v *uintsValue) String() string {
+	s := make([]string, 0, len(*v))
+	for _, n := range *v {
+		s = append(s, strconv.FormatUint(uint64(n), 10))
+	}
+	return strings.Join(s, ",")
+}
+
+func (v *uintsValue) Set(s string) error {
+	var values []uint
+	for _, p := range strings.Split(s, ",") {
+		n, err := strconv.ParseUint(strings.TrimSpace(p), 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid value %q: %w", p, err)
+		}
+		values = append(values, uint(n))
+	}
+	*v = values
+	return nil
+}
+
+// stringsValue is a flag of comma separated strings.
+type stringsValue []string
+
+func (v *stringsValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *stringsValue) Set(s string) error {
+	var values []string
+	for _, p := range strings.Split(s, ",") {
+		values = append(values, strings.TrimSpace(p))
+	}
+	*v = values
+	return nil
+}
+
+// uint32Value is a uint32 flag, which the flag package doesn't support.
+type uint32Value uint32
+
+func (v *uint32Value) String() string {
+	return strconv.FormatUint(uint64(*v), 10)
+}
+
+func (v *uint32Value) Set(s string) error {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return err
+	}
+	*v = uint32Value(n)
+	return nil
+}
+
+// placementValue is a boolean flag that selects PlaceByCapacity if set.
+type placementValue config.FilePlacement
+
+func (v *placementValue) IsBoolFlag() bool {
+	return true
+}
+
+func (v *placementValue) String() string {
+	return strconv.FormatBool(config.FilePlacement(*v) == config.PlaceByCapacity)
+}
+
+func (v *placementValue) Set(s string) error {
+	byCapacity, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v = placementValue(config.PlaceRoundRobin)
+	if byCapacity {
+		*v = placementValue(config.PlaceByCapacity)
+	}
+	return nil
+}
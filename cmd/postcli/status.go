@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/shared"
+)
+
+// statusResult is the result of the status command.
+type statusResult struct {
+	DataDir         string
+	NodeId          string
+	CommitmentAtxId string
+	NumUnits        uint32
+	LabelsPerUnit   uint64
+	MaxFileSize     uint64
+	NumFiles        int
+
+	Status           string
+	NumLabelsWritten uint64
+	TargetNumLabels  uint64
+	Nonce            *uint64 `json:",omitempty"`
+
+	Checksums *initialization.IntegrityReport `json:",omitempty"`
+	Samples   *initialization.SampleReport    `json:",omitempty"`
+}
+
+func runStatus(args []string) error {
+	flags := newSettingsFlags("status")
+	flags.dataDirFlag()
+	checksums := flags.Bool("checksums", false, "re-hash the initialized files and report the ones that don't match their checksum")
+	samples := flags.Int("samples", 0, "the number of random labels of the initialized files to verify by recomputing them on the CPU")
+	fix := flags.Bool("fix", false, "regenerate labels around the mismatches found by -samples")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.parse(args); err != nil {
+		return err
+	}
+	if *fix && *samples == 0 {
+		return errors.New("-fix requires -samples")
+	}
+
+	zapLog, err := zap.NewProduction()
+	if err != nil {
+		return fmt.Errorf("failed to initialize zap logger: %w", err)
+	}
+	init, m, err := initializerFromMetadata(&flags.settings, zapLog)
+	if err != nil {
+		return err
+	}
+	opts := flags.settings.InitOpts
+	numLabelsWritten, err := initialization.NewDiskState(opts.DataDir, config.BitsPerLabel).NumLabelsWritten()
+	if err != nil {
+		return err
+	}
+	result := statusResult{
+		DataDir:          opts.DataDir,
+		NodeId:           hex.EncodeToString(m.NodeId),
+		CommitmentAtxId:  hex.EncodeToString(m.CommitmentAtxId),
+		NumUnits:         m.NumUnits,
+		LabelsPerUnit:    m.LabelsPerUnit,
+		MaxFileSize:      m.MaxFileSize,
+		NumFiles:         opts.TotalFiles(m.LabelsPerUnit),
+		Status:           statusName(init.Status()),
+		NumLabelsWritten: numLabelsWritten,
+		TargetNumLabels:  opts.TotalLabels(m.LabelsPerUnit),
+		Nonce:            m.Nonce,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *checksums {
+		log.Println("cli: verifying checksums of files in", opts.DataDir)
+		if result.Checksums, err = initialization.VerifyChecksums(ctx, opts.DataDir); err != nil {
+			return fmt.Errorf("failed to verify checksums: %w", err)
+		}
+	}
+	if *samples > 0 {
+		log.Printf("cli: verifying %d random labels in %s\n", *samples, opts.DataDir)
+		if result.Samples, err = init.VerifySamples(ctx, *samples); err != nil {
+			return fmt.Errorf("failed to verify labels: %w", err)
+		}
+	}
+
+	if *asJSON {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	} else {
+		printStatus(&result)
+	}
+
+	if *fix && len(result.Samples.Mismatches) > 0 {
+		if err := init.FixSamples(ctx, result.Samples.Mismatches); err != nil {
+			return fmt.Errorf("failed to fix labels: %w", err)
+		}
+		log.Println("cli: mismatching labels regenerated, run status -samples again to check the remaining labels of the affected files")
+		return nil
+	}
+	if (result.Checksums != nil && !result.Checksums.OK()) || (result.Samples != nil && len(result.Samples.Mismatches) > 0) {
+		return &exitError{code: exitFailed, msg: "the data is corrupted"}
+	}
+	return nil
+}
+
+func printStatus(r *statusResult) {
+	log.Printf("cli: datadir %s: %s, %d/%d labels written in %d files\n",
+		r.DataDir, r.Status, r.NumLabelsWritten, r.TargetNumLabels, r.NumFiles)
+	log.Printf("cli: node id %s, commitment atx id %s, %d units of %d labels\n",
+		r.NodeId, r.CommitmentAtxId, r.NumUnits, r.LabelsPerUnit)
+	if r.Nonce != nil {
+		log.Println("cli: nonce", *r.Nonce)
+	}
+
+	if report := r.Checksums; report != nil {
+		log.Printf("cli: %d files valid\n", len(report.Valid))
+		if len(report.Unknown) > 0 {
+			log.Println("cli: files without checksum (not verified):", report.Unknown)
+		}
+		if len(report.Missing) > 0 {
+			log.Println("cli: missing files:", report.Missing)
+		}
+		if len(report.Corrupt) > 0 {
+			log.Println("cli: corrupt files:", report.Corrupt)
+		}
+	}
+
+	if report := r.Samples; report != nil {
+		log.Printf("cli: %d labels verified, %d mismatches\n", report.NumSamples, len(report.Mismatches))
+		for _, mismatch := range report.Mismatches {
+			log.Printf("cli: label %d in file %d doesn't match\n", mismatch.Position, mismatch.FileIndex)
+		}
+		if len(report.Mismatches) > 0 {
+			log.Println("cli: affected files:", report.FileIndices())
+		}
+	}
+}
+
+// initializerFromMetadata returns an initializer for the data in the datadir of the settings. The identity and the
+// layout of the data are taken from its metadata.
+func initializerFromMetadata(s *settings, logger *zap.Logger) (*initialization.Initializer, *shared.PostMetadata, error) {
+	m, err := initialization.LoadMetadata(s.InitOpts.DataDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load metadata: %w", err)
+	}
+	s.Config.LabelsPerUnit = m.LabelsPerUnit
+	s.InitOpts.NumUnits = m.NumUnits
+	s.InitOpts.MaxFileSize = m.MaxFileSize
+
+	init, err := initialization.NewInitializer(
+		initialization.WithConfig(s.Config),
+		initialization.WithInitOpts(s.InitOpts),
+		initialization.WithNodeId(m.NodeId),
+		initialization.WithCommitmentAtxId(m.CommitmentAtxId),
+		initialization.WithLogger(logger),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create initializer: %w", err)
+	}
+	return init, m, nil
+}
+
+func statusName(s initialization.Status) string {
+	switch s {
+	case initialization.StatusNotStarted:
+		return "not started"
+	case initialization.StatusStarted:
+		return "started"
+	case initialization.StatusInitializing:
+		return "initializing"
+	case initialization.StatusCompleted:
+		return "completed"
+	default:
+		return "error"
+	}
+}
@@ -7,8 +7,9 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
-	"github.com/spacemeshos/post/internal/postrs"
 	"github.com/spacemeshos/post/shared"
 )
 
@@ -40,39 +41,6 @@ func BytesPerLabel() int {
 	return BitsPerLabel / 8
 }
 
-type PowFlags = postrs.PowFlags
-
-const (
-	// Use the full dataset. AKA "Fast mode".
-	PowFastMode = postrs.PowFastMode
-	// Allocate memory in large pages.
-	PowLargePages = postrs.PowLargePages
-	// Use JIT compilation support.
-	PowJIT = postrs.PowJIT
-	// When combined with FLAG_JIT, the JIT pages are never writable and executable at the same time.
-	PowSecure = postrs.PowSecure
-	// Use hardware accelerated AES.
-	PowHardAES = postrs.PowHardAES
-	// Optimize Argon2 for CPUs with the SSSE3 instruction set.
-	PowArgon2SSSE3 = postrs.PowArgon2SSSE3
-	// Optimize Argon2 for CPUs with the SSSE3 instruction set.
-	PowArgon2AVX2 = postrs.PowArgon2AVX2
-	// Optimize Argon2 for CPUs without the AVX2 or SSSE3 instruction sets.
-	PowArgon2 = postrs.PowArgon2
-)
-
-func RecommendedPowFlags() PowFlags {
-	return postrs.GetRecommendedPowFlags()
-}
-
-func DefaultProvingPowFlags() PowFlags {
-	return RecommendedPowFlags() | PowFastMode
-}
-
-func DefaultVerifyingPowFlags() PowFlags {
-	return RecommendedPowFlags()
-}
-
 type Config struct {
 	MinNumUnits   uint32
 	MaxNumUnits   uint32
@@ -123,14 +91,38 @@ func (c *Config) UnitSize() uint64 {
 }
 
 type InitOpts struct {
-	DataDir     string
+	// DataDir holds the metadata of the initialization and, unless DataDirs is set, the label files.
+	DataDir string
+	// DataDirs are the directories the label files are spread over, e.g. to use several disks. DataDir may be one
+	// of them. The directory of every file is recorded in the metadata.
+	DataDirs []string
+	// Placement selects the directory of every new label file if DataDirs is set.
+	Placement FilePlacement
+	// Preallocate allocates the disk space of all label files before any labels are computed, where supported.
+	Preallocate bool
+
 	NumUnits    uint32
 	MaxFileSize uint64
-	ProviderID  string
-	Throttle    bool
-	Scrypt      ScryptParams
+	// ProviderIDs are the compute providers used for initialization. Files are scheduled across
+	// all of them, faster providers initialize more files than slower ones. If empty, the fastest
+	// provider is selected with a short benchmark.
+	ProviderIDs []uint
+	// ProviderID is the decimal ID of a single compute provider, or BestProviderID. It is only used if ProviderIDs
+	// is empty.
+	//
+	// Deprecated: use ProviderIDs.
+	ProviderID string
+	// ProviderSelection restricts the providers that are considered if ProviderIDs is empty.
+	ProviderSelection ProviderSelection
+	Throttle          bool
+	Scrypt            ScryptParams
 	// ComputeBatchSize must be greater than 0
 	ComputeBatchSize uint64
+	// BatchSizeTuning replaces ComputeBatchSize with a batch size tuned for every provider, if enabled.
+	BatchSizeTuning BatchSizeTuning
+
+	// Verification determines which computed labels are checked against the CPU before they are written.
+	Verification VerificationPolicy
 
 	// Index of the first file to init (inclusive)
 	FromFileIdx int
@@ -138,6 +130,63 @@ type InitOpts struct {
 	ToFileIdx *int
 }
 
+// FilePlacement selects the directory of a new label file if they are spread over multiple directories.
+type FilePlacement int
+
+const (
+	// PlaceRoundRobin places the file with index N in directory N modulo the number of directories.
+	PlaceRoundRobin FilePlacement = iota
+	// PlaceByCapacity places a file in the directory with the most free space.
+	PlaceByCapacity
+)
+
+// ProviderSelection restricts the compute providers that are considered for the automatic selection of the fastest
+// provider.
+type ProviderSelection struct {
+	// ExcludeCPU excludes the CPU provider.
+	ExcludeCPU bool
+	// Exclude are the IDs of providers that are never selected.
+	Exclude []uint
+}
+
+// BatchSizeTuning configures the tuning of the batch size of every compute provider. Starting with MinBatchSize the
+// batch size is doubled as long as the rate in which labels are computed improves and a batch still completes within
+// TargetDuration. Larger batches keep a fast device saturated, smaller ones keep less computed labels in memory and
+// report progress more often. Tuning doesn't affect how long stopping takes: a batch is computed in chunks of
+// postrs.DefaultChunkSize labels and can be canceled between them.
+type BatchSizeTuning struct {
+	Enabled        bool
+	TargetDuration time.Duration
+	MinBatchSize   uint64
+	MaxBatchSize   uint64
+}
+
+func (t *BatchSizeTuning) Validate() error {
+	if !t.Enabled {
+		return nil
+	}
+	if t.TargetDuration <= 0 {
+		return fmt.Errorf("invalid `BatchSizeTuning.TargetDuration`; expected: > 0, given: %v", t.TargetDuration)
+	}
+	if t.MinBatchSize == 0 {
+		return errors.New("invalid `BatchSizeTuning.MinBatchSize`; expected: > 0")
+	}
+	if t.MaxBatchSize < t.MinBatchSize {
+		return fmt.Errorf("invalid `BatchSizeTuning.MaxBatchSize`; expected: >= %d, given: %d", t.MinBatchSize, t.MaxBatchSize)
+	}
+	return nil
+}
+
+// DefaultBatchSizeTuning returns the default BatchSizeTuning, which is disabled.
+func DefaultBatchSizeTuning() BatchSizeTuning {
+	return BatchSizeTuning{
+		Enabled:        false,
+		TargetDuration: 5 * time.Second,
+		MinBatchSize:   1 << 12,
+		MaxBatchSize:   1 << 24,
+	}
+}
+
 func (o *InitOpts) MaxFileNumLabels() uint64 {
 	return o.MaxFileSize / uint64(BytesPerLabel())
 }
@@ -150,6 +199,60 @@ func (o *InitOpts) TotalFiles(labelsPerUnit uint64) int {
 	return int(math.Ceil(float64(o.TotalLabels(labelsPerUnit)) / float64(o.MaxFileNumLabels())))
 }
 
+// VerificationMode selects the labels of a computed batch that are checked against the CPU.
+type VerificationMode int
+
+const (
+	// VerifyLastLabel checks only the last label of every batch.
+	VerifyLastLabel VerificationMode = iota
+	// VerifyRandomLabels checks `VerificationPolicy.Labels` random labels of every batch in addition to the last one.
+	VerifyRandomLabels
+	// VerifyPercentage checks `VerificationPolicy.Percentage` percent of the labels of every batch, chosen at random,
+	// in addition to the last one.
+	VerifyPercentage
+)
+
+// VerificationPolicy determines how labels computed during initialization are verified.
+// Every checked label is recomputed on the CPU, so checking more labels slows down initialization.
+type VerificationPolicy struct {
+	Mode       VerificationMode
+	Labels     uint    // number of random labels per batch for VerifyRandomLabels
+	Percentage float64 // percentage of labels per batch for VerifyPercentage, in (0, 100]
+
+	// MaxRetries is the number of times a batch that failed verification is computed again on the same device,
+	// before the device is given up and the batch is handed to the remaining devices.
+	MaxRetries int
+}
+
+func (p *VerificationPolicy) Validate() error {
+	switch p.Mode {
+	case VerifyLastLabel:
+	case VerifyRandomLabels:
+		if p.Labels == 0 {
+			return errors.New("invalid `Verification.Labels`; expected: > 0")
+		}
+	case VerifyPercentage:
+		if p.Percentage <= 0 || p.Percentage > 100 {
+			return fmt.Errorf("invalid `Verification.Percentage`; expected: > 0 and <= 100, given: %v", p.Percentage)
+		}
+	default:
+		return fmt.Errorf("invalid `Verification.Mode`: %d", p.Mode)
+	}
+
+	if p.MaxRetries < 0 {
+		return fmt.Errorf("invalid `Verification.MaxRetries`; expected: >= 0, given: %d", p.MaxRetries)
+	}
+	return nil
+}
+
+// DefaultVerificationPolicy returns the default VerificationPolicy.
+func DefaultVerificationPolicy() VerificationPolicy {
+	return VerificationPolicy{
+		Mode:       VerifyLastLabel,
+		MaxRetries: 1,
+	}
+}
+
 type ScryptParams struct {
 	N, R, P uint
 }
@@ -175,20 +278,17 @@ func DefaultLabelParams() ScryptParams {
 	}
 }
 
-// BestProviderID can be used for selecting the most performant provider
-// based on a short benchmarking session.
-const BestProviderID = ""
-
 // MainnetInitOpts returns the default InitOpts for mainnet.
 func MainnetInitOpts() InitOpts {
 	return InitOpts{
 		DataDir:          DefaultDataDir,
 		NumUnits:         4,
 		MaxFileSize:      defaultMaxFileSize,
-		ProviderID:       BestProviderID,
 		Throttle:         false,
 		Scrypt:           DefaultLabelParams(),
 		ComputeBatchSize: DefaultComputeBatchSize,
+		BatchSizeTuning:  DefaultBatchSizeTuning(),
+		Verification:     DefaultVerificationPolicy(),
 	}
 }
 
@@ -198,11 +298,31 @@ func DefaultInitOpts() InitOpts {
 		DataDir:          DefaultDataDir,
 		NumUnits:         2,
 		MaxFileSize:      defaultMaxFileSize,
-		ProviderID:       BestProviderID,
 		Throttle:         false,
 		Scrypt:           DefaultLabelParams(),
 		ComputeBatchSize: DefaultComputeBatchSize,
+		BatchSizeTuning:  DefaultBatchSizeTuning(),
+		Verification:     DefaultVerificationPolicy(),
+	}
+}
+
+// BestProviderID can be used for selecting the most performant provider
+// based on a short benchmarking session.
+//
+// Deprecated: leave InitOpts.ProviderIDs empty to select the most performant provider.
+const BestProviderID = ""
+
+// SelectedProviderIDs returns the compute providers to initialize with, mapping the deprecated ProviderID onto
+// ProviderIDs. It returns an empty list if the fastest provider is to be selected.
+func (o *InitOpts) SelectedProviderIDs() ([]uint, error) {
+	if len(o.ProviderIDs) > 0 || o.ProviderID == BestProviderID {
+		return o.ProviderIDs, nil
 	}
+	id, err := strconv.ParseUint(o.ProviderID, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid `opts.ProviderID`; expected: a provider ID, given: %q", o.ProviderID)
+	}
+	return []uint{uint(id)}, nil
 }
 
 func Validate(cfg Config, opts InitOpts) error {
@@ -222,6 +342,30 @@ func Validate(cfg Config, opts InitOpts) error {
 		return fmt.Errorf("invalid `opts.ComputeBatchSize` expected: > 0, given: %d", opts.ComputeBatchSize)
 	}
 
+	if _, err := opts.SelectedProviderIDs(); err != nil {
+		return err
+	}
+
+	if err := opts.BatchSizeTuning.Validate(); err != nil {
+		return err
+	}
+
+	if err := opts.Verification.Validate(); err != nil {
+		return err
+	}
+
+	for _, dir := range opts.DataDirs {
+		if dir == "" {
+			return errors.New("invalid `opts.DataDirs`; expected: non-empty directories")
+		}
+	}
+
+	switch opts.Placement {
+	case PlaceRoundRobin, PlaceByCapacity:
+	default:
+		return fmt.Errorf("invalid `opts.Placement`: %d", opts.Placement)
+	}
+
 	if res := shared.Uint64MulOverflow(cfg.LabelsPerUnit, uint64(opts.NumUnits)); res {
 		return fmt.Errorf("uint64 overflow: `cfg.LabelsPerUnit` (%v) * `opts.NumUnits` (%v) exceeds the range allowed by uint64",
 			cfg.LabelsPerUnit, opts.NumUnits)
@@ -35,3 +35,46 @@ func TestTotalFiles(t *testing.T) {
 	}
 	r.Equal(0, opts.TotalFiles(128))
 }
+
+func TestVerificationPolicy_Validate(t *testing.T) {
+	policy := config.DefaultVerificationPolicy()
+	require.NoError(t, policy.Validate())
+
+	invalid := []config.VerificationPolicy{
+		{Mode: config.VerifyRandomLabels},
+		{Mode: config.VerifyPercentage},
+		{Mode: config.VerifyPercentage, Percentage: 101},
+		{Mode: config.VerifyLastLabel, MaxRetries: -1},
+		{Mode: 42},
+	}
+	for _, policy := range invalid {
+		require.Error(t, policy.Validate(), "policy: %+v", policy)
+	}
+}
+
+func TestInitOpts_SelectedProviderIDs(t *testing.T) {
+	r := require.New(t)
+
+	opts := config.DefaultInitOpts()
+	ids, err := opts.SelectedProviderIDs()
+	r.NoError(err)
+	r.Empty(ids)
+
+	// the deprecated ProviderID is mapped onto ProviderIDs
+	opts.ProviderID = "3"
+	ids, err = opts.SelectedProviderIDs()
+	r.NoError(err)
+	r.Equal([]uint{3}, ids)
+
+	opts.ProviderIDs = []uint{1, 2}
+	ids, err = opts.SelectedProviderIDs()
+	r.NoError(err)
+	r.Equal([]uint{1, 2}, ids)
+
+	opts.ProviderIDs = nil
+	r.NoError(config.Validate(config.DefaultConfig(), opts))
+	opts.ProviderID = "gpu"
+	_, err = opts.SelectedProviderIDs()
+	r.Error(err)
+	r.Error(config.Validate(config.DefaultConfig(), opts))
+}
@@ -0,0 +1,39 @@
+//go:build cgo
+
+package config
+
+import "github.com/spacemeshos/post/internal/postrs"
+
+// PowFlags configure the native RandomX implementation, they are only available if cgo is enabled.
+type PowFlags = postrs.PowFlags
+
+const (
+	// Use the full dataset. AKA "Fast mode".
+	PowFastMode = postrs.PowFastMode
+	// Allocate memory in large pages.
+	PowLargePages = postrs.PowLargePages
+	// Use JIT compilation support.
+	PowJIT = postrs.PowJIT
+	// When combined with FLAG_JIT, the JIT pages are never writable and executable at the same time.
+	PowSecure = postrs.PowSecure
+	// Use hardware accelerated AES.
+	PowHardAES = postrs.PowHardAES
+	// Optimize Argon2 for CPUs with the SSSE3 instruction set.
+	PowArgon2SSSE3 = postrs.PowArgon2SSSE3
+	// Optimize Argon2 for CPUs with the SSSE3 instruction set.
+	PowArgon2AVX2 = postrs.PowArgon2AVX2
+	// Optimize Argon2 for CPUs without the AVX2 or SSSE3 instruction sets.
+	PowArgon2 = postrs.PowArgon2
+)
+
+func RecommendedPowFlags() PowFlags {
+	return postrs.GetRecommendedPowFlags()
+}
+
+func DefaultProvingPowFlags() PowFlags {
+	return RecommendedPowFlags() | PowFastMode
+}
+
+func DefaultVerifyingPowFlags() PowFlags {
+	return RecommendedPowFlags()
+}
@@ -0,0 +1,221 @@
+package initialization
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/oracle"
+)
+
+// batchSizesFileName is the name of the file in the data directory that records the tuned batch sizes of the compute
+// providers of every host.
+const batchSizesFileName = "postdata_batchsizes.json"
+
+// minTuningGain is the minimal relative improvement of the rate a doubled batch size has to achieve to be preferred.
+// Otherwise the smaller batch size is kept, since it allocates less memory and stops sooner.
+const minTuningGain = 0.05
+
+// TunedBatchSize is the batch size tuned for a compute provider. It is reused as long as the provider, the scrypt
+// parameters and the tuning options stay the same.
+type TunedBatchSize struct {
+	Provider
+	Scrypt config.ScryptParams
+	Tuning config.BatchSizeTuning
+
+	BatchSize       uint64
+	LabelsPerSecond float64
+	// Latency is the duration of a call that computes BatchSize labels.
+	Latency time.Duration
+}
+
+// tuneBatchSize ramps up the batch size from tuning.MinBatchSize by doubling it, measuring every batch size with
+// measure. It settles on the last batch size whose call completes within tuning.TargetDuration if doubling it again
+// isn't expected to complete within the target, doesn't improve the rate or exceeds tuning.MaxBatchSize.
+// If even the smallest batch size exceeds the target duration, the smallest batch size is used.
+func tuneBatchSize(tuning config.BatchSizeTuning, measure func(batchSize uint64) (time.Duration, error)) (TunedBatchSize, error) {
+	var best TunedBatchSize
+	for batchSize := tuning.MinBatchSize; batchSize <= tuning.MaxBatchSize; batchSize *= 2 {
+		latency, err := measure(batchSize)
+		if err != nil {
+			return TunedBatchSize{}, err
+		}
+		rate := float64(batchSize) / latency.Seconds()
+
+		if best.BatchSize != 0 && (latency > tuning.TargetDuration || rate < best.LabelsPerSecond*(1+minTuningGain)) {
+			break
+		}
+		best = TunedBatchSize{BatchSize: batchSize, LabelsPerSecond: rate, Latency: latency}
+
+		// the duration grows linearly with the batch size once the device is saturated
+		if 2*latency > tuning.TargetDuration || batchSize > tuning.MaxBatchSize/2 {
+			break
+		}
+	}
+	return best, nil
+}
+
+// tuneBatchSizes returns the batch size of every given oracle by provider ID. Batch sizes tuned before on this host are
+// taken from the record in the data directory, the others are tuned and added to the record. If tuning is disabled
+// every oracle uses the ComputeBatchSize of the init options.
+func (init *Initializer) tuneBatchSizes(ctx context.Context, oracles []*oracle.WorkOracle) (map[uint]uint64, error) {
+	batchSizes := make(map[uint]uint64, len(oracles))
+	tuning := init.opts.BatchSizeTuning
+	if !tuning.Enabled {
+		for _, wo := range oracles {
+			batchSizes[wo.ProviderID()] = init.opts.ComputeBatchSize
+		}
+		return batchSizes, nil
+	}
+
+	// the CPU is identified by its ID alone, the providers only have to be queried to identify the other devices
+	var providers []Provider
+	for _, wo := range oracles {
+		if wo.ProviderID() == CPUProviderID() {
+			continue
+		}
+		var err error
+		if providers, err = init.openCLProviders(); err != nil {
+			return nil, fmt.Errorf("failed to get compute providers: %w", err)
+		}
+		break
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host name: %w", err)
+	}
+
+	record, err := loadBatchSizes(init.opts.DataDir)
+	if err != nil {
+		init.logger.Warn("initialization: ignoring recorded batch sizes", zap.Error(err))
+		record = make(map[string][]TunedBatchSize)
+	}
+
+	updated := false
+	for _, wo := range oracles {
+		p := Provider{ID: wo.ProviderID(), Model: "CPU", DeviceType: postrs.ClassCPU}
+		if p.ID != CPUProviderID() {
+			p = Provider{ID: wo.ProviderID()}
+			for _, provider := range providers {
+				if provider.ID == p.ID {
+					p = provider
+				}
+			}
+		}
+
+		if t, ok := recordedBatchSize(record[host], p, init.opts.Scrypt, tuning); ok {
+			init.logger.Info("initialization: using tuned batch size",
+				zap.Uint("providerId", p.ID),
+				zap.Uint64("batchSize", t.BatchSize),
+			)
+			batchSizes[p.ID] = t.BatchSize
+			continue
+		}
+
+		init.logger.Info("initialization: tuning batch size",
+			zap.Uint("providerId", p.ID),
+			zap.String("model", p.Model),
+			zap.Duration("targetDuration", tuning.TargetDuration),
+		)
+		t, err := init.tuneOracle(ctx, wo, tuning)
+		if err != nil {
+			return nil, fmt.Errorf("failed to tune batch size of provider %d: %w", p.ID, err)
+		}
+		t.Provider = p
+		t.Scrypt = init.opts.Scrypt
+		t.Tuning = tuning
+		init.logger.Info("initialization: tuned batch size",
+			zap.Uint("providerId", p.ID),
+			zap.Uint64("batchSize", t.BatchSize),
+			zap.Float64("labelsPerSecond", t.LabelsPerSecond),
+			zap.Duration("latency", t.Latency),
+		)
+
+		batchSizes[p.ID] = t.BatchSize
+		record[host] = replaceBatchSize(record[host], t)
+		updated = true
+	}
+
+	if updated {
+		if err := saveBatchSizes(init.opts.DataDir, record); err != nil {
+			init.logger.Warn("initialization: failed to record tuned batch sizes", zap.Error(err))
+		}
+	}
+	return batchSizes, nil
+}
+
+// tuneOracle tunes the batch size of a work oracle. The labels computed while tuning are discarded, a first minimal
+// call warms the device up, e.g. to compile the kernel of a GPU.
+func (init *Initializer) tuneOracle(ctx context.Context, wo *oracle.WorkOracle, tuning config.BatchSizeTuning) (TunedBatchSize, error) {
+	if _, err := wo.PositionsWithContext(ctx, 0, 0); err != nil {
+		return TunedBatchSize{}, err
+	}
+
+	return tuneBatchSize(tuning, func(batchSize uint64) (time.Duration, error) {
+		start := time.Now()
+		if _, err := wo.PositionsWithContext(ctx, 0, batchSize-1); err != nil {
+			return 0, err
+		}
+		latency := time.Since(start)
+		init.logger.Debug("initialization: measured batch size",
+			zap.Uint("providerId", wo.ProviderID()),
+			zap.Uint64("batchSize", batchSize),
+			zap.Duration("latency", latency),
+		)
+		return latency, nil
+	})
+}
+
+// recordedBatchSize returns the recorded batch size of the provider, if it was tuned on the same device with the same
+// scrypt parameters and tuning options.
+func recordedBatchSize(record []TunedBatchSize, p Provider, scrypt config.ScryptParams, tuning config.BatchSizeTuning) (TunedBatchSize, bool) {
+	for _, t := range record {
+		if t.Provider == p && t.Scrypt == scrypt && t.Tuning == tuning {
+			return t, true
+		}
+	}
+	return TunedBatchSize{}, false
+}
+
+func replaceBatchSize(record []TunedBatchSize, t TunedBatchSize) []TunedBatchSize {
+	for i := range record {
+		if record[i].ID == t.ID {
+			record[i] = t
+			return record
+		}
+	}
+	return append(record, t)
+}
+
+// loadBatchSizes returns the tuned batch sizes recorded in the given directory by host name.
+func loadBatchSizes(dir string) (map[string][]TunedBatchSize, error) {
+	data, err := os.ReadFile(filepath.Join(dir, batchSizesFileName))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return make(map[string][]TunedBatchSize), nil
+	case err != nil:
+		return nil, err
+	}
+
+	record := make(map[string][]TunedBatchSize)
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid batch sizes file: %w", err)
+	}
+	return record, nil
+}
+
+func saveBatchSizes(dir string, record map[string][]TunedBatchSize) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dir, batchSizesFileName, data)
+}
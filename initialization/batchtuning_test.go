@@ -0,0 +1,149 @@
+package initialization
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+)
+
+func TestTuneBatchSize(t *testing.T) {
+	tuning := config.BatchSizeTuning{
+		Enabled:        true,
+		TargetDuration: time.Second,
+		MinBatchSize:   1 << 10,
+		MaxBatchSize:   1 << 20,
+	}
+
+	// a device with a fixed overhead per call and a maximal rate once it is saturated
+	device := func(overhead time.Duration, labelsPerSecond float64) func(uint64) (time.Duration, error) {
+		return func(batchSize uint64) (time.Duration, error) {
+			return overhead + time.Duration(float64(batchSize)/labelsPerSecond*float64(time.Second)), nil
+		}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		tuning    func(*config.BatchSizeTuning)
+		measure   func(uint64) (time.Duration, error)
+		batchSize uint64
+	}{
+		{
+			name:      "limited by the target duration",
+			measure:   device(100*time.Millisecond, 1<<16),
+			batchSize: 1 << 15,
+		},
+		{
+			name:      "limited by the rate",
+			measure:   device(time.Millisecond, 1<<25),
+			batchSize: 1 << 19,
+		},
+		{
+			name:      "limited by the max batch size",
+			tuning:    func(t *config.BatchSizeTuning) { t.MaxBatchSize = 1 << 12 },
+			measure:   device(10*time.Millisecond, 1<<25),
+			batchSize: 1 << 12,
+		},
+		{
+			name:      "min batch size exceeds the target",
+			measure:   device(2*time.Second, 1<<20),
+			batchSize: 1 << 10,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tuning := tuning
+			if tc.tuning != nil {
+				tc.tuning(&tuning)
+			}
+			var measured []uint64
+			tuned, err := tuneBatchSize(tuning, func(batchSize uint64) (time.Duration, error) {
+				measured = append(measured, batchSize)
+				return tc.measure(batchSize)
+			})
+			require.NoError(t, err)
+			require.Equal(t, tc.batchSize, tuned.BatchSize)
+			for _, batchSize := range measured {
+				require.LessOrEqual(t, batchSize, tuning.MaxBatchSize)
+			}
+		})
+	}
+
+	errMeasure := errors.New("measure failed")
+	_, err := tuneBatchSize(tuning, func(uint64) (time.Duration, error) { return 0, errMeasure })
+	require.ErrorIs(t, err, errMeasure)
+}
+
+func TestInitialize_TunesBatchSize(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 10
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits
+	opts.ProviderIDs = []uint{CPUProviderID()}
+	opts.BatchSizeTuning = config.BatchSizeTuning{
+		Enabled:        true,
+		TargetDuration: time.Minute,
+		MinBatchSize:   1 << 6,
+		MaxBatchSize:   1 << 8,
+	}
+
+	cpu := Provider{ID: CPUProviderID(), Model: "CPU", DeviceType: postrs.ClassCPU}
+	initialize := func() {
+		init, err := NewInitializer(
+			WithNodeId(nodeId),
+			WithCommitmentAtxId(commitmentAtxId),
+			WithConfig(cfg),
+			WithInitOpts(opts),
+			WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+			// tuning the CPU alone doesn't query the providers
+			withProviders(func() ([]Provider, error) { return nil, errors.New("unexpected call") }, benchmarkProvider),
+		)
+		r.NoError(err)
+		r.NoError(init.Initialize(context.Background()))
+		r.NoError(init.Reset()) // the next run initializes again
+	}
+
+	initialize()
+	host, err := os.Hostname()
+	r.NoError(err)
+	record, err := loadBatchSizes(opts.DataDir)
+	r.NoError(err)
+	r.Len(record[host], 1)
+	tuned := record[host][0]
+	r.Equal(cpu, tuned.Provider)
+	r.Equal(opts.Scrypt, tuned.Scrypt)
+	r.Equal(opts.BatchSizeTuning, tuned.Tuning)
+	r.GreaterOrEqual(tuned.BatchSize, opts.BatchSizeTuning.MinBatchSize)
+	r.LessOrEqual(tuned.BatchSize, opts.BatchSizeTuning.MaxBatchSize)
+
+	// the recorded batch size is reused instead of tuning again
+	tuned.BatchSize = 100
+	record[host][0] = tuned
+	r.NoError(saveBatchSizes(opts.DataDir, record))
+	initialize()
+	record, err = loadBatchSizes(opts.DataDir)
+	r.NoError(err)
+	r.Equal([]TunedBatchSize{tuned}, record[host])
+
+	// different tuning options are tuned again
+	opts.BatchSizeTuning.MaxBatchSize = 1 << 7
+	initialize()
+	record, err = loadBatchSizes(opts.DataDir)
+	r.NoError(err)
+	r.Len(record[host], 1)
+	r.Equal(opts.BatchSizeTuning, record[host][0].Tuning)
+	r.LessOrEqual(record[host][0].BatchSize, opts.BatchSizeTuning.MaxBatchSize)
+}
@@ -1,9 +1,19 @@
 package initialization
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
 	"time"
 
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
 	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/oracle"
+	"github.com/spacemeshos/post/shared"
 )
 
 // Benchmark returns the hashes per second the selected compute provider achieves on the current machine.
@@ -33,3 +43,247 @@ func Benchmark(p Provider) (int, error) {
 	hashesPerSecond := float64(endPosition) / elapsed.Seconds()
 	return int(hashesPerSecond), nil
 }
+
+// benchmarkProvider returns the labels per second a compute provider achieves with the given scrypt parameters and
+// PoW difficulty. It ranks the providers for the automatic selection.
+func benchmarkProvider(ctx context.Context, p Provider, params config.ScryptParams, difficulty []byte) (int, error) {
+	batchSize := uint64(1 << 14)
+	if p.DeviceType == postrs.ClassCPU {
+		batchSize = uint64(1 << 12)
+	}
+	b, err := benchmarkBatch(ctx, p.ID, params, difficulty, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	return int(b.LabelsPerSecond), nil
+}
+
+// BenchmarkOpts configures RunBenchmark.
+type BenchmarkOpts struct {
+	// Scrypt are the parameters the labels are computed with.
+	Scrypt config.ScryptParams
+	// BatchSizes are the numbers of labels computed per call that every provider is measured with.
+	BatchSizes []uint64
+	// CPUBatchSize is the number of labels per call the CPU provider is measured with, instead of BatchSizes, and the
+	// number of labels computed to measure the reference check.
+	CPUBatchSize uint64
+
+	// Verification is the policy the overhead of the reference check is projected for.
+	Verification config.VerificationPolicy
+
+	// DiskDir is the directory the write throughput is measured in. The disk isn't measured if it is empty.
+	DiskDir string
+	// DiskBytes is the number of bytes written to measure the write throughput.
+	DiskBytes uint64
+
+	// NumUnits and LabelsPerUnit are the size of the initialization the duration is projected for.
+	NumUnits      uint32
+	LabelsPerUnit uint64
+}
+
+// DefaultBenchmarkOpts returns the default BenchmarkOpts for the given config and init options.
+func DefaultBenchmarkOpts(cfg config.Config, opts config.InitOpts) BenchmarkOpts {
+	return BenchmarkOpts{
+		Scrypt:        opts.Scrypt,
+		BatchSizes:    []uint64{1 << 14, 1 << 16, 1 << 18},
+		CPUBatchSize:  1 << 10,
+		Verification:  opts.Verification,
+		DiskDir:       opts.DataDir,
+		DiskBytes:     256 * config.MiB,
+		NumUnits:      opts.NumUnits,
+		LabelsPerUnit: cfg.LabelsPerUnit,
+	}
+}
+
+// BenchmarkReport is the result of RunBenchmark.
+type BenchmarkReport struct {
+	Scrypt    config.ScryptParams
+	Providers []ProviderReport
+
+	// ReferenceLabelsPerSecond is the rate in which the CPU recomputes labels for the reference check.
+	ReferenceLabelsPerSecond float64
+	// DiskBytesPerSecond is the write throughput of the disk, zero if it wasn't measured.
+	DiskBytesPerSecond float64
+
+	// TotalLabels is the number of labels the duration is projected for.
+	TotalLabels uint64
+	// LabelsPerSecond is the projected rate of an initialization with all providers, including the reference check
+	// and limited by the disk.
+	LabelsPerSecond float64
+	// ProjectedDuration is the projected duration of an initialization with all providers.
+	ProjectedDuration time.Duration
+}
+
+// ProviderReport is the performance of a compute provider measured by RunBenchmark.
+type ProviderReport struct {
+	Provider
+	Batches []BatchReport
+
+	// BestBatchSize is the batch size with the highest rate.
+	BestBatchSize uint64
+	// LabelsPerSecond is the rate with the best batch size, including the reference check.
+	LabelsPerSecond float64
+	// ProjectedDuration is the projected duration of an initialization with only this provider.
+	ProjectedDuration time.Duration
+}
+
+// BatchReport is the duration of a call that computes BatchSize labels.
+type BatchReport struct {
+	BatchSize       uint64
+	Duration        time.Duration
+	LabelsPerSecond float64
+}
+
+// RunBenchmark measures the rate in which every provider computes labels with the configured scrypt parameters at
+// every batch size, the overhead of the reference check on the CPU and the write throughput of the disk. It projects
+// the duration of an initialization of the configured size from them.
+func RunBenchmark(ctx context.Context, providers []Provider, opts BenchmarkOpts, logger *zap.Logger) (*BenchmarkReport, error) {
+	if err := opts.Scrypt.Validate(); err != nil {
+		return nil, err
+	}
+	if len(opts.BatchSizes) == 0 || opts.CPUBatchSize == 0 {
+		return nil, errors.New("no batch sizes to benchmark")
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	report := &BenchmarkReport{
+		Scrypt:      opts.Scrypt,
+		TotalLabels: uint64(opts.NumUnits) * opts.LabelsPerUnit,
+	}
+	difficulty := shared.PowDifficulty(report.TotalLabels)
+
+	logger.Info("benchmark: measuring the reference check", zap.Uint64("labels", opts.CPUBatchSize))
+	reference, err := benchmarkBatch(ctx, CPUProviderID(), opts.Scrypt, difficulty, opts.CPUBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to benchmark the reference check: %w", err)
+	}
+	report.ReferenceLabelsPerSecond = reference.LabelsPerSecond
+
+	checkedLabels := func(batchSize uint64) float64 {
+		switch opts.Verification.Mode {
+		case config.VerifyRandomLabels:
+			return math.Min(float64(opts.Verification.Labels+1), float64(batchSize))
+		case config.VerifyPercentage:
+			return math.Min(float64(batchSize)*opts.Verification.Percentage/100+1, float64(batchSize))
+		default:
+			return 1
+		}
+	}
+
+	for _, p := range providers {
+		batchSizes := opts.BatchSizes
+		if p.DeviceType == postrs.ClassCPU {
+			batchSizes = []uint64{opts.CPUBatchSize}
+		}
+
+		pr := ProviderReport{Provider: p}
+		for _, batchSize := range batchSizes {
+			logger.Info("benchmark: measuring provider",
+				zap.Uint("providerId", p.ID),
+				zap.String("model", p.Model),
+				zap.Uint64("batchSize", batchSize),
+			)
+			b, err := benchmarkBatch(ctx, p.ID, opts.Scrypt, difficulty, batchSize)
+			if err != nil {
+				return nil, fmt.Errorf("failed to benchmark provider %d: %w", p.ID, err)
+			}
+			pr.Batches = append(pr.Batches, b)
+
+			// a batch is checked on the CPU while the device computes the next one, the slower of both limits the rate
+			check := checkedLabels(batchSize) / report.ReferenceLabelsPerSecond
+			rate := float64(batchSize) / math.Max(b.Duration.Seconds(), check)
+			if rate > pr.LabelsPerSecond {
+				pr.LabelsPerSecond = rate
+				pr.BestBatchSize = batchSize
+			}
+		}
+		pr.ProjectedDuration = projectDuration(report.TotalLabels, pr.LabelsPerSecond)
+		report.Providers = append(report.Providers, pr)
+		report.LabelsPerSecond += pr.LabelsPerSecond
+	}
+
+	if opts.DiskDir != "" && opts.DiskBytes > 0 {
+		logger.Info("benchmark: measuring disk write throughput",
+			zap.String("dir", opts.DiskDir),
+			zap.Uint64("bytes", opts.DiskBytes),
+		)
+		report.DiskBytesPerSecond, err = benchmarkDisk(opts.DiskDir, opts.DiskBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to benchmark disk: %w", err)
+		}
+		diskLabelsPerSecond := report.DiskBytesPerSecond / float64(config.BytesPerLabel())
+		report.LabelsPerSecond = math.Min(report.LabelsPerSecond, diskLabelsPerSecond)
+	}
+
+	report.ProjectedDuration = projectDuration(report.TotalLabels, report.LabelsPerSecond)
+	return report, nil
+}
+
+// benchmarkBatch measures the duration of a call that computes batchSize labels on the given provider. A first
+// smaller call warms the provider up, e.g. to compile the kernel of a GPU.
+func benchmarkBatch(ctx context.Context, providerID uint, params config.ScryptParams, difficulty []byte, batchSize uint64) (BatchReport, error) {
+	wo, err := oracle.New(
+		oracle.WithProviderID(providerID),
+		oracle.WithCommitment(make([]byte, 32)),
+		oracle.WithScryptParams(params),
+		oracle.WithVRFDifficulty(difficulty),
+	)
+	if err != nil {
+		return BatchReport{}, err
+	}
+	defer wo.Close()
+
+	if _, err := wo.PositionsWithContext(ctx, 0, 0); err != nil {
+		return BatchReport{}, err
+	}
+
+	start := time.Now()
+	if _, err := wo.PositionsWithContext(ctx, 1, batchSize); err != nil {
+		return BatchReport{}, err
+	}
+	elapsed := time.Since(start)
+	return BatchReport{
+		BatchSize:       batchSize,
+		Duration:        elapsed,
+		LabelsPerSecond: float64(batchSize) / elapsed.Seconds(),
+	}, nil
+}
+
+// benchmarkDisk returns the bytes per second in which size bytes are written and synced to a file in dir.
+func benchmarkDisk(dir string, size uint64) (float64, error) {
+	if err := os.MkdirAll(dir, shared.OwnerReadWriteExec); err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(dir, "post-benchmark-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	chunk := make([]byte, 4*config.MiB)
+	start := time.Now()
+	for written := uint64(0); written < size; {
+		n := uint64(len(chunk))
+		if size-written < n {
+			n = size - written
+		}
+		if _, err := f.Write(chunk[:n]); err != nil {
+			return 0, err
+		}
+		written += n
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	return float64(size) / time.Since(start).Seconds(), nil
+}
+
+func projectDuration(labels uint64, labelsPerSecond float64) time.Duration {
+	if labelsPerSecond == 0 {
+		return 0
+	}
+	return time.Duration(float64(labels) / labelsPerSecond * float64(time.Second))
+}
@@ -1,9 +1,16 @@
 package initialization
 
 import (
+	"context"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
 )
 
 func TestBenchmark(t *testing.T) {
@@ -16,3 +23,84 @@ func TestBenchmark(t *testing.T) {
 		require.Greater(t, hashes, 0)
 	}
 }
+
+func TestBenchmarkProvider(t *testing.T) {
+	providers, err := OpenCLProviders()
+	require.NoError(t, err)
+
+	params := config.DefaultLabelParams()
+	params.N = 16
+	for _, p := range providers {
+		hashes, err := benchmarkProvider(context.Background(), p, params, make([]byte, 32))
+		require.NoError(t, err)
+		require.Greater(t, hashes, 0)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = benchmarkProvider(ctx, providers[0], params, make([]byte, 32))
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRunBenchmark(t *testing.T) {
+	r := require.New(t)
+
+	providers, err := OpenCLProviders()
+	r.NoError(err)
+
+	cfg := config.DefaultConfig()
+	opts := config.DefaultInitOpts()
+	opts.DataDir = t.TempDir()
+	opts.Scrypt.N = 16
+
+	benchOpts := DefaultBenchmarkOpts(cfg, opts)
+	benchOpts.BatchSizes = []uint64{1 << 8, 1 << 10}
+	benchOpts.CPUBatchSize = 1 << 6
+	benchOpts.DiskBytes = 1 * config.MiB
+
+	report, err := RunBenchmark(context.Background(), providers, benchOpts, zaptest.NewLogger(t))
+	r.NoError(err)
+	r.Equal(opts.Scrypt, report.Scrypt)
+	r.Equal(uint64(opts.NumUnits)*cfg.LabelsPerUnit, report.TotalLabels)
+	r.Greater(report.ReferenceLabelsPerSecond, 0.0)
+	r.Greater(report.DiskBytesPerSecond, 0.0)
+	r.Len(report.Providers, len(providers))
+
+	var labelsPerSecond float64
+	for _, p := range report.Providers {
+		if p.DeviceType == postrs.ClassCPU {
+			r.Len(p.Batches, 1)
+			r.Equal(benchOpts.CPUBatchSize, p.BestBatchSize)
+		} else {
+			r.Len(p.Batches, len(benchOpts.BatchSizes))
+			r.Contains(benchOpts.BatchSizes, p.BestBatchSize)
+		}
+		r.Greater(p.LabelsPerSecond, 0.0)
+		r.Greater(p.ProjectedDuration, time.Duration(0))
+		labelsPerSecond += p.LabelsPerSecond
+	}
+	r.LessOrEqual(report.LabelsPerSecond, labelsPerSecond)
+	r.Greater(report.ProjectedDuration, time.Duration(0))
+
+	// the benchmark file is removed
+	entries, err := os.ReadDir(opts.DataDir)
+	r.NoError(err)
+	r.Empty(entries)
+
+	// checking every label on the CPU limits every provider to the rate of the reference check, which overlaps with
+	// computing the next batch
+	benchOpts.Verification = config.VerificationPolicy{Mode: config.VerifyPercentage, Percentage: 100}
+	benchOpts.DiskDir = ""
+	checked, err := RunBenchmark(context.Background(), providers[:1], benchOpts, zaptest.NewLogger(t))
+	r.NoError(err)
+	r.Zero(checked.DiskBytesPerSecond)
+	r.LessOrEqual(checked.Providers[0].LabelsPerSecond, checked.ReferenceLabelsPerSecond)
+	for _, b := range checked.Providers[0].Batches {
+		if b.BatchSize == checked.Providers[0].BestBatchSize {
+			r.LessOrEqual(checked.Providers[0].LabelsPerSecond, b.LabelsPerSecond)
+		}
+	}
+
+	_, err = RunBenchmark(context.Background(), providers, BenchmarkOpts{Scrypt: opts.Scrypt}, nil)
+	r.Error(err)
+}
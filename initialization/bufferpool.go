@@ -0,0 +1,44 @@
+package initialization
+
+import (
+	"sync"
+)
+
+// bufferPool reuses the buffers labels are computed into, so that initialization doesn't allocate a new buffer for
+// every batch. Buffers are pooled by size: every device computes batches of its own size and only the last batch of
+// a file may be smaller.
+type bufferPool struct {
+	mtx   sync.Mutex
+	pools map[int]*sync.Pool
+}
+
+func newBufferPool() *bufferPool {
+	return &bufferPool{pools: make(map[int]*sync.Pool)}
+}
+
+// get returns a buffer of the given size. Its content is undefined. Buffers are handed out by pointer, so that
+// returning them to the pool doesn't allocate.
+func (p *bufferPool) get(size int) *[]byte {
+	if buf, ok := p.pool(size).Get().(*[]byte); ok {
+		return buf
+	}
+	buf := make([]byte, size)
+	return &buf
+}
+
+// put returns a buffer obtained from get to the pool. The buffer must not be used afterwards.
+func (p *bufferPool) put(buf *[]byte) {
+	p.pool(len(*buf)).Put(buf)
+}
+
+func (p *bufferPool) pool(size int) *sync.Pool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	pool, ok := p.pools[size]
+	if !ok {
+		pool = &sync.Pool{}
+		p.pools[size] = pool
+	}
+	return pool
+}
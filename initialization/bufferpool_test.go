@@ -0,0 +1,33 @@
+package initialization
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferPool(t *testing.T) {
+	r := require.New(t)
+	pool := newBufferPool()
+
+	buf := pool.get(64)
+	r.Len(*buf, 64)
+
+	// buffers of a different size aren't handed out
+	pool.put(buf)
+	r.Len(*pool.get(32), 32)
+
+	// a returned buffer is reused, the pool may drop some of them
+	reused := false
+	for i := 0; i < 10 && !reused; i++ {
+		pool.put(buf)
+		reused = pool.get(64) == buf
+	}
+	r.True(reused)
+
+	// returning a buffer doesn't allocate
+	allocs := testing.AllocsPerRun(100, func() {
+		pool.put(buf)
+	})
+	r.Zero(allocs)
+}
@@ -0,0 +1,207 @@
+package initialization
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/oracle"
+	"github.com/spacemeshos/post/persistence"
+	"github.com/spacemeshos/post/shared"
+)
+
+// LabelMismatch is a label on disk that doesn't match the label computed for its position.
+type LabelMismatch struct {
+	FileIndex int
+	Position  uint64 // absolute position of the label
+}
+
+// SampleReport is the result of verifying a random sample of labels on disk.
+type SampleReport struct {
+	NumSamples int
+	Mismatches []LabelMismatch
+}
+
+// FileIndices returns the indices of the files with at least one mismatching label.
+func (r *SampleReport) FileIndices() []int {
+	var indices []int
+	seen := make(map[int]bool)
+	for _, m := range r.Mismatches {
+		if !seen[m.FileIndex] {
+			seen[m.FileIndex] = true
+			indices = append(indices, m.FileIndex)
+		}
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// VerifySamples picks numSamples random labels from the initialized files, recomputes them with the CPU provider and
+// compares them with the labels on disk. Only labels that are already written are sampled.
+func (init *Initializer) VerifySamples(ctx context.Context, numSamples int) (*SampleReport, error) {
+	if !init.mtx.TryLock() {
+		return nil, ErrAlreadyInitializing
+	}
+	defer init.mtx.Unlock()
+
+	layout, err := deriveFilesLayout(init.cfg, init.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// collect the number of labels written to every file, so that samples can be spread evenly over all labels
+	type fileLabels struct {
+		index     int
+		numLabels uint64
+	}
+	var files []fileLabels
+	var totalLabels uint64
+	for i := layout.FirstFileIdx; i < layout.FirstFileIdx+int(layout.NumFiles); i++ {
+		info, err := init.storage.Stat(shared.InitFileName(i))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		n := shared.NumLabels(uint64(info.Size), config.BitsPerLabel)
+		if n == 0 {
+			continue
+		}
+		files = append(files, fileLabels{index: i, numLabels: n})
+		totalLabels += n
+	}
+
+	report := &SampleReport{}
+	if totalLabels == 0 {
+		return report, nil
+	}
+
+	wo, err := init.cpuOracle()
+	if err != nil {
+		return nil, err
+	}
+	defer wo.Close()
+
+	reader, err := init.LabelsReaderAt()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < numSamples; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// map a random label to the file it is in
+		n := uint64(rng.Int63n(int64(totalLabels)))
+		f := files[0]
+		for _, f = range files {
+			if n < f.numLabels {
+				break
+			}
+			n -= f.numLabels
+		}
+		position := firstLabelInFile(f.index, init.opts) + n
+
+		label, err := reader.ReadLabels(position, 1)
+		if err != nil {
+			return nil, err
+		}
+		expected, err := wo.PositionWithContext(ctx, position)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute label %d: %w", position, err)
+		}
+
+		report.NumSamples++
+		if !bytes.Equal(label, expected.Output) {
+			init.logger.Warn("initialization: label mismatch",
+				zap.Int("fileIndex", f.index),
+				zap.Uint64("position", position),
+			)
+			report.Mismatches = append(report.Mismatches, LabelMismatch{FileIndex: f.index, Position: position})
+		}
+	}
+
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		return report.Mismatches[i].Position < report.Mismatches[j].Position
+	})
+	return report, nil
+}
+
+// FixSamples regenerates the labels around the given mismatches. For every mismatch the batch of
+// `ComputeBatchSize` labels that contains it is repaired, since labels next to a corrupted one are likely to be
+// corrupted as well. Labels that aren't written yet are not touched.
+func (init *Initializer) FixSamples(ctx context.Context, mismatches []LabelMismatch) error {
+	layout, err := deriveFilesLayout(init.cfg, init.opts)
+	if err != nil {
+		return err
+	}
+	lastFileIndex := layout.FirstFileIdx + int(layout.NumFiles) - 1
+
+	batchSize := init.opts.ComputeBatchSize
+	ranges := make([]LabelRange, 0, len(mismatches))
+	added := make(map[uint64]bool)
+	for _, m := range mismatches {
+		if m.FileIndex < layout.FirstFileIdx || m.FileIndex > lastFileIndex {
+			return fmt.Errorf("file %d is not part of the layout", m.FileIndex)
+		}
+
+		// labels that are not written yet are left to the initialization
+		info, err := init.storage.Stat(shared.InitFileName(m.FileIndex))
+		if err != nil {
+			return err
+		}
+		fileNumLabels := shared.NumLabels(uint64(info.Size), config.BitsPerLabel)
+		fileStart := firstLabelInFile(m.FileIndex, init.opts)
+		if m.Position < fileStart || m.Position >= fileStart+fileNumLabels {
+			return fmt.Errorf("label %d is not written to file %d", m.Position, m.FileIndex)
+		}
+
+		start := fileStart + (m.Position-fileStart)/batchSize*batchSize
+		if added[start] {
+			continue
+		}
+		end := start + batchSize - 1
+		if fileEnd := fileStart + fileNumLabels - 1; end > fileEnd {
+			end = fileEnd
+		}
+		ranges = append(ranges, LabelRange{Start: start, End: end})
+		added[start] = true
+	}
+
+	return init.Repair(ctx, ranges)
+}
+
+// cpuOracle returns a work oracle that computes labels with the CPU provider.
+func (init *Initializer) cpuOracle(opts ...oracle.OptionFunc) (*oracle.WorkOracle, error) {
+	numLabels := uint64(init.opts.NumUnits) * init.cfg.LabelsPerUnit
+	return oracle.New(append([]oracle.OptionFunc{
+		oracle.WithProviderID(CPUProviderID()),
+		oracle.WithCommitment(init.commitment),
+		oracle.WithVRFDifficulty(init.powDifficultyFunc(numLabels)),
+		oracle.WithScryptParams(init.opts.Scrypt),
+		oracle.WithLogger(init.logger),
+	}, opts...)...)
+}
+
+// LabelsReaderAt returns a reader for the labels of the initialization at arbitrary positions, which are mapped to
+// files with the same layout the labels are written in.
+func (init *Initializer) LabelsReaderAt() (*persistence.LabelsReaderAt, error) {
+	return persistence.NewLabelsReaderAt(
+		init.storage,
+		init.opts.MaxFileNumLabels(),
+		init.opts.TotalLabels(init.cfg.LabelsPerUnit),
+		config.BitsPerLabel,
+	)
+}
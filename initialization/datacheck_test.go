@@ -0,0 +1,241 @@
+package initialization
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/persistence"
+	"github.com/spacemeshos/post/shared"
+)
+
+func initializeForDataCheck(t *testing.T) (*Initializer, config.InitOpts) {
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 12
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits + 1
+	opts.MaxFileSize = 1 << 14
+	opts.ProviderIDs = []uint{CPUProviderID()}
+	opts.ComputeBatchSize = 1 << 8
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+	return init, opts
+}
+
+func TestLabelsReaderAt(t *testing.T) {
+	r := require.New(t)
+	init, opts := initializeForDataCheck(t)
+
+	data, err := initData(opts.DataDir)
+	r.NoError(err)
+
+	reader, err := init.LabelsReaderAt()
+	r.NoError(err)
+	defer reader.Close()
+	r.Equal(uint64(len(data)/postrs.LabelLength), reader.NumLabels())
+
+	// a range across the boundary of the first two files
+	start := opts.MaxFileNumLabels() - 3
+	labels, err := reader.ReadLabels(start, 6)
+	r.NoError(err)
+	r.Equal(data[start*postrs.LabelLength:(start+6)*postrs.LabelLength], labels)
+
+	// the same labels through the metadata in the data directory
+	reader, err = persistence.OpenLabelsReaderAt(opts.DataDir, config.BitsPerLabel)
+	r.NoError(err)
+	defer reader.Close()
+	labels, err = reader.ReadLabels(start, 6)
+	r.NoError(err)
+	r.Equal(data[start*postrs.LabelLength:(start+6)*postrs.LabelLength], labels)
+}
+
+func TestVerifySamples(t *testing.T) {
+	r := require.New(t)
+	init, opts := initializeForDataCheck(t)
+
+	report, err := init.VerifySamples(context.Background(), 100)
+	r.NoError(err)
+	r.Equal(100, report.NumSamples)
+	r.Empty(report.Mismatches)
+
+	// overwrite file 1 with garbage
+	path := filepath.Join(opts.DataDir, shared.InitFileName(1))
+	info, err := os.Stat(path)
+	r.NoError(err)
+	r.NoError(os.WriteFile(path, make([]byte, info.Size()), shared.OwnerReadWrite))
+
+	report, err = init.VerifySamples(context.Background(), 100)
+	r.NoError(err)
+	r.NotEmpty(report.Mismatches)
+	r.Equal([]int{1}, report.FileIndices())
+	for _, m := range report.Mismatches {
+		r.GreaterOrEqual(m.Position, firstLabelInFile(1, opts))
+		r.Less(m.Position, firstLabelInFile(2, opts))
+	}
+}
+
+func TestFixSamples(t *testing.T) {
+	r := require.New(t)
+	init, opts := initializeForDataCheck(t)
+
+	expected, err := initData(opts.DataDir)
+	r.NoError(err)
+
+	// corrupt a few labels in the second batch of file 2
+	path := filepath.Join(opts.DataDir, shared.InitFileName(2))
+	data, err := os.ReadFile(path)
+	r.NoError(err)
+	relative := opts.ComputeBatchSize + 10
+	for i := relative; i < relative+5; i++ {
+		data[i*postrs.LabelLength] ^= 0xFF
+	}
+	r.NoError(os.WriteFile(path, data, shared.OwnerReadWrite))
+	r.NoError(init.updateChecksums(context.Background(), map[int]bool{2: true}))
+
+	position := firstLabelInFile(2, opts) + relative
+	r.NoError(init.FixSamples(context.Background(), []LabelMismatch{{FileIndex: 2, Position: position}}))
+
+	actual, err := initData(opts.DataDir)
+	r.NoError(err)
+	r.Equal(expected, actual)
+
+	// the checksum of the fixed file is updated
+	report, err := VerifyChecksums(context.Background(), opts.DataDir)
+	r.NoError(err)
+	r.True(report.OK())
+	r.Contains(report.Valid, 2)
+
+	// labels that aren't written can't be fixed
+	err = init.FixSamples(context.Background(), []LabelMismatch{{FileIndex: 2, Position: firstLabelInFile(3, opts)}})
+	r.Error(err)
+}
+
+func TestInitialize_MemStorage(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 12
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits + 1
+	opts.MaxFileSize = 1 << 14
+	opts.ProviderIDs = []uint{CPUProviderID()}
+	opts.ComputeBatchSize = 1 << 8
+
+	storage := persistence.NewMemStorage()
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		WithStorage(storage),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+	r.Equal(StatusCompleted, init.Status())
+
+	// labels are kept in the storage, only metadata and manifest are written to the data directory
+	files, err := storage.List()
+	r.NoError(err)
+	r.Len(files, int(opts.TotalFiles(cfg.LabelsPerUnit)))
+	numFiles, err := NewDiskState(opts.DataDir, config.BitsPerLabel).NumFilesWritten()
+	r.NoError(err)
+	r.Zero(numFiles)
+
+	report, err := VerifyStorageChecksums(context.Background(), opts.DataDir, storage)
+	r.NoError(err)
+	r.True(report.OK())
+	r.Len(report.Valid, len(files))
+
+	samples, err := init.VerifySamples(context.Background(), 100)
+	r.NoError(err)
+	r.Empty(samples.Mismatches)
+
+	r.NoError(init.Reset())
+	files, err = storage.List()
+	r.NoError(err)
+	r.Empty(files)
+}
+
+func TestInitialize_MultipleDataDirs(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 12
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.DataDirs = []string{t.TempDir(), t.TempDir()}
+	opts.NumUnits = cfg.MinNumUnits + 1
+	opts.MaxFileSize = 1 << 14
+	opts.ProviderIDs = []uint{CPUProviderID()}
+	opts.ComputeBatchSize = 1 << 8
+
+	newInitializer := func(opts config.InitOpts) *Initializer {
+		init, err := NewInitializer(
+			WithNodeId(nodeId),
+			WithCommitmentAtxId(commitmentAtxId),
+			WithConfig(cfg),
+			WithInitOpts(opts),
+			WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		)
+		r.NoError(err)
+		return init
+	}
+	init := newInitializer(opts)
+	r.NoError(init.Initialize(context.Background()))
+
+	// files are placed round robin and their locations are recorded in the metadata
+	numFiles := int(opts.TotalFiles(cfg.LabelsPerUnit))
+	m, err := LoadMetadata(opts.DataDir)
+	r.NoError(err)
+	r.Len(m.FileDirs, numFiles)
+	for i := 0; i < numFiles; i++ {
+		dir := opts.DataDirs[i%len(opts.DataDirs)]
+		r.Equal(dir, m.FileDirs[i])
+		r.FileExists(filepath.Join(dir, shared.InitFileName(i)))
+	}
+
+	// readers and the disk state follow the locations in the metadata of the data directory
+	data, err := initData(opts.DataDir)
+	r.NoError(err)
+	r.Len(data, int(opts.NumUnits)*int(cfg.LabelsPerUnit)*postrs.LabelLength)
+	numLabels, err := NewDiskState(opts.DataDir, config.BitsPerLabel).NumLabelsWritten()
+	r.NoError(err)
+	r.Equal(uint64(opts.NumUnits)*cfg.LabelsPerUnit, numLabels)
+
+	// the files are found without DataDirs as well
+	single := opts
+	single.DataDirs = nil
+	init = newInitializer(single)
+	r.Equal(StatusCompleted, init.Status())
+
+	r.NoError(init.Reset())
+	for _, dir := range opts.DataDirs {
+		entries, err := os.ReadDir(dir)
+		r.NoError(err)
+		r.Empty(entries)
+	}
+}
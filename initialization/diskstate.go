@@ -3,16 +3,40 @@ package initialization
 import (
 	"os"
 
+	"github.com/spacemeshos/post/persistence"
 	"github.com/spacemeshos/post/shared"
 )
 
 type DiskState struct {
 	datadir      string
+	storage      persistence.Storage
 	bitsPerLabel uint
 }
 
+// NewDiskState returns a DiskState of the initialization files of datadir. If the files are spread over multiple
+// directories they are found through the metadata in datadir.
 func NewDiskState(datadir string, bitsPerLabel uint) *DiskState {
-	return &DiskState{datadir, bitsPerLabel}
+	return &DiskState{datadir: datadir, bitsPerLabel: bitsPerLabel}
+}
+
+// NewStorageDiskState returns a DiskState of the initialization files in the given storage.
+func NewStorageDiskState(storage persistence.Storage, bitsPerLabel uint) *DiskState {
+	return &DiskState{storage: storage, bitsPerLabel: bitsPerLabel}
+}
+
+func (d *DiskState) getStorage() (persistence.Storage, error) {
+	if d.storage != nil {
+		return d.storage, nil
+	}
+	return persistence.OpenDataStorage(d.datadir)
+}
+
+func (d *DiskState) initFiles() ([]persistence.FileInfo, error) {
+	storage, err := d.getStorage()
+	if err != nil {
+		return nil, err
+	}
+	return listInitFiles(storage)
 }
 
 func (d *DiskState) NumLabelsWritten() (uint64, error) {
@@ -25,21 +49,21 @@ func (d *DiskState) NumLabelsWritten() (uint64, error) {
 }
 
 func (d *DiskState) NumBytesWritten() (uint64, error) {
-	files, err := GetFiles(d.datadir, shared.IsInitFile)
+	files, err := d.initFiles()
 	if err != nil {
 		return 0, err
 	}
 
 	var numBytesWritten uint64
 	for _, file := range files {
-		numBytesWritten += uint64(file.Size())
+		numBytesWritten += uint64(file.Size)
 	}
 
 	return numBytesWritten, nil
 }
 
 func (d *DiskState) NumFilesWritten() (int, error) {
-	files, err := GetFiles(d.datadir, shared.IsInitFile)
+	files, err := d.initFiles()
 	if err != nil {
 		return 0, err
 	}
@@ -47,6 +71,22 @@ func (d *DiskState) NumFilesWritten() (int, error) {
 	return len(files), err
 }
 
+// listInitFiles returns the initialization files of the given storage.
+func listInitFiles(storage persistence.Storage) ([]persistence.FileInfo, error) {
+	files, err := storage.List()
+	if err != nil {
+		return nil, err
+	}
+
+	includedFiles := make([]persistence.FileInfo, 0, len(files))
+	for _, file := range files {
+		if _, err := shared.ParseFileIndex(file.Name); err == nil {
+			includedFiles = append(includedFiles, file)
+		}
+	}
+	return includedFiles, nil
+}
+
 func GetFiles(dir string, predicate func(os.FileInfo) bool) ([]os.FileInfo, error) {
 	allFiles, err := os.ReadDir(dir)
 	if err != nil {
@@ -9,11 +9,12 @@ import (
 	"math"
 	"os"
 	"path/filepath"
-	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/spacemeshos/post/config"
 	"github.com/spacemeshos/post/internal/postrs"
@@ -30,6 +31,22 @@ type (
 	Provider            = postrs.Provider
 )
 
+// pipelineDepth is the number of computed batches per device that wait to be checked and written, while the device
+// computes the next one.
+const pipelineDepth = 1
+
+// maxPendingBatchesPerDevice limits the number of batches per device that are handed out but not yet written, and
+// with it the computed labels kept in memory. The pipeline of a device holds up to pipelineDepth+2 of them: one that
+// is computed, pipelineDepth that wait and one that is checked. The remaining one lets a device continue while its
+// last batch waits for a batch of a slower device before it in the same file.
+const maxPendingBatchesPerDevice = pipelineDepth + 3
+
+// labelOracle computes single labels to check the labels computed by a device. It is implemented by
+// oracle.WorkOracle.
+type labelOracle interface {
+	PositionWithContext(ctx context.Context, p uint64) (oracle.WorkOracleResult, error)
+}
+
 type Status int
 
 const (
@@ -62,6 +79,12 @@ type option struct {
 	logger            *Logger
 	powDifficultyFunc func(uint64) []byte
 	referenceOracle   *oracle.WorkOracle
+	progressHandler   func(Event)
+	healthPolicy      oracle.HealthPolicy
+	storage           persistence.Storage
+	freeSpace         func(dir string) (uint64, error)
+	openCLProviders   func() ([]Provider, error)
+	benchmark         func(ctx context.Context, p Provider, params config.ScryptParams, difficulty []byte) (int, error)
 }
 
 func (o *option) validate() error {
@@ -136,6 +159,42 @@ func WithLogger(logger *zap.Logger) OptionFunc {
 	}
 }
 
+// WithProgressHandler sets a handler that receives progress events of the initialization.
+// The handler is called synchronously, one event at a time, and should return quickly.
+func WithProgressHandler(handler func(Event)) OptionFunc {
+	return func(opts *option) error {
+		if handler == nil {
+			return errors.New("progress handler is nil")
+		}
+		opts.progressHandler = handler
+		return nil
+	}
+}
+
+// WithHealthPolicy sets the policy that determines when a provider is blacklisted. The labels a blacklisted provider
+// was working on are computed by the remaining providers instead.
+func WithHealthPolicy(policy oracle.HealthPolicy) OptionFunc {
+	return func(opts *option) error {
+		if policy.MaxFailures < 1 {
+			return fmt.Errorf("invalid `MaxFailures`; expected: >= 1, given: %v", policy.MaxFailures)
+		}
+		opts.healthPolicy = policy
+		return nil
+	}
+}
+
+// WithStorage sets the storage for the labels. By default they are stored in the data directory of the init options.
+// Metadata and the manifest are always stored in the data directory.
+func WithStorage(storage persistence.Storage) OptionFunc {
+	return func(opts *option) error {
+		if storage == nil {
+			return errors.New("storage is nil")
+		}
+		opts.storage = storage
+		return nil
+	}
+}
+
 // withDifficultyFunc sets the difficulty function for the initializer.
 // NOTE: This is an internal option for tests and should not be used by external packages.
 func withDifficultyFunc(powDifficultyFunc func(uint64) []byte) OptionFunc {
@@ -160,6 +219,31 @@ func withReferenceOracle(referenceOracle *oracle.WorkOracle) OptionFunc {
 	}
 }
 
+// withFreeSpace sets the function that determines the free space of a directory for the pre-flight checks.
+// NOTE: This is an internal option for tests and should not be used by external packages.
+func withFreeSpace(freeSpace func(dir string) (uint64, error)) OptionFunc {
+	return func(opts *option) error {
+		if freeSpace == nil {
+			return errors.New("free space function is nil")
+		}
+		opts.freeSpace = freeSpace
+		return nil
+	}
+}
+
+// withProviders sets the functions that list and benchmark the compute providers for the automatic selection.
+// NOTE: This is an internal option for tests and should not be used by external packages.
+func withProviders(openCLProviders func() ([]Provider, error), benchmark func(context.Context, Provider, config.ScryptParams, []byte) (int, error)) OptionFunc {
+	return func(opts *option) error {
+		if openCLProviders == nil || benchmark == nil {
+			return errors.New("provider functions are nil")
+		}
+		opts.openCLProviders = openCLProviders
+		opts.benchmark = benchmark
+		return nil
+	}
+}
+
 // Initializer is responsible for initializing a new PoST commitment.
 type Initializer struct {
 	nodeId          []byte
@@ -170,17 +254,26 @@ type Initializer struct {
 	cfg  Config
 	opts InitOpts
 
+	// nonceMtx guards nonceValue and the metadata file, which are shared by all devices.
+	nonceMtx     sync.Mutex
 	nonceValue   []byte
 	nonce        atomic.Pointer[uint64]
 	lastPosition atomic.Pointer[uint64]
 
-	numLabelsWritten atomic.Uint64
-	diskState        *DiskState
-	mtx              sync.RWMutex
+	progress     *progressTracker
+	verification verificationCounters
+	health       *oracle.HealthTracker
+	storage      persistence.Storage
+	diskState    *DiskState
+	mtx          sync.RWMutex
 
 	logger            *Logger
 	referenceOracle   *oracle.WorkOracle
+	referenceMtx      sync.Mutex // the reference oracle is shared by all devices
 	powDifficultyFunc func(uint64) []byte
+	freeSpace         func(dir string) (uint64, error)
+	openCLProviders   func() ([]Provider, error)
+	benchmark         func(ctx context.Context, p Provider, params config.ScryptParams, difficulty []byte) (int, error)
 }
 
 func NewInitializer(opts ...OptionFunc) (*Initializer, error) {
@@ -188,6 +281,10 @@ func NewInitializer(opts ...OptionFunc) (*Initializer, error) {
 		logger: zap.NewNop(),
 
 		powDifficultyFunc: shared.PowDifficulty,
+		healthPolicy:      oracle.DefaultHealthPolicy(),
+		freeSpace:         persistence.FreeSpace,
+		openCLProviders:   OpenCLProviders,
+		benchmark:         benchmarkProvider,
 	}
 
 	for _, opt := range opts {
@@ -206,11 +303,22 @@ func NewInitializer(opts ...OptionFunc) (*Initializer, error) {
 		nodeId:            options.nodeId,
 		commitmentAtxId:   options.commitmentAtxId,
 		commitment:        options.commitment,
-		diskState:         NewDiskState(options.initOpts.DataDir, uint(config.BitsPerLabel)),
+		progress:          newProgressTracker(options.progressHandler),
+		health:            oracle.NewHealthTracker(options.healthPolicy),
 		logger:            options.logger,
 		powDifficultyFunc: options.powDifficultyFunc,
 		referenceOracle:   options.referenceOracle,
+		freeSpace:         options.freeSpace,
+		openCLProviders:   options.openCLProviders,
+		benchmark:         options.benchmark,
+	}
+
+	storage, err := init.newStorage(options.storage)
+	if err != nil {
+		return nil, err
 	}
+	init.storage = storage
+	init.diskState = NewStorageDiskState(storage, uint(config.BitsPerLabel))
 
 	numLabelsWritten, err := init.diskState.NumLabelsWritten()
 	if err != nil {
@@ -226,6 +334,7 @@ func NewInitializer(opts ...OptionFunc) (*Initializer, error) {
 			return nil, err
 		}
 		init.nonce.Store(m.Nonce)
+		init.nonceValue = m.NonceValue
 		init.lastPosition.Store(m.LastPosition)
 	}
 
@@ -236,6 +345,51 @@ func NewInitializer(opts ...OptionFunc) (*Initializer, error) {
 	return init, nil
 }
 
+// newStorage returns the storage of the label files. If they are spread over multiple directories, either because
+// DataDirs is set or because the metadata records it, the locations of existing files are taken from the metadata
+// and the location of every new file is written to the metadata before the file is created.
+func (init *Initializer) newStorage(storage persistence.Storage) (persistence.Storage, error) {
+	if storage != nil {
+		if len(init.opts.DataDirs) > 0 {
+			return nil, errors.New("`DataDirs` can't be used with a custom storage")
+		}
+		return storage, nil
+	}
+
+	locations := make(map[string]string)
+	m, err := LoadMetadata(init.opts.DataDir)
+	switch {
+	case err == nil:
+		for index, dir := range m.FileDirs {
+			locations[shared.InitFileName(index)] = dir
+		}
+	case len(init.opts.DataDirs) > 0 && !errors.Is(err, ErrStateMetadataFileMissing):
+		return nil, fmt.Errorf("failed to load locations of files: %w", err)
+	}
+
+	if len(init.opts.DataDirs) == 0 && len(locations) == 0 {
+		return persistence.NewDirStorage(init.opts.DataDir), nil
+	}
+
+	dirs := init.opts.DataDirs
+	if len(dirs) == 0 {
+		dirs = []string{init.opts.DataDir}
+	}
+	placement, err := persistence.PlacementOf(init.opts.Placement)
+	if err != nil {
+		return nil, err
+	}
+	return persistence.NewMultiDirStorage(dirs,
+		persistence.WithPlacement(placement),
+		persistence.WithFileSize(init.opts.MaxFileSize),
+		persistence.WithLocations(locations),
+		persistence.WithPlacementHandler(func(name, dir string) error {
+			init.logger.Info("initialization: placing file", zap.String("fileName", name), zap.String("dir", dir))
+			return init.saveMetadata()
+		}),
+	)
+}
+
 // Initialize is the process in which the prover commits to store some data, by having its storage filled with
 // pseudo-random data with respect to a specific id. This data is the result of a computationally-expensive operation.
 func (init *Initializer) Initialize(ctx context.Context) error {
@@ -265,51 +419,62 @@ func (init *Initializer) Initialize(ctx context.Context) error {
 		zap.Int("firstFileIndex", layout.FirstFileIdx),
 		zap.Int("lastFileIndex", lastFileIndex),
 	)
-	if err := removeRedundantFiles(init.cfg, init.opts, init.logger); err != nil {
+	if err := removeRedundantFiles(init.cfg, init.opts, init.storage, init.logger); err != nil {
 		return err
 	}
 
-	numLabels := uint64(init.opts.NumUnits) * init.cfg.LabelsPerUnit
-	difficulty := init.powDifficultyFunc(numLabels)
-	batchSize := init.opts.ComputeBatchSize
-	u64, err := strconv.ParseUint(init.opts.ProviderID, 10, 32)
-	wo, err := oracle.New(
-		oracle.WithProviderID((uint)(u64)),
-		oracle.WithCommitment(init.commitment),
-		oracle.WithVRFDifficulty(difficulty),
-		oracle.WithScryptParams(init.opts.Scrypt),
-		oracle.WithLogger(init.logger),
-	)
+	providerIDs, err := init.opts.SelectedProviderIDs()
 	if err != nil {
 		return err
 	}
-	defer wo.Close()
+	if len(providerIDs) == 0 {
+		id, err := init.selectProvider(ctx)
+		if err != nil {
+			return err
+		}
+		providerIDs = []uint{id}
+	}
 
-	woReference := init.referenceOracle
-	if woReference == nil {
-		woReference, err = oracle.New(
-			oracle.WithProviderID(CPUProviderID()),
+	if err := init.preflight(layout); err != nil {
+		return err
+	}
+
+	numLabels := uint64(init.opts.NumUnits) * init.cfg.LabelsPerUnit
+	difficulty := init.powDifficultyFunc(numLabels)
+
+	oracles := make([]*oracle.WorkOracle, 0, len(providerIDs))
+	for _, id := range providerIDs {
+		wo, err := oracle.New(
+			oracle.WithProviderID(id),
 			oracle.WithCommitment(init.commitment),
 			oracle.WithVRFDifficulty(difficulty),
 			oracle.WithScryptParams(init.opts.Scrypt),
 			oracle.WithLogger(init.logger),
+			oracle.WithHealthTracker(init.health),
 		)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to create work oracle for provider %d: %w", id, err)
 		}
-		defer woReference.Close()
+		defer wo.Close()
+		oracles = append(oracles, wo)
 	}
 
-	for i := layout.FirstFileIdx; i <= lastFileIndex; i++ {
-		fileOffset := uint64(i) * layout.FileNumLabels
-		fileNumLabels := layout.FileNumLabels
-		if i == lastFileIndex {
-			fileNumLabels = layout.LastFileNumLabels
-		}
+	batchSizes, err := init.tuneBatchSizes(ctx, oracles)
+	if err != nil {
+		return err
+	}
 
-		if err := init.initFile(ctx, wo, woReference, i, batchSize, fileOffset, fileNumLabels, difficulty); err != nil {
+	woReference := init.referenceOracle
+	if woReference == nil {
+		woReference, err = init.cpuOracle()
+		if err != nil {
 			return err
 		}
+		defer woReference.Close()
+	}
+
+	if err := init.initFiles(ctx, oracles, woReference, layout, batchSizes); err != nil {
+		return err
 	}
 
 	if init.nonce.Load() != nil {
@@ -324,8 +489,44 @@ func (init *Initializer) Initialize(ctx context.Context) error {
 
 	// continue searching for a nonce
 	defer init.saveMetadata()
+	return init.searchNonce(ctx, oracles, batchSizes)
+}
+
+// searchNonce computes labels after the last position until a nonce is found. The labels are computed by the first
+// healthy oracle; if all devices are given up the CPU takes over, unless it was one of the devices.
+func (init *Initializer) searchNonce(ctx context.Context, oracles []*oracle.WorkOracle, batchSizes map[uint]uint64) error {
+	var woCPU *oracle.WorkOracle
+	defer func() {
+		if woCPU != nil {
+			woCPU.Close()
+		}
+	}()
+
+	nonceOracle := func() (*oracle.WorkOracle, error) {
+		for _, wo := range oracles {
+			if init.health.Healthy(wo.ProviderID()) {
+				return wo, nil
+			}
+		}
+		if woCPU == nil {
+			if !init.cpuFallbackAvailable(oracles) {
+				return nil, errors.New("no nonce found: all devices failed")
+			}
+			init.logger.Warn("initialization: all devices failed, falling back to the CPU to search for a nonce")
+
+			var err error
+			if woCPU, err = init.cpuOracle(oracle.WithHealthTracker(init.health)); err != nil {
+				return nil, err
+			}
+		}
+		if !init.health.Healthy(woCPU.ProviderID()) {
+			return nil, errors.New("no nonce found: all devices failed")
+		}
+		return woCPU, nil
+	}
 
-	for i := *init.lastPosition.Load(); i < math.MaxUint64; i += batchSize {
+	var buf []byte
+	for i := *init.lastPosition.Load(); i < math.MaxUint64; {
 		lastPos := i
 		init.lastPosition.Store(&lastPos)
 
@@ -337,14 +538,39 @@ func (init *Initializer) Initialize(ctx context.Context) error {
 			// continue looking for a nonce
 		}
 
+		wo, err := nonceOracle()
+		if err != nil {
+			return err
+		}
+		batchSize, ok := batchSizes[wo.ProviderID()]
+		if !ok {
+			batchSize = init.opts.ComputeBatchSize
+		}
+		if n := batchSize * postrs.LabelLength; uint64(len(buf)) != n {
+			buf = make([]byte, n)
+		}
+
 		init.logger.Debug("initialization: continue looking for a nonce",
+			zap.Uint("providerID", wo.ProviderID()),
 			zap.Uint64("startPosition", i),
 			zap.Uint64("batchSize", batchSize),
 		)
 
-		res, err := wo.Positions(i, i+batchSize-1)
-		if err != nil {
+		res, err := wo.PositionsIntoWithContext(ctx, i, i+batchSize-1, buf)
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			init.logger.Info("initialization: stopped")
 			return err
+		case errors.Is(err, oracle.ErrProviderUnhealthy):
+			continue
+		case err != nil:
+			// the batch is computed again, by another device once this one is blacklisted
+			init.logger.Error("initialization: device failed while looking for a nonce",
+				zap.Uint("providerID", wo.ProviderID()),
+				zap.Uint64("startPosition", i),
+				zap.Error(err),
+			)
+			continue
 		}
 		if res.Nonce != nil {
 			init.logger.Debug("initialization: found nonce",
@@ -352,36 +578,421 @@ func (init *Initializer) Initialize(ctx context.Context) error {
 			)
 
 			init.nonce.Store(res.Nonce)
+			init.progress.emit(Event{Kind: EventNonceFound, ProviderID: wo.ProviderID(), Nonce: *res.Nonce})
 			return nil
 		}
+		i += batchSize
 	}
 
 	return fmt.Errorf("no nonce found")
 }
 
-func removeRedundantFiles(cfg config.Config, opts config.InitOpts, logger *zap.Logger) error {
-	// Go over all postdata_N.bin files in the data directory and remove the ones that are not needed.
+// initFiles initializes all files of the given layout using the given work oracles. Batches of labels are handed
+// out by a scheduler to whichever oracle becomes free, so faster devices compute more labels than slower ones. Every
+// oracle computes batches of its size in batchSizes, or ComputeBatchSize if it has none.
+// Every device computes the next batch while the previous ones are checked and written.
+// If a device fails the batch it was working on is handed to the remaining devices. A device is given up once the
+// health tracker blacklists it; if all devices are given up the CPU takes over the remaining work, unless it was one
+// of the devices. initFiles only fails if no device is left.
+func (init *Initializer) initFiles(ctx context.Context, oracles []*oracle.WorkOracle, woReference labelOracle, layout filesLayout, batchSizes map[uint]uint64) error {
+	s, numLabelsWritten, err := newScheduler(init.storage, layout, maxPendingBatchesPerDevice*len(oracles), init.logger)
+	if err != nil {
+		return err
+	}
+	s.onWrite = func(fileIndex int, numLabels uint64) {
+		init.progress.record(numLabels)
+		init.progress.emit(Event{Kind: EventLabelsWritten, FileIndex: fileIndex, NumLabels: numLabels})
+	}
+
+	// Files that are written to don't match their checksum until they are completed again.
+	manifest, err := LoadManifest(init.opts.DataDir)
+	if err != nil {
+		return err
+	}
+	for _, f := range s.files {
+		delete(manifest.Files, f.index)
+	}
+	maxFileIndex := init.opts.TotalFiles(init.cfg.LabelsPerUnit) - 1
+	for index := range manifest.Files {
+		if index > maxFileIndex {
+			delete(manifest.Files, index)
+		}
+	}
+	if err := SaveManifest(init.opts.DataDir, manifest); err != nil {
+		return err
+	}
+
+	var manifestMtx sync.Mutex
+	s.onFileCompleted = func(fileIndex int, checksum FileChecksum) {
+		manifestMtx.Lock()
+		manifest.Files[fileIndex] = checksum
+		if err := SaveManifest(init.opts.DataDir, manifest); err != nil {
+			init.logger.Error("initialization: failed to save manifest", zap.Int("fileIndex", fileIndex), zap.Error(err))
+		}
+		manifestMtx.Unlock()
+
+		init.progress.emit(Event{Kind: EventFileCompleted, FileIndex: fileIndex})
+	}
+
+	lastFileIndex := layout.FirstFileIdx + int(layout.NumFiles) - 1
+	target := firstLabelInFile(lastFileIndex, init.opts) + layout.LastFileNumLabels
+	init.progress.start(firstLabelInFile(layout.FirstFileIdx, init.opts)+numLabelsWritten, target)
+
+	buffers := newBufferPool()
+	s.release = buffers.put
+
+	var mtx sync.Mutex
+	var lastErr error
+	deviceFailed := func(wo *oracle.WorkOracle, b batch, err error) {
+		init.logger.Error("initialization: device failed, rescheduling its work",
+			zap.Uint("providerID", wo.ProviderID()),
+			zap.Int("fileIndex", b.file.index),
+			zap.Uint64("startPosition", b.start),
+			zap.Error(err),
+		)
+		s.reschedule(b)
+		init.verification.rescheduled.Add(1)
+		init.progress.emit(Event{
+			Kind:       EventDeviceFailed,
+			FileIndex:  b.file.index,
+			ProviderID: wo.ProviderID(),
+			Err:        err,
+		})
+
+		mtx.Lock()
+		lastErr = err
+		mtx.Unlock()
+	}
+
+	// work runs a pipeline for a device: while a computed batch is checked against the reference oracle and written
+	// to its file, the device already computes the next one. Up to pipelineDepth computed batches wait to be checked.
+	work := func(ctx context.Context, wo *oracle.WorkOracle) error {
+		batchSize, ok := batchSizes[wo.ProviderID()]
+		if !ok {
+			batchSize = init.opts.ComputeBatchSize
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		computed := make(chan computedBatch, pipelineDepth)
+
+		var eg errgroup.Group
+		eg.Go(func() error {
+			defer close(computed)
+			for {
+				if !init.health.Healthy(wo.ProviderID()) {
+					init.logger.Warn("initialization: device is blacklisted, giving it up",
+						zap.Uint("providerID", wo.ProviderID()),
+					)
+					return nil
+				}
+
+				b, ok, err := s.next(ctx, batchSize)
+				switch {
+				case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+					init.logger.Info("initialization: stopped")
+					return err
+				case err != nil:
+					return err
+				case !ok:
+					return nil
+				}
+
+				buf := buffers.get(int(b.numLabels()) * postrs.LabelLength)
+				cb, err := init.computeBatch(ctx, wo, b, buf)
+				if err != nil {
+					buffers.put(buf)
+				}
+				switch {
+				case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+					s.reschedule(b)
+					init.logger.Info("initialization: stopped")
+					return err
+				case errors.Is(err, oracle.ErrProviderUnhealthy):
+					// the device was blacklisted while checking a previous batch
+					s.reschedule(b)
+					continue
+				case err != nil:
+					deviceFailed(wo, b, err)
+					continue
+				}
+
+				select {
+				case computed <- cb:
+				case <-ctx.Done():
+					s.reschedule(b)
+					buffers.put(buf)
+					return ctx.Err()
+				}
+			}
+		})
+
+		// The batch that made the consumer fail is the cause, the producer only stops because of it.
+		err := func() error {
+			defer func() {
+				// Stop computing and hand the computed batches that won't be checked back. Otherwise they would
+				// never be written and block all batches after them.
+				cancel()
+				for cb := range computed {
+					s.reschedule(cb.batch)
+					buffers.put(cb.buf)
+				}
+			}()
+
+			for cb := range computed {
+				if !init.health.Healthy(wo.ProviderID()) {
+					// the labels of a blacklisted device aren't trusted, its remaining batches are computed again
+					s.reschedule(cb.batch)
+					buffers.put(cb.buf)
+					continue
+				}
+
+				// the scheduler releases the buffer once the labels are written
+				output, err := init.checkBatchWithRetries(ctx, wo, woReference, cb)
+				if err != nil {
+					buffers.put(cb.buf)
+				}
+				switch {
+				case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+					s.reschedule(cb.batch)
+					return err
+				case errors.Is(err, errReferenceFailed):
+					s.reschedule(cb.batch)
+					return err
+				case err != nil:
+					deviceFailed(wo, cb.batch, err)
+					continue
+				}
+				init.progress.emit(Event{
+					Kind:            EventBatchComputed,
+					FileIndex:       cb.file.index,
+					ProviderID:      wo.ProviderID(),
+					NumLabels:       cb.numLabels(),
+					LabelsPerSecond: float64(cb.numLabels()) / cb.duration.Seconds(),
+				})
+
+				if err := s.complete(cb.batch, output); err != nil {
+					return err
+				}
+			}
+			return nil
+		}()
+		if producerErr := eg.Wait(); err == nil {
+			err = producerErr
+		}
+		return err
+	}
+
+	// a fatal error of one device stops all of them, the work of the others could never be written
+	eg, egCtx := errgroup.WithContext(ctx)
+	for _, wo := range oracles {
+		wo := wo
+		eg.Go(func() error { return work(egCtx, wo) })
+	}
+	err = eg.Wait()
+
+	if err == nil && s.remaining > 0 && init.cpuFallbackAvailable(oracles) {
+		init.logger.Warn("initialization: all devices failed, falling back to the CPU",
+			zap.Int("remainingFiles", s.remaining),
+		)
+		err = init.initFilesOnCPU(ctx, work)
+	}
+
+	if cErr := s.close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	if s.remaining > 0 {
+		return fmt.Errorf("initialization failed on all devices: %w", lastErr)
+	}
+	return nil
+}
+
+// cpuFallbackAvailable returns true if the CPU can take over the work of the given oracles, i.e. if it isn't one of
+// them and isn't blacklisted.
+func (init *Initializer) cpuFallbackAvailable(oracles []*oracle.WorkOracle) bool {
+	for _, wo := range oracles {
+		if wo.ProviderID() == CPUProviderID() {
+			return false
+		}
+	}
+	return init.health.Healthy(CPUProviderID())
+}
+
+func (init *Initializer) initFilesOnCPU(ctx context.Context, work func(context.Context, *oracle.WorkOracle) error) error {
+	wo, err := init.cpuOracle(oracle.WithHealthTracker(init.health))
+	if err != nil {
+		return err
+	}
+	defer wo.Close()
+	return work(ctx, wo)
+}
+
+// computedBatch is a batch computed by a device that waits to be checked and written.
+type computedBatch struct {
+	batch
+	result oracle.WorkOracleResult
+	// buf is the pooled buffer result.Output is computed into.
+	buf *[]byte
+	// duration is the time the device spent computing the batch.
+	duration time.Duration
+}
+
+// computeBatch computes the labels of a batch into buf, which must hold all labels of the batch.
+func (init *Initializer) computeBatch(ctx context.Context, wo *oracle.WorkOracle, b batch, buf *[]byte) (computedBatch, error) {
+	init.logger.Debug("initialization: status",
+		zap.Uint("providerID", wo.ProviderID()),
+		zap.Int("fileIndex", b.file.index),
+		zap.Uint64("startPosition", b.start),
+		zap.Uint64("endPosition", b.end),
+	)
+
+	start := time.Now()
+	res, err := wo.PositionsIntoWithContext(ctx, b.start, b.end, *buf)
+	if err != nil {
+		return computedBatch{}, fmt.Errorf("failed to compute labels: %w", err)
+	}
+	return computedBatch{batch: b, result: res, buf: buf, duration: time.Since(start)}, nil
+}
+
+// checkBatchWithRetries checks the labels of a computed batch. If they fail verification they are computed again on
+// the same device into the same buffer, up to the number of retries of the verification policy. It returns the
+// buffer that holds the labels that passed.
+func (init *Initializer) checkBatchWithRetries(ctx context.Context, wo *oracle.WorkOracle, woReference labelOracle, cb computedBatch) (*[]byte, error) {
+	err := init.checkBatch(ctx, wo, woReference, cb)
+	for retry := 1; retry <= init.opts.Verification.MaxRetries; retry++ {
+		var mismatch ErrReferenceLabelMismatch
+		if !errors.As(err, &mismatch) || !init.health.Healthy(wo.ProviderID()) {
+			break
+		}
+
+		init.logger.Warn("initialization: labels failed verification, computing them again",
+			zap.Uint("providerID", wo.ProviderID()),
+			zap.Int("fileIndex", cb.file.index),
+			zap.Uint64("startPosition", cb.start),
+			zap.Int("retry", retry),
+			zap.Error(err),
+		)
+		init.verification.retries.Add(1)
+
+		// the device may be computing the next batch at the same time, the calls are interleaved chunk by chunk
+		duration := cb.duration
+		if cb, err = init.computeBatch(ctx, wo, cb.batch, cb.buf); err != nil {
+			return nil, err
+		}
+		cb.duration += duration
+		err = init.checkBatch(ctx, wo, woReference, cb)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cb.buf, nil
+}
+
+// checkBatch checks the labels of a computed batch against the reference oracle according to the verification policy
+// and records the nonce found in the batch, if any.
+func (init *Initializer) checkBatch(ctx context.Context, wo *oracle.WorkOracle, woReference labelOracle, cb computedBatch) error {
+	res, b := cb.result, cb.batch
+	for _, p := range verificationPositions(init.opts.Verification, b) {
+		init.referenceMtx.Lock()
+		reference, err := woReference.PositionWithContext(ctx, p)
+		init.referenceMtx.Unlock()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", errReferenceFailed, err)
+		}
+		init.verification.labelsChecked.Add(1)
+
+		label := res.Output[(p-b.start)*postrs.LabelLength:]
+		label = label[:postrs.LabelLength]
+		if !bytes.Equal(label, reference.Output) {
+			init.verification.mismatches.Add(1)
+			init.health.RecordMismatch(wo.ProviderID())
+			err := ErrReferenceLabelMismatch{
+				Index:      p,
+				Commitment: init.commitment,
+				Expected:   reference.Output,
+				Actual:     append([]byte(nil), label...), // the buffer is reused
+			}
+			init.progress.emit(Event{
+				Kind:       EventLabelMismatch,
+				FileIndex:  b.file.index,
+				ProviderID: wo.ProviderID(),
+				Err:        err,
+			})
+			return err
+		}
+	}
+
+	if res.Nonce != nil {
+		candidate := res.Output[(*res.Nonce-b.start)*postrs.LabelLength:]
+		candidate = candidate[:postrs.LabelLength]
+		init.updateNonce(wo.ProviderID(), *res.Nonce, candidate, b.file.index)
+	}
+	return nil
+}
+
+// DeviceHealth returns the health of the providers used by the initializer.
+func (init *Initializer) DeviceHealth() []oracle.DeviceHealth {
+	return init.health.Devices()
+}
+
+// updateNonce stores the given nonce if its value is lower than the one of the current nonce.
+func (init *Initializer) updateNonce(providerID uint, nonce uint64, value []byte, fileIndex int) {
+	fields := []zap.Field{
+		zap.Int("fileIndex", fileIndex),
+		zap.Uint64("nonce", nonce),
+		zap.String("value", hex.EncodeToString(value)),
+	}
+	init.logger.Debug("initialization: found nonce", fields...)
+
+	init.nonceMtx.Lock()
+	defer init.nonceMtx.Unlock()
+
+	if init.nonceValue != nil && bytes.Compare(value, init.nonceValue) >= 0 {
+		return
+	}
+
+	nonceValue := make([]byte, postrs.LabelLength)
+	copy(nonceValue, value)
+
+	init.logger.Info("initialization: found new best nonce", fields...)
+	init.nonceValue = nonceValue
+	init.nonce.Store(&nonce)
+	if err := init.saveMetadataLocked(); err != nil {
+		init.logger.Error("initialization: failed to save metadata", zap.Error(err))
+	}
+	init.progress.emit(Event{Kind: EventNonceFound, FileIndex: fileIndex, ProviderID: providerID, Nonce: nonce})
+}
+
+func removeRedundantFiles(cfg config.Config, opts config.InitOpts, storage persistence.Storage, logger *zap.Logger) error {
+	// Go over all postdata_N.bin files in the storage and remove the ones that are not needed.
 	// The files with indices from 0 to init.opts.TotalFiles(init.cfg.LabelsPerUnit) - 1 are preserved.
 	// The rest are redundant and can be removed.
 	maxFileIndex := opts.TotalFiles(cfg.LabelsPerUnit) - 1
 	logger.Debug("attempting to remove redundant files above index", zap.Int("maxFileIndex", maxFileIndex))
 
-	files, err := os.ReadDir(opts.DataDir)
+	files, err := storage.List()
 	if err != nil {
 		return err
 	}
 	for _, file := range files {
-		name := file.Name()
+		name := file.Name
 		fileIndex, err := shared.ParseFileIndex(name)
-		if err != nil && name != metadataFileName {
-			logger.Warn("found unrecognized file", zap.String("fileName", name))
+		if err != nil {
+			if !isStateFile(name) {
+				logger.Warn("found unrecognized file", zap.String("fileName", name))
+			}
 			continue
 		}
 		if fileIndex > maxFileIndex {
 			logger.Info("removing redundant file", zap.String("fileName", name))
-			path := filepath.Join(opts.DataDir, name)
-			if err := os.Remove(path); err != nil {
-				return fmt.Errorf("failed to delete file (%v): %w", path, err)
+			if err := storage.Remove(name); err != nil {
+				return fmt.Errorf("failed to delete file (%v): %w", name, err)
 			}
 		}
 	}
@@ -389,7 +1000,17 @@ func removeRedundantFiles(cfg config.Config, opts config.InitOpts, logger *zap.L
 }
 
 func (init *Initializer) NumLabelsWritten() uint64 {
-	return init.numLabelsWritten.Load()
+	return init.progress.progress().NumLabelsWritten
+}
+
+// VerificationStats returns counters of the verification of computed labels.
+func (init *Initializer) VerificationStats() VerificationStats {
+	return init.verification.stats()
+}
+
+// Progress returns the current progress of the initialization, including an estimate of the remaining time.
+func (init *Initializer) Progress() Progress {
+	return init.progress.progress()
 }
 
 func (init *Initializer) Nonce() *uint64 {
@@ -402,19 +1023,23 @@ func (init *Initializer) Reset() error {
 	}
 	defer init.mtx.Unlock()
 
-	files, err := os.ReadDir(init.opts.DataDir)
+	files, err := listInitFiles(init.storage)
 	if err != nil {
 		return err
 	}
-
 	for _, file := range files {
-		info, err := file.Info()
-		if err != nil {
-			continue
+		if err := init.storage.Remove(file.Name); err != nil {
+			return fmt.Errorf("failed to delete file (%v): %w", file.Name, err)
 		}
-		name := file.Name()
-		if shared.IsInitFile(info) || name == metadataFileName {
-			path := filepath.Join(init.opts.DataDir, name)
+	}
+
+	stateFiles, err := os.ReadDir(init.opts.DataDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range stateFiles {
+		if isStateFile(file.Name()) {
+			path := filepath.Join(init.opts.DataDir, file.Name())
 			if err := os.Remove(path); err != nil {
 				return fmt.Errorf("failed to delete file (%v): %w", path, err)
 			}
@@ -447,142 +1072,6 @@ func (init *Initializer) Status() Status {
 	return StatusNotStarted
 }
 
-func (init *Initializer) initFile(ctx context.Context, wo, woReference *oracle.WorkOracle, fileIndex int, batchSize, fileOffset, fileNumLabels uint64, difficulty []byte) error {
-	fileTargetPosition := fileOffset + fileNumLabels
-
-	// Initialize the labels file writer.
-	writer, err := persistence.NewLabelsWriter(init.opts.DataDir, fileIndex, config.BitsPerLabel)
-	if err != nil {
-		return err
-	}
-	defer writer.Close()
-
-	numLabelsWritten, err := writer.NumLabelsWritten()
-	if err != nil {
-		return err
-	}
-
-	fields := []zap.Field{
-		zap.Int("fileIndex", fileIndex),
-		zap.Uint64("currentNumLabels", numLabelsWritten),
-		zap.Uint64("targetNumLabels", fileNumLabels),
-		zap.Uint64("startPosition", fileOffset),
-	}
-
-	switch {
-	case numLabelsWritten == fileNumLabels:
-		init.logger.Info("initialization: file already initialized", fields...)
-		init.numLabelsWritten.Store(fileTargetPosition)
-		return nil
-
-	case numLabelsWritten > fileNumLabels:
-		init.logger.Info("initialization: truncating file")
-		if err := writer.Truncate(fileNumLabels); err != nil {
-			return err
-		}
-		init.numLabelsWritten.Store(fileTargetPosition)
-		return nil
-
-	case numLabelsWritten > 0:
-		init.logger.Info("initialization: continuing to write file", fields...)
-
-	default:
-		init.logger.Info("initialization: starting to write file", fields...)
-	}
-
-	for currentPosition := numLabelsWritten; currentPosition < fileNumLabels; currentPosition += batchSize {
-		select {
-		case <-ctx.Done():
-			init.logger.Info("initialization: stopped")
-			if err := writer.Flush(); err != nil {
-				return err
-			}
-			return ctx.Err()
-		default:
-			// continue initialization
-		}
-
-		// The last batch might need to be smaller.
-		remaining := fileNumLabels - currentPosition
-		if remaining < batchSize {
-			batchSize = remaining
-		}
-
-		init.logger.Debug("initialization: status",
-			zap.Int("fileIndex", fileIndex),
-			zap.Uint64("currentPosition", currentPosition),
-			zap.Uint64("remaining", remaining),
-		)
-
-		// Calculate labels of the batch position range.
-		startPosition := fileOffset + currentPosition
-		endPosition := startPosition + uint64(batchSize) - 1
-
-		res, err := wo.Positions(startPosition, endPosition)
-		if err != nil {
-			return fmt.Errorf("failed to compute labels: %w", err)
-		}
-
-		// sanity check with reference oracle
-		reference, err := woReference.Position(endPosition)
-		if err != nil {
-			return fmt.Errorf("failed to compute reference label: %w", err)
-		}
-		if !bytes.Equal(res.Output[(batchSize-1)*postrs.LabelLength:], reference.Output) {
-			return ErrReferenceLabelMismatch{
-				Index:      endPosition,
-				Commitment: init.commitment,
-				Expected:   reference.Output,
-				Actual:     res.Output[batchSize-postrs.LabelLength:],
-			}
-		}
-
-		if res.Nonce != nil {
-			candidate := res.Output[(*res.Nonce-startPosition)*postrs.LabelLength:]
-			candidate = candidate[:postrs.LabelLength]
-
-			fields := []zap.Field{
-				zap.Int("fileIndex", fileIndex),
-				zap.Uint64("nonce", *res.Nonce),
-				zap.String("value", hex.EncodeToString(candidate)),
-			}
-			init.logger.Debug("initialization: found nonce", fields...)
-
-			if init.nonceValue == nil || bytes.Compare(candidate, init.nonceValue) < 0 {
-				nonceValue := make([]byte, postrs.LabelLength)
-				copy(nonceValue, candidate)
-
-				init.logger.Info("initialization: found new best nonce", fields...)
-				init.nonceValue = nonceValue
-				init.nonce.Store(res.Nonce)
-				init.saveMetadata()
-			}
-		}
-
-		// Write labels batch to disk.
-		if err := writer.Write(res.Output); err != nil {
-			return err
-		}
-
-		init.numLabelsWritten.Store(fileOffset + currentPosition + uint64(batchSize))
-	}
-
-	if err := writer.Flush(); err != nil {
-		return err
-	}
-
-	numLabelsWritten, err = writer.NumLabelsWritten()
-	if err != nil {
-		return err
-	}
-
-	init.logger.Info("initialization: completed",
-		zap.Int("fileIndex", fileIndex),
-		zap.Uint64("numLabelsWritten", numLabelsWritten),
-	)
-	return nil
-}
-
 func (init *Initializer) verifyMetadata(m *shared.PostMetadata) error {
 	if !bytes.Equal(init.nodeId, m.NodeId) {
 		return ConfigMismatchError{
@@ -633,6 +1122,13 @@ func (init *Initializer) verifyMetadata(m *shared.PostMetadata) error {
 }
 
 func (init *Initializer) saveMetadata() error {
+	init.nonceMtx.Lock()
+	defer init.nonceMtx.Unlock()
+	return init.saveMetadataLocked()
+}
+
+// saveMetadataLocked persists the metadata. The caller must hold nonceMtx.
+func (init *Initializer) saveMetadataLocked() error {
 	v := shared.PostMetadata{
 		NodeId:          init.nodeId,
 		CommitmentAtxId: init.commitmentAtxId,
@@ -643,6 +1139,16 @@ func (init *Initializer) saveMetadata() error {
 		NonceValue:      init.nonceValue,
 		LastPosition:    init.lastPosition.Load(),
 	}
+	if storage, ok := init.storage.(*persistence.MultiDirStorage); ok {
+		v.FileDirs = make(map[int]string)
+		for name, dir := range storage.Locations() {
+			index, err := shared.ParseFileIndex(name)
+			if err != nil {
+				return err
+			}
+			v.FileDirs[index] = dir
+		}
+	}
 	return SaveMetadata(init.opts.DataDir, &v)
 }
 
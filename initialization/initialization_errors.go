@@ -3,12 +3,19 @@ package initialization
 import (
 	"errors"
 	"fmt"
+
+	"github.com/spacemeshos/post/persistence"
 )
 
 var (
 	ErrAlreadyInitializing          = errors.New("already initializing")
 	ErrCannotResetWhileInitializing = errors.New("cannot reset while initializing")
-	ErrStateMetadataFileMissing     = errors.New("metadata file is missing")
+	ErrStateMetadataFileMissing     = persistence.ErrMetadataFileMissing
+	ErrNoProviders                  = errors.New("no compute providers configured")
+	ErrMetadataVersionNotSupported  = persistence.ErrMetadataVersionNotSupported
+
+	// errReferenceFailed is returned if the reference oracle fails, in which case computed labels can't be verified.
+	errReferenceFailed = errors.New("failed to compute reference label")
 )
 
 type ErrReferenceLabelMismatch struct {
@@ -22,3 +29,40 @@ type ErrReferenceLabelMismatch struct {
 func (e ErrReferenceLabelMismatch) Error() string {
 	return fmt.Sprintf("reference label mismatch at %d with commitment %x: expected %x, actual %x", e.Index, e.Commitment, e.Expected, e.Actual)
 }
+
+// ErrNotEnoughSpace is returned by Initialize if a directory doesn't have enough free space for the labels that are
+// still to be written to it.
+type ErrNotEnoughSpace struct {
+	Dir       string
+	Required  uint64
+	Available uint64
+}
+
+func (e ErrNotEnoughSpace) Error() string {
+	return fmt.Sprintf("not enough space in %s: %d bytes required, %d bytes available", e.Dir, e.Required, e.Available)
+}
+
+// ErrUnsupportedFilesystem is returned by Initialize if the file system of a directory can't hold the label files.
+type ErrUnsupportedFilesystem struct {
+	Dir        string
+	Filesystem string
+	Reason     string
+}
+
+func (e ErrUnsupportedFilesystem) Error() string {
+	return fmt.Sprintf("file system %s of %s is not supported: %s", e.Filesystem, e.Dir, e.Reason)
+}
+
+// ErrDirNotWritable is returned by Initialize if files can't be created in a directory.
+type ErrDirNotWritable struct {
+	Dir string
+	Err error
+}
+
+func (e ErrDirNotWritable) Error() string {
+	return fmt.Sprintf("directory %s is not writable: %v", e.Dir, e.Err)
+}
+
+func (e ErrDirNotWritable) Unwrap() error {
+	return e.Err
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,6 +21,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
 	"github.com/spacemeshos/post/oracle"
 	"github.com/spacemeshos/post/persistence"
 	"github.com/spacemeshos/post/shared"
@@ -37,7 +40,7 @@ func TestInitialize(t *testing.T) {
 	opts := config.DefaultInitOpts()
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = cfg.MinNumUnits
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 	opts.Scrypt.N = 16
 
 	init, err := NewInitializer(
@@ -79,7 +82,7 @@ func TestInitialize_PowOutOfRange(t *testing.T) {
 	opts := config.DefaultInitOpts()
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = cfg.MinNumUnits
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 	opts.Scrypt.N = 16
 
 	// nodeId where no label in the first uint64(cfg.MinNumUnits)*cfg.LabelsPerUnit satisfies the PoW requirement.
@@ -127,7 +130,7 @@ func TestInitialize_ContinueWithLastPos(t *testing.T) {
 	opts := config.DefaultInitOpts()
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = cfg.MinNumUnits
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 	opts.Scrypt.N = 16
 
 	init, err := NewInitializer(
@@ -266,7 +269,7 @@ func TestReset_WhileInitializing(t *testing.T) {
 	opts.Scrypt.N = 16
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = cfg.MinNumUnits
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 	opts.ComputeBatchSize = 1 << 14
 
 	init, err := NewInitializer(
@@ -302,7 +305,7 @@ func TestInitialize_Repeated(t *testing.T) {
 	opts.Scrypt.N = 16
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = cfg.MinNumUnits
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 
 	init, err := NewInitializer(
 		WithNodeId(nodeId),
@@ -358,7 +361,7 @@ func TestInitialize_NumUnits_Increase(t *testing.T) {
 	opts.Scrypt.N = 16
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = cfg.MinNumUnits
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 
 	init, err := NewInitializer(
 		WithNodeId(nodeId),
@@ -413,7 +416,7 @@ func TestInitialize_NumUnits_Decrease(t *testing.T) {
 	opts.Scrypt.N = 16
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = cfg.MinNumUnits + 1
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 
 	init, err := NewInitializer(
 		WithNodeId(nodeId),
@@ -469,7 +472,7 @@ func TestInitialize_RedundantFiles(t *testing.T) {
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = cfg.MinNumUnits + 1
 	opts.MaxFileSize = 1 << 12
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 
 	init, err := NewInitializer(
 		WithNodeId(nodeId),
@@ -539,7 +542,7 @@ func TestInitialize_MultipleFiles(t *testing.T) {
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = cfg.MinNumUnits
 	opts.MaxFileSize = uint64(opts.NumUnits) * cfg.LabelsPerUnit * config.BitsPerLabel / 8
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 
 	var oneFileData []byte
 	var oneFileNonce uint64
@@ -605,6 +608,87 @@ func TestInitialize_MultipleFiles(t *testing.T) {
 	}
 }
 
+func TestInitialize_MultipleProviders(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 12
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits + 1
+	opts.MaxFileSize = 1 << 14
+	opts.ProviderIDs = []uint{CPUProviderID()}
+	opts.ComputeBatchSize = 1 << 8
+
+	// Initialize with a single provider as a reference.
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+	data, err := initData(opts.DataDir)
+	r.NoError(err)
+	nonce := *init.Nonce()
+
+	// Initialize the same layout with multiple providers.
+	optsMulti := opts
+	optsMulti.DataDir = t.TempDir()
+	optsMulti.ProviderIDs = []uint{CPUProviderID(), CPUProviderID(), CPUProviderID()}
+
+	init, err = NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(optsMulti),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+
+	multiData, err := initData(optsMulti.DataDir)
+	r.NoError(err)
+	r.Equal(data, multiData)
+	r.Equal(nonce, *init.Nonce())
+
+	m, err := LoadMetadata(optsMulti.DataDir)
+	r.NoError(err)
+	r.Equal(nonce, *m.Nonce)
+}
+
+func TestInitialize_NoProviders(t *testing.T) {
+	cfg := config.DefaultConfig()
+
+	opts := config.DefaultInitOpts()
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits
+	opts.ProviderIDs = nil
+	opts.ProviderSelection.ExcludeCPU = true
+
+	// all providers are excluded from the automatic selection
+	providers := func() ([]Provider, error) {
+		return []Provider{{ID: 1, Model: "GPU", DeviceType: postrs.ClassGPU}, {ID: CPUProviderID(), Model: "CPU", DeviceType: postrs.ClassCPU}}, nil
+	}
+	benchmark := func(context.Context, Provider, config.ScryptParams, []byte) (int, error) { return 1, nil }
+	opts.ProviderSelection.Exclude = []uint{1}
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		withProviders(providers, benchmark),
+	)
+	require.NoError(t, err)
+	require.ErrorIs(t, init.Initialize(context.Background()), ErrNoProviders)
+}
+
 func TestNumLabelsWritten(t *testing.T) {
 	r := require.New(t)
 
@@ -615,7 +699,7 @@ func TestNumLabelsWritten(t *testing.T) {
 	opts.Scrypt.N = 16
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = cfg.MinNumUnits
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 
 	init, err := NewInitializer(
 		WithNodeId(nodeId),
@@ -671,7 +755,7 @@ func TestValidateMetadata(t *testing.T) {
 	opts.Scrypt.N = 16
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = cfg.MinNumUnits
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 
 	init, err := NewInitializer(
 		WithNodeId(nodeId),
@@ -755,7 +839,7 @@ func TestStop(t *testing.T) {
 	opts.Scrypt.N = 64
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = 10
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 	opts.ComputeBatchSize = 1 << 10
 
 	init, err := NewInitializer(
@@ -828,7 +912,7 @@ func TestWrongLabelsDetected(t *testing.T) {
 	opts := config.DefaultInitOpts()
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = cfg.MinNumUnits
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 	opts.Scrypt.N = 16
 
 	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
@@ -902,7 +986,7 @@ func TestInitializeSubset(t *testing.T) {
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = 20
 	opts.MaxFileSize = cfg.LabelsPerUnit * 2 * uint64(config.BytesPerLabel()) // 2 units per file
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 	opts.Scrypt.N = 2
 
 	init, err := NewInitializer(
@@ -981,7 +1065,7 @@ func TestInitializeLastFileIsSmaller(t *testing.T) {
 	opts.DataDir = t.TempDir()
 	opts.NumUnits = 5 // the last file will have 1 unit
 	opts.MaxFileSize = 2 * cfg.UnitSize()
-	opts.ProviderID = int(CPUProviderID())
+	opts.ProviderIDs = []uint{CPUProviderID()}
 	opts.Scrypt.N = 2
 
 	init, err := NewInitializer(
@@ -1024,7 +1108,7 @@ func TestRemoveRedundantFiles(t *testing.T) {
 		require.NoError(t, f.Close())
 	}
 
-	removeRedundantFiles(cfg, opts, zap.NewNop())
+	removeRedundantFiles(cfg, opts, persistence.NewDirStorage(opts.DataDir), zap.NewNop())
 
 	files, err := os.ReadDir(opts.DataDir)
 	require.NoError(t, err)
@@ -1035,3 +1119,128 @@ func TestRemoveRedundantFiles(t *testing.T) {
 		require.NoError(t, err)
 	}
 }
+
+func TestInitialize_ComputesWhileWriting(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 10
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits
+	opts.ProviderIDs = []uint{CPUProviderID()}
+	opts.ComputeBatchSize = 1 << 8
+
+	// the first computed batch is held before it is written until the device has computed the next one
+	var init *Initializer
+	var held, overlapped atomic.Bool
+	handler := func(e Event) {
+		if e.Kind != EventBatchComputed || held.Swap(true) {
+			return
+		}
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if devices := init.DeviceHealth(); len(devices) == 1 && devices[0].Successes >= 2 {
+				overlapped.Store(true)
+				return
+			}
+		}
+	}
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		WithProgressHandler(handler),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+	r.True(overlapped.Load(), "the next batch wasn't computed while the first one was held")
+	r.Equal(uint64(opts.NumUnits)*cfg.LabelsPerUnit, init.NumLabelsWritten())
+
+	// the labels are the same as computed without pipelining
+	wo, err := init.cpuOracle()
+	r.NoError(err)
+	defer wo.Close()
+	res, err := wo.Positions(0, uint64(opts.NumUnits)*cfg.LabelsPerUnit-1)
+	r.NoError(err)
+	data, err := initData(opts.DataDir)
+	r.NoError(err)
+	r.Equal(res.Output, data)
+}
+
+// failingReference is a reference oracle that fails the call with the given number.
+type failingReference struct {
+	labelOracle
+	calls  atomic.Int64
+	failOn int64
+}
+
+func (r *failingReference) PositionWithContext(ctx context.Context, p uint64) (oracle.WorkOracleResult, error) {
+	if r.calls.Add(1) == r.failOn {
+		return oracle.WorkOracleResult{}, errors.New("reference failed")
+	}
+	return r.labelOracle.PositionWithContext(ctx, p)
+}
+
+func TestInitialize_DeviceFailsWithBatchInFlight(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 12
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits
+	opts.MaxFileSize = uint64(opts.NumUnits) * cfg.LabelsPerUnit * postrs.LabelLength
+	opts.ProviderIDs = []uint{CPUProviderID(), CPUProviderID()}
+	opts.ComputeBatchSize = 1 << 6
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+	)
+	r.NoError(err)
+
+	var oracles []*oracle.WorkOracle
+	for range opts.ProviderIDs {
+		wo, err := init.cpuOracle(oracle.WithHealthTracker(init.health))
+		r.NoError(err)
+		defer wo.Close()
+		oracles = append(oracles, wo)
+	}
+	woReference, err := init.cpuOracle()
+	r.NoError(err)
+	defer woReference.Close()
+
+	// the reference check of one batch fails while the devices have computed further batches, which is fatal for
+	// the device that checks it and has to stop the other one
+	reference := &failingReference{labelOracle: woReference, failOn: 3}
+	layout, err := deriveFilesLayout(cfg, opts)
+	r.NoError(err)
+
+	done := make(chan error, 1)
+	go func() { done <- init.initFiles(context.Background(), oracles, reference, layout, nil) }()
+	select {
+	case err := <-done:
+		r.ErrorIs(err, errReferenceFailed)
+	case <-time.After(30 * time.Second):
+		r.FailNow("initialization didn't stop after a fatal error")
+	}
+	r.Less(init.NumLabelsWritten(), uint64(opts.NumUnits)*cfg.LabelsPerUnit)
+
+	// the batches that were in flight are computed again when initialization is resumed
+	r.NoError(init.Initialize(context.Background()))
+	data, err := initData(opts.DataDir)
+	r.NoError(err)
+	res, err := woReference.Positions(0, uint64(opts.NumUnits)*cfg.LabelsPerUnit-1)
+	r.NoError(err)
+	r.Equal(res.Output, data)
+}
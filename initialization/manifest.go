@@ -0,0 +1,216 @@
+package initialization
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/zeebo/blake3"
+
+	"github.com/spacemeshos/post/persistence"
+	"github.com/spacemeshos/post/shared"
+)
+
+const (
+	manifestFileName = "postdata_manifest.json"
+
+	// ChecksumAlgorithm is the hash function used for the checksums in the manifest.
+	ChecksumAlgorithm = "blake3"
+
+	// hashChunkSize is the amount of data hashed between checks for cancellation.
+	hashChunkSize = 16 << 20
+)
+
+// Checksum is the hash of the content of a file.
+type Checksum []byte
+
+func (c Checksum) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(c))
+}
+
+func (c *Checksum) UnmarshalJSON(data []byte) (err error) {
+	var hexString string
+	if err = json.Unmarshal(data, &hexString); err != nil {
+		return
+	}
+	*c, err = hex.DecodeString(hexString)
+	return
+}
+
+// FileChecksum records what a completely initialized file looks like.
+type FileChecksum struct {
+	Size     uint64
+	Checksum Checksum
+}
+
+// Manifest holds the checksums of all completely initialized files of a datadir. It is persisted next to the
+// metadata and allows to detect files that were corrupted after they have been initialized.
+type Manifest struct {
+	Algorithm string
+	Files     map[int]FileChecksum
+}
+
+// IntegrityReport is the result of checking the files of a datadir against their manifest.
+type IntegrityReport struct {
+	// Valid are the indices of files that match their checksum.
+	Valid []int
+	// Corrupt are the indices of files that don't match their checksum.
+	Corrupt []int
+	// Missing are the indices of files that are listed in the manifest but don't exist.
+	Missing []int
+	// Unknown are the indices of files that exist but aren't listed in the manifest, e.g. because they aren't
+	// completely initialized yet.
+	Unknown []int
+}
+
+// OK returns true if none of the files listed in the manifest is corrupt or missing.
+func (r *IntegrityReport) OK() bool {
+	return len(r.Corrupt) == 0 && len(r.Missing) == 0
+}
+
+func newManifest() *Manifest {
+	return &Manifest{
+		Algorithm: ChecksumAlgorithm,
+		Files:     make(map[int]FileChecksum),
+	}
+}
+
+func newFileHasher() hash.Hash {
+	return blake3.New()
+}
+
+// SaveManifest atomically writes the manifest to the given directory.
+func SaveManifest(dir string, m *Manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("serialization failure: %w", err)
+	}
+
+	if err := writeFileAtomic(dir, manifestFileName, data); err != nil {
+		return fmt.Errorf("write to disk failure: %w", err)
+	}
+	return nil
+}
+
+// LoadManifest reads the manifest from the given directory. If there is no manifest yet an empty one is returned.
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return newManifest(), nil
+	case err != nil:
+		return nil, fmt.Errorf("read file failure: %w", err)
+	}
+
+	m := newManifest()
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.Algorithm != ChecksumAlgorithm {
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s", m.Algorithm)
+	}
+	return m, nil
+}
+
+// VerifyChecksums re-hashes the files of the initialization in the given directory and compares them against the
+// checksums in the manifest. Files spread over multiple directories are found through the metadata.
+func VerifyChecksums(ctx context.Context, dir string) (*IntegrityReport, error) {
+	storage, err := persistence.OpenDataStorage(dir)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyStorageChecksums(ctx, dir, storage)
+}
+
+// VerifyStorageChecksums re-hashes the files in the given storage and compares them against the checksums in the
+// manifest in dir.
+func VerifyStorageChecksums(ctx context.Context, dir string, storage persistence.Storage) (*IntegrityReport, error) {
+	m, err := LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IntegrityReport{}
+	for index, expected := range m.Files {
+		valid, err := verifyChecksum(ctx, storage, shared.InitFileName(index), expected)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			report.Missing = append(report.Missing, index)
+		case err != nil:
+			return nil, fmt.Errorf("failed to hash file %d: %w", index, err)
+		case valid:
+			report.Valid = append(report.Valid, index)
+		default:
+			report.Corrupt = append(report.Corrupt, index)
+		}
+	}
+
+	files, err := storage.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		index, err := shared.ParseFileIndex(file.Name)
+		if err != nil {
+			continue
+		}
+		if _, ok := m.Files[index]; !ok {
+			report.Unknown = append(report.Unknown, index)
+		}
+	}
+
+	sort.Ints(report.Valid)
+	sort.Ints(report.Corrupt)
+	sort.Ints(report.Missing)
+	sort.Ints(report.Unknown)
+	return report, nil
+}
+
+func verifyChecksum(ctx context.Context, storage persistence.Storage, name string, expected FileChecksum) (bool, error) {
+	info, err := storage.Stat(name)
+	if err != nil {
+		return false, err
+	}
+	if uint64(info.Size) != expected.Size {
+		return false, nil
+	}
+
+	h := newFileHasher()
+	if err := hashFile(ctx, storage, name, info.Size, h); err != nil {
+		return false, err
+	}
+	return bytes.Equal(h.Sum(nil), expected.Checksum), nil
+}
+
+// hashFile writes the first size bytes of a file to the given hash.
+func hashFile(ctx context.Context, storage persistence.Storage, name string, size int64, h hash.Hash) error {
+	f, err := storage.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for size > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n := int64(hashChunkSize)
+		if size < n {
+			n = size
+		}
+		if _, err := io.CopyN(h, f, n); err != nil {
+			return err
+		}
+		size -= n
+	}
+	return nil
+}
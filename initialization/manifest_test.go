@@ -0,0 +1,148 @@
+package initialization
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/shared"
+)
+
+func initializeForManifest(t *testing.T, opts config.InitOpts, cfg config.Config) {
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+	)
+	require.NoError(t, err)
+	require.NoError(t, init.Initialize(context.Background()))
+}
+
+func TestManifest_VerifyChecksums(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 12
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits + 1
+	opts.MaxFileSize = 1 << 14
+	opts.ProviderIDs = []uint{CPUProviderID()}
+	opts.ComputeBatchSize = 1 << 8
+
+	initializeForManifest(t, opts, cfg)
+	numFiles := opts.TotalFiles(cfg.LabelsPerUnit)
+
+	m, err := LoadManifest(opts.DataDir)
+	r.NoError(err)
+	r.Len(m.Files, numFiles)
+
+	report, err := VerifyChecksums(context.Background(), opts.DataDir)
+	r.NoError(err)
+	r.True(report.OK())
+	r.Len(report.Valid, numFiles)
+	r.Empty(report.Unknown)
+
+	// flip a bit in file 1
+	path := filepath.Join(opts.DataDir, shared.InitFileName(1))
+	data, err := os.ReadFile(path)
+	r.NoError(err)
+	data[100] ^= 0x01
+	r.NoError(os.WriteFile(path, data, shared.OwnerReadWrite))
+
+	// remove file 2
+	r.NoError(os.Remove(filepath.Join(opts.DataDir, shared.InitFileName(2))))
+
+	// add a file that isn't part of the manifest
+	r.NoError(os.WriteFile(filepath.Join(opts.DataDir, shared.InitFileName(numFiles)), nil, shared.OwnerReadWrite))
+
+	report, err = VerifyChecksums(context.Background(), opts.DataDir)
+	r.NoError(err)
+	r.False(report.OK())
+	r.Equal([]int{1}, report.Corrupt)
+	r.Equal([]int{2}, report.Missing)
+	r.Equal([]int{numFiles}, report.Unknown)
+	r.Len(report.Valid, numFiles-2)
+}
+
+func TestManifest_ChecksumOfResumedFile(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 12
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits
+	opts.MaxFileSize = 1 << 14
+	opts.ProviderIDs = []uint{CPUProviderID()}
+	opts.ComputeBatchSize = 1 << 8
+
+	initializeForManifest(t, opts, cfg)
+
+	m, err := LoadManifest(opts.DataDir)
+	r.NoError(err)
+	expected := m.Files[0]
+
+	// cut file 0 in half, resuming initialization must hash the remaining labels before writing new ones
+	path := filepath.Join(opts.DataDir, shared.InitFileName(0))
+	r.NoError(os.Truncate(path, int64(expected.Size/2)))
+
+	initializeForManifest(t, opts, cfg)
+
+	m, err = LoadManifest(opts.DataDir)
+	r.NoError(err)
+	r.Equal(expected, m.Files[0])
+
+	report, err := VerifyChecksums(context.Background(), opts.DataDir)
+	r.NoError(err)
+	r.True(report.OK())
+}
+
+func TestManifest_VerifyChecksumsMultipleDataDirs(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 12
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.DataDirs = []string{t.TempDir(), t.TempDir()}
+	opts.NumUnits = cfg.MinNumUnits + 1
+	opts.MaxFileSize = 1 << 14
+	opts.ProviderIDs = []uint{CPUProviderID()}
+	opts.ComputeBatchSize = 1 << 8
+
+	initializeForManifest(t, opts, cfg)
+	numFiles := opts.TotalFiles(cfg.LabelsPerUnit)
+
+	report, err := VerifyChecksums(context.Background(), opts.DataDir)
+	r.NoError(err)
+	r.True(report.OK())
+	r.Len(report.Valid, numFiles)
+	r.Empty(report.Missing)
+
+	// flip a bit in file 1, which is in the second directory
+	path := filepath.Join(opts.DataDirs[1], shared.InitFileName(1))
+	data, err := os.ReadFile(path)
+	r.NoError(err)
+	data[100] ^= 0x01
+	r.NoError(os.WriteFile(path, data, shared.OwnerReadWrite))
+
+	report, err = VerifyChecksums(context.Background(), opts.DataDir)
+	r.NoError(err)
+	r.Equal([]int{1}, report.Corrupt)
+	r.Empty(report.Missing)
+}
@@ -2,48 +2,111 @@ package initialization
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 
+	"github.com/spacemeshos/post/persistence"
 	"github.com/spacemeshos/post/shared"
 )
 
-const metadataFileName = "postdata_metadata.json"
+const (
+	metadataFileName       = shared.MetadataFileName
+	metadataBackupFileName = shared.MetadataBackupFileName
 
+	// tempFileSuffix is appended to the name of a file while it is written by writeFileAtomic.
+	tempFileSuffix = ".tmp"
+)
+
+// isStateFile returns true if the file with the given name holds state of the initialization other than labels.
+func isStateFile(name string) bool {
+	switch strings.TrimSuffix(name, tempFileSuffix) {
+	case metadataFileName, metadataBackupFileName, manifestFileName:
+		return true
+	default:
+		return false
+	}
+}
+
+// SaveMetadata atomically writes the metadata to the given directory. The previous metadata is kept as a backup,
+// which is used by LoadMetadata if the metadata file is corrupted.
 func SaveMetadata(dir string, v *shared.PostMetadata) error {
 	err := os.MkdirAll(dir, shared.OwnerReadWriteExec)
 	if err != nil && !os.IsExist(err) {
 		return fmt.Errorf("dir creation failure: %w", err)
 	}
 
-	data, err := json.Marshal(v)
+	m := *v
+	m.Version = shared.MetadataVersion
+	data, err := json.Marshal(m)
 	if err != nil {
 		return fmt.Errorf("serialization failure: %w", err)
 	}
 
-	err = os.WriteFile(filepath.Join(dir, metadataFileName), data, shared.OwnerReadWrite)
-	if err != nil {
-		return fmt.Errorf("write to disk failure: %w", err)
+	// Only back up metadata that can be read, to not replace a good backup with a corrupted file.
+	prev, err := os.ReadFile(filepath.Join(dir, metadataFileName))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("read file failure: %w", err)
+	case json.Valid(prev):
+		if err := writeFileAtomic(dir, metadataBackupFileName, prev); err != nil {
+			return fmt.Errorf("backup failure: %w", err)
+		}
 	}
 
+	if err := writeFileAtomic(dir, metadataFileName, data); err != nil {
+		return fmt.Errorf("write to disk failure: %w", err)
+	}
 	return nil
 }
 
+// LoadMetadata reads the metadata from the given directory and migrates it to the current version.
+// If the metadata file is missing or corrupted the backup written by SaveMetadata is used instead.
 func LoadMetadata(dir string) (*shared.PostMetadata, error) {
-	filename := filepath.Join(dir, metadataFileName)
-	data, err := os.ReadFile(filename)
+	return persistence.LoadMetadata(dir)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to name, so that the file either has its previous
+// or its new content, even after a crash. Both the file and the directory are synced before returning.
+func writeFileAtomic(dir, name string, data []byte) error {
+	tmp := filepath.Join(dir, name+tempFileSuffix)
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, shared.OwnerReadWrite)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, ErrStateMetadataFileMissing
-		}
-		return nil, fmt.Errorf("read file failure: %w", err)
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
 	}
 
-	metadata := shared.PostMetadata{}
-	if err := json.Unmarshal(data, &metadata); err != nil {
-		return nil, err
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	// Windows doesn't support syncing directories.
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
 	}
+	defer d.Close()
 
-	return &metadata, nil
+	return d.Sync()
 }
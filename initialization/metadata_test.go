@@ -0,0 +1,101 @@
+package initialization
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestMetadata_SaveAndLoad(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+
+	nonce := uint64(42)
+	m := &shared.PostMetadata{
+		NodeId:          nodeId,
+		CommitmentAtxId: commitmentAtxId,
+		LabelsPerUnit:   1 << 12,
+		NumUnits:        2,
+		MaxFileSize:     1 << 20,
+		Nonce:           &nonce,
+		NonceValue:      shared.NonceValue{1, 2, 3},
+	}
+	r.NoError(SaveMetadata(dir, m))
+	r.Zero(m.Version, "the given metadata must not be modified")
+
+	loaded, err := LoadMetadata(dir)
+	r.NoError(err)
+	r.Equal(uint32(shared.MetadataVersion), loaded.Version)
+	loaded.Version = 0
+	r.Equal(m, loaded)
+
+	r.NoFileExists(filepath.Join(dir, metadataFileName+tempFileSuffix))
+	r.NoFileExists(filepath.Join(dir, metadataBackupFileName), "there is no previous metadata to back up")
+}
+
+func TestMetadata_Missing(t *testing.T) {
+	_, err := LoadMetadata(t.TempDir())
+	require.ErrorIs(t, err, ErrStateMetadataFileMissing)
+}
+
+func TestMetadata_LoadsLegacyFormat(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+
+	legacy := `{"NodeId":"AQI=","CommitmentAtxId":"AwQ=","LabelsPerUnit":4096,"NumUnits":2,"MaxFileSize":1024,"Nonce":7}`
+	r.NoError(os.WriteFile(filepath.Join(dir, metadataFileName), []byte(legacy), shared.OwnerReadWrite))
+
+	m, err := LoadMetadata(dir)
+	r.NoError(err)
+	r.Equal(uint32(shared.MetadataVersion), m.Version)
+	r.Equal([]byte{1, 2}, m.NodeId)
+	r.Equal([]byte{3, 4}, m.CommitmentAtxId)
+	r.Equal(uint64(4096), m.LabelsPerUnit)
+	r.Equal(uint64(7), *m.Nonce)
+}
+
+func TestMetadata_UnsupportedVersion(t *testing.T) {
+	dir := t.TempDir()
+
+	data := `{"Version":1000,"NodeId":"AQI=","CommitmentAtxId":"AwQ="}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, metadataFileName), []byte(data), shared.OwnerReadWrite))
+
+	_, err := LoadMetadata(dir)
+	require.ErrorIs(t, err, ErrMetadataVersionNotSupported)
+}
+
+func TestMetadata_FallsBackToBackup(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+
+	m := &shared.PostMetadata{
+		NodeId:          nodeId,
+		CommitmentAtxId: commitmentAtxId,
+		NumUnits:        1,
+	}
+	r.NoError(SaveMetadata(dir, m))
+
+	m.NumUnits = 2
+	r.NoError(SaveMetadata(dir, m))
+	r.FileExists(filepath.Join(dir, metadataBackupFileName))
+
+	// simulate a torn write of the metadata file
+	r.NoError(os.WriteFile(filepath.Join(dir, metadataFileName), []byte(`{"NodeId":`), shared.OwnerReadWrite))
+
+	loaded, err := LoadMetadata(dir)
+	r.NoError(err)
+	r.Equal(uint32(1), loaded.NumUnits)
+
+	// saving again must not replace the good backup with the corrupted file
+	m.NumUnits = 3
+	r.NoError(SaveMetadata(dir, m))
+
+	r.NoError(os.Remove(filepath.Join(dir, metadataFileName)))
+	loaded, err = LoadMetadata(dir)
+	r.NoError(err)
+	r.Equal(uint32(1), loaded.NumUnits)
+}
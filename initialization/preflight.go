@@ -0,0 +1,240 @@
+package initialization
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/persistence"
+	"github.com/spacemeshos/post/shared"
+)
+
+const (
+	// maxFATFileSize is the size limit of a file on a FAT file system.
+	maxFATFileSize = 1<<32 - 1
+
+	// preflightProbePattern is the name pattern of the file written to check that a directory is writable.
+	preflightProbePattern = "post-preflight-*"
+)
+
+// preflightFile is a file of the layout that doesn't have all of its space allocated yet.
+type preflightFile struct {
+	name    string
+	dir     string // empty if the directory is only selected when the file is created
+	size    int64
+	missing uint64
+}
+
+// preflight checks that the files of the layout can be written before any labels are computed: every directory they
+// are written to must be writable, its file system must support files of the configured size and it must have
+// enough free space for the labels that are still missing. If opts.Preallocate is set, the space is allocated.
+//
+// Only storages in directories are checked.
+func (init *Initializer) preflight(layout filesLayout) error {
+	var dirs []string
+	switch s := init.storage.(type) {
+	case *persistence.DirStorage:
+		dirs = []string{s.Dir()}
+	case *persistence.MultiDirStorage:
+		dirs = s.Dirs()
+	default:
+		init.logger.Debug("initialization: skipping pre-flight checks of storage", zap.String("type", fmt.Sprintf("%T", s)))
+		return nil
+	}
+
+	files, err := init.missingFiles(layout)
+	if err != nil {
+		return err
+	}
+
+	var unplaced uint64
+	required := make(map[string]uint64)
+	for _, f := range files {
+		if f.dir == "" {
+			unplaced += f.missing
+			continue
+		}
+		if _, ok := required[f.dir]; !ok && !contains(dirs, f.dir) {
+			dirs = append(dirs, f.dir)
+		}
+		required[f.dir] += f.missing
+	}
+
+	// spare is the free space left for the files whose directory is only selected when they are created.
+	var spare uint64
+	spaceKnown := true
+	for _, dir := range dirs {
+		if err := init.checkDir(dir); err != nil {
+			return err
+		}
+
+		available, err := init.freeSpace(dir)
+		if err != nil {
+			init.logger.Warn("initialization: failed to determine free space, not checking it",
+				zap.String("dir", dir),
+				zap.Error(err),
+			)
+			spaceKnown = false
+			continue
+		}
+		if required[dir] > available {
+			return ErrNotEnoughSpace{Dir: dir, Required: required[dir], Available: available}
+		}
+		spare += available - required[dir]
+	}
+	if spaceKnown && unplaced > spare {
+		return ErrNotEnoughSpace{Dir: strings.Join(dirs, ", "), Required: unplaced, Available: spare}
+	}
+
+	init.logger.Info("initialization: pre-flight checks passed",
+		zap.Strings("dirs", dirs),
+		zap.Int("missingFiles", len(files)),
+	)
+
+	if !init.opts.Preallocate {
+		return nil
+	}
+	for _, f := range files {
+		err := init.preallocate(f)
+		switch {
+		case errors.Is(err, persistence.ErrPreallocationNotSupported):
+			init.logger.Warn("initialization: preallocation is not supported, skipping it")
+			return nil
+		case err != nil:
+			return fmt.Errorf("failed to preallocate %s: %w", f.name, err)
+		}
+	}
+	init.logger.Info("initialization: preallocated files", zap.Int("numFiles", len(files)))
+	return nil
+}
+
+// missingFiles returns the files of the layout that don't have all of their space allocated yet.
+func (init *Initializer) missingFiles(layout filesLayout) ([]preflightFile, error) {
+	var files []preflightFile
+	for i := 0; i < int(layout.NumFiles); i++ {
+		numLabels := layout.FileNumLabels
+		if i == int(layout.NumFiles)-1 {
+			numLabels = layout.LastFileNumLabels
+		}
+		f := preflightFile{
+			name: shared.InitFileName(layout.FirstFileIdx + i),
+			size: int64(numLabels) * int64(config.BytesPerLabel()),
+		}
+		f.dir = init.targetDir(f.name)
+
+		var allocated int64
+		info, err := init.storage.Stat(f.name)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			allocated = info.Size
+			usage, err := persistence.DiskUsage(filepath.Join(f.dir, f.name))
+			if err != nil {
+				return nil, err
+			}
+			if int64(usage) > allocated {
+				allocated = int64(usage)
+			}
+		}
+
+		if allocated < f.size {
+			f.missing = uint64(f.size - allocated)
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// targetDir returns the directory the file with the given name is written to, or an empty string if it is only
+// selected when the file is created.
+func (init *Initializer) targetDir(name string) string {
+	switch s := init.storage.(type) {
+	case *persistence.DirStorage:
+		return s.Dir()
+	case *persistence.MultiDirStorage:
+		dir, _ := s.Target(name)
+		return dir
+	default:
+		return ""
+	}
+}
+
+// checkDir checks that files can be created in the given directory and that its file system can hold them.
+func (init *Initializer) checkDir(dir string) error {
+	if err := os.MkdirAll(dir, shared.OwnerReadWriteExec); err != nil {
+		return ErrDirNotWritable{Dir: dir, Err: err}
+	}
+	probe, err := os.CreateTemp(dir, preflightProbePattern)
+	if err != nil {
+		return ErrDirNotWritable{Dir: dir, Err: err}
+	}
+	if err := probe.Close(); err != nil {
+		return ErrDirNotWritable{Dir: dir, Err: err}
+	}
+	if err := os.Remove(probe.Name()); err != nil {
+		return ErrDirNotWritable{Dir: dir, Err: err}
+	}
+
+	filesystem, err := persistence.FilesystemType(dir)
+	if err != nil {
+		init.logger.Debug("initialization: failed to determine file system", zap.String("dir", dir), zap.Error(err))
+		return nil
+	}
+
+	switch filesystem {
+	case "vfat", "msdos", "fat", "fat32":
+		if init.opts.MaxFileSize > maxFATFileSize {
+			return ErrUnsupportedFilesystem{
+				Dir:        dir,
+				Filesystem: filesystem,
+				Reason:     fmt.Sprintf("files are limited to %d bytes, reduce the max file size", uint64(maxFATFileSize)),
+			}
+		}
+	case "tmpfs", "ramfs":
+		init.logger.Warn("initialization: directory is on a file system in memory, its files are lost on reboot",
+			zap.String("dir", dir),
+			zap.String("filesystem", filesystem),
+		)
+	case "nfs", "cifs", "smb2", "smbfs":
+		init.logger.Warn("initialization: directory is on a network file system, generating proofs will be slow",
+			zap.String("dir", dir),
+			zap.String("filesystem", filesystem),
+		)
+	}
+
+	init.logger.Debug("initialization: checked directory",
+		zap.String("dir", dir),
+		zap.String("filesystem", filesystem),
+	)
+	return nil
+}
+
+// preallocate allocates the space the file is missing.
+func (init *Initializer) preallocate(f preflightFile) error {
+	file, err := init.storage.OpenFile(f.name, true)
+	if err != nil {
+		return err
+	}
+	if err := persistence.Preallocate(file, f.size); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func contains(dirs []string, dir string) bool {
+	for _, d := range dirs {
+		if d == dir {
+			return true
+		}
+	}
+	return false
+}
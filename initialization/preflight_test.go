@@ -0,0 +1,139 @@
+package initialization
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/persistence"
+	"github.com/spacemeshos/post/shared"
+)
+
+func preflightOpts(t *testing.T) (config.Config, config.InitOpts) {
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 12
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits + 1
+	opts.MaxFileSize = 1 << 14
+	opts.ProviderIDs = []uint{CPUProviderID()}
+	opts.ComputeBatchSize = 1 << 8
+	return cfg, opts
+}
+
+func TestPreflight_NotEnoughSpace(t *testing.T) {
+	r := require.New(t)
+	cfg, opts := preflightOpts(t)
+	totalBytes := uint64(opts.NumUnits) * cfg.UnitSize()
+
+	newInitializer := func(opts config.InitOpts, free uint64) *Initializer {
+		init, err := NewInitializer(
+			WithNodeId(nodeId),
+			WithCommitmentAtxId(commitmentAtxId),
+			WithConfig(cfg),
+			WithInitOpts(opts),
+			WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+			withFreeSpace(func(string) (uint64, error) { return free, nil }),
+		)
+		r.NoError(err)
+		return init
+	}
+
+	init := newInitializer(opts, totalBytes-1)
+	var spaceErr ErrNotEnoughSpace
+	r.ErrorAs(init.Initialize(context.Background()), &spaceErr)
+	r.Equal(opts.DataDir, spaceErr.Dir)
+	r.Equal(totalBytes, spaceErr.Required)
+	r.Equal(totalBytes-1, spaceErr.Available)
+	r.Zero(init.NumLabelsWritten())
+
+	// files of which the directory is selected on creation are checked against the free space of all directories
+	opts.DataDirs = []string{t.TempDir(), t.TempDir()}
+	opts.Placement = config.PlaceByCapacity
+	init = newInitializer(opts, totalBytes/2-1)
+	r.ErrorAs(init.Initialize(context.Background()), &spaceErr)
+	r.Equal(totalBytes, spaceErr.Required)
+
+	init = newInitializer(opts, totalBytes/2)
+	r.NoError(init.Initialize(context.Background()))
+}
+
+func TestPreflight_NotWritable(t *testing.T) {
+	r := require.New(t)
+	cfg, opts := preflightOpts(t)
+
+	dir := filepath.Join(t.TempDir(), "data")
+	opts.DataDirs = []string{dir}
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+	)
+	r.NoError(err)
+
+	// the directory is replaced by a file, e.g. a disk that is not mounted
+	r.NoError(os.WriteFile(dir, nil, shared.OwnerReadWrite))
+
+	var dirErr ErrDirNotWritable
+	r.ErrorAs(init.Initialize(context.Background()), &dirErr)
+	r.Equal(dir, dirErr.Dir)
+}
+
+func TestPreflight_Preallocate(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("preallocation is only supported on linux")
+	}
+	r := require.New(t)
+	cfg, opts := preflightOpts(t)
+	opts.Preallocate = true
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+	)
+	r.NoError(err)
+
+	layout, err := deriveFilesLayout(cfg, opts)
+	r.NoError(err)
+	err = init.preflight(layout)
+	if errors.Is(err, persistence.ErrPreallocationNotSupported) {
+		t.Skip("preallocation is not supported by the file system")
+	}
+	r.NoError(err)
+
+	// space is allocated without changing the size of the files
+	for i := 0; i < int(layout.NumFiles); i++ {
+		name := filepath.Join(opts.DataDir, shared.InitFileName(i))
+		info, err := os.Stat(name)
+		r.NoError(err)
+		r.Zero(info.Size())
+		usage, err := persistence.DiskUsage(name)
+		r.NoError(err)
+		if usage == 0 {
+			t.Skip("preallocation is not supported by the file system")
+		}
+		r.GreaterOrEqual(usage, opts.MaxFileSize)
+	}
+	files, err := init.missingFiles(layout)
+	r.NoError(err)
+	r.Empty(files)
+
+	r.NoError(init.Initialize(context.Background()))
+	r.Equal(uint64(opts.NumUnits)*cfg.LabelsPerUnit, init.NumLabelsWritten())
+}
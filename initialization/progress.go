@@ -0,0 +1,177 @@
+package initialization
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// rateWindow is the time constant of the moving average used to estimate the initialization rate. Samples older than
+// this have little influence on the estimate.
+const rateWindow = time.Minute
+
+// minSampleInterval is the minimum time between two samples of the initialization rate. Labels written in between
+// are accumulated into the next sample.
+const minSampleInterval = time.Second
+
+// EventKind is the kind of a progress event.
+type EventKind int
+
+const (
+	// EventLabelsWritten is emitted when labels have been written to a file.
+	EventLabelsWritten EventKind = iota
+	// EventBatchComputed is emitted when a device has computed a batch of labels.
+	EventBatchComputed
+	// EventFileCompleted is emitted when all labels of a file have been written.
+	EventFileCompleted
+	// EventNonceFound is emitted when a new best nonce has been found.
+	EventNonceFound
+	// EventDeviceFailed is emitted when a device failed to compute a batch. Its work is handed to the remaining devices.
+	EventDeviceFailed
+	// EventLabelMismatch is emitted when a label computed by a device doesn't match the reference label.
+	EventLabelMismatch
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventLabelsWritten:
+		return "labels written"
+	case EventBatchComputed:
+		return "batch computed"
+	case EventFileCompleted:
+		return "file completed"
+	case EventNonceFound:
+		return "nonce found"
+	case EventDeviceFailed:
+		return "device failed"
+	case EventLabelMismatch:
+		return "label mismatch"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes progress of an initialization. Fields that don't apply to the kind of the event are left empty.
+type Event struct {
+	Kind EventKind
+	Time time.Time
+
+	// FileIndex is the index of the file the event refers to.
+	FileIndex int
+	// ProviderID is the ID of the device the event refers to.
+	ProviderID uint
+
+	// NumLabels is the number of labels written or computed.
+	NumLabels uint64
+	// LabelsPerSecond is the throughput of the device that computed a batch.
+	LabelsPerSecond float64
+
+	// Nonce is the nonce that was found.
+	Nonce uint64
+
+	// Err is the error a device failed with or the label mismatch.
+	Err error
+
+	// Progress is the overall progress of the initialization at the time of the event.
+	Progress Progress
+}
+
+// Progress is a snapshot of the overall progress of an initialization.
+type Progress struct {
+	NumLabelsWritten uint64
+	TargetNumLabels  uint64
+
+	// LabelsPerSecond is a moving average of the rate in which labels are written to disk.
+	LabelsPerSecond float64
+	// ETA is the estimated remaining time until all labels are written. It is zero if the rate isn't known yet.
+	ETA time.Duration
+}
+
+// progressTracker estimates the rate of an initialization and emits events to a handler.
+type progressTracker struct {
+	handler func(Event)
+	now     func() time.Time
+
+	emitMtx sync.Mutex // serializes calls to the handler
+
+	mtx      sync.Mutex
+	written  uint64
+	target   uint64
+	rate     float64   // labels per second
+	sampled  uint64    // labels written since lastTime
+	lastTime time.Time // time of the last sample
+}
+
+func newProgressTracker(handler func(Event)) *progressTracker {
+	return &progressTracker{
+		handler: handler,
+		now:     time.Now,
+	}
+}
+
+// start resets the rate estimate for a new run that has to write labels up to target.
+func (p *progressTracker) start(written, target uint64) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.written = written
+	p.target = target
+	p.rate = 0
+	p.sampled = 0
+	p.lastTime = p.now()
+}
+
+// record adds a number of written labels to the estimate.
+func (p *progressTracker) record(numLabels uint64) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.written += numLabels
+	p.sampled += numLabels
+
+	now := p.now()
+	elapsed := now.Sub(p.lastTime)
+	if elapsed < minSampleInterval {
+		return
+	}
+
+	sample := float64(p.sampled) / elapsed.Seconds()
+	p.sampled = 0
+	p.lastTime = now
+
+	if p.rate == 0 {
+		p.rate = sample
+		return
+	}
+	alpha := 1 - math.Exp(-elapsed.Seconds()/rateWindow.Seconds())
+	p.rate = alpha*sample + (1-alpha)*p.rate
+}
+
+func (p *progressTracker) progress() Progress {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	progress := Progress{
+		NumLabelsWritten: p.written,
+		TargetNumLabels:  p.target,
+		LabelsPerSecond:  p.rate,
+	}
+	if p.rate > 0 && p.target > p.written {
+		progress.ETA = time.Duration(float64(p.target-p.written) / p.rate * float64(time.Second))
+	}
+	return progress
+}
+
+// emit passes an event to the handler. Events are passed to the handler one at a time.
+func (p *progressTracker) emit(e Event) {
+	if p.handler == nil {
+		return
+	}
+
+	p.emitMtx.Lock()
+	defer p.emitMtx.Unlock()
+
+	e.Time = p.now()
+	e.Progress = p.progress()
+	p.handler(e)
+}
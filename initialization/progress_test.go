@@ -0,0 +1,116 @@
+package initialization
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+)
+
+func TestProgressTracker_RateAndETA(t *testing.T) {
+	r := require.New(t)
+
+	now := time.Now()
+	p := newProgressTracker(nil)
+	p.now = func() time.Time { return now }
+
+	p.start(100, 1100)
+	progress := p.progress()
+	r.Equal(uint64(100), progress.NumLabelsWritten)
+	r.Equal(uint64(1100), progress.TargetNumLabels)
+	r.Zero(progress.LabelsPerSecond)
+	r.Zero(progress.ETA)
+
+	// writes within the minimum sample interval are accumulated
+	now = now.Add(500 * time.Millisecond)
+	p.record(50)
+	r.Zero(p.progress().LabelsPerSecond)
+
+	now = now.Add(500 * time.Millisecond)
+	p.record(50)
+	progress = p.progress()
+	r.Equal(uint64(200), progress.NumLabelsWritten)
+	r.InDelta(100, progress.LabelsPerSecond, 0.001)
+	r.Equal(9*time.Second, progress.ETA)
+
+	// the rate moves towards new samples
+	now = now.Add(2 * time.Second)
+	p.record(400)
+	progress = p.progress()
+	r.Greater(progress.LabelsPerSecond, 100.0)
+	r.Less(progress.LabelsPerSecond, 200.0)
+	r.Less(progress.ETA, 9*time.Second)
+
+	// the ETA is zero when all labels are written
+	now = now.Add(2 * time.Second)
+	p.record(500)
+	r.Zero(p.progress().ETA)
+}
+
+func TestInitialize_ProgressEvents(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 12
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits + 1
+	opts.MaxFileSize = 1 << 14
+	opts.ProviderIDs = []uint{CPUProviderID(), CPUProviderID()}
+	opts.ComputeBatchSize = 1 << 8
+
+	var events []Event
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		WithProgressHandler(func(e Event) { events = append(events, e) }),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+
+	numLabels := uint64(opts.NumUnits) * cfg.LabelsPerUnit
+	var written, computed uint64
+	completed := make(map[int]bool)
+	var lastNonce *uint64
+	for _, e := range events {
+		r.False(e.Time.IsZero())
+		r.Equal(numLabels, e.Progress.TargetNumLabels)
+
+		switch e.Kind {
+		case EventLabelsWritten:
+			written += e.NumLabels
+			r.LessOrEqual(written, e.Progress.NumLabelsWritten)
+		case EventBatchComputed:
+			computed += e.NumLabels
+			r.Equal(CPUProviderID(), e.ProviderID)
+			r.Positive(e.LabelsPerSecond)
+		case EventFileCompleted:
+			r.False(completed[e.FileIndex])
+			completed[e.FileIndex] = true
+		case EventNonceFound:
+			nonce := e.Nonce
+			lastNonce = &nonce
+		default:
+			r.Failf("unexpected event", "kind: %s", e.Kind)
+		}
+	}
+	r.Equal(numLabels, written)
+	r.Equal(numLabels, computed)
+	r.Len(completed, opts.TotalFiles(cfg.LabelsPerUnit))
+	r.NotNil(lastNonce)
+	r.Equal(*init.Nonce(), *lastNonce)
+
+	progress := init.Progress()
+	r.Equal(numLabels, progress.NumLabelsWritten)
+	r.Zero(progress.ETA)
+}
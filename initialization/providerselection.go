@@ -0,0 +1,174 @@
+package initialization
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+)
+
+// benchmarkFileName is the name of the file in the data directory that caches the benchmarks of the compute providers
+// of every host.
+const benchmarkFileName = "postdata_benchmark.json"
+
+// ProviderBenchmark is the performance of a compute provider with the given scrypt parameters.
+type ProviderBenchmark struct {
+	Provider
+	Scrypt          config.ScryptParams
+	HashesPerSecond int
+}
+
+// selectProvider returns the ID of the fastest compute provider that isn't excluded by the ProviderSelection of the
+// init options. The providers are benchmarked with the scrypt parameters of the init options once per host, the results
+// are cached in the data directory.
+func (init *Initializer) selectProvider(ctx context.Context) (uint, error) {
+	providers, err := init.openCLProviders()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get compute providers: %w", err)
+	}
+
+	selection := init.opts.ProviderSelection
+	candidates := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		if selection.ExcludeCPU && p.DeviceType == postrs.ClassCPU {
+			continue
+		}
+		if containsProvider(selection.Exclude, p.ID) {
+			continue
+		}
+		candidates = append(candidates, p)
+	}
+	if len(candidates) == 0 {
+		return 0, ErrNoProviders
+	}
+
+	benchmarks, err := init.benchmarkProviders(ctx, candidates)
+	if err != nil {
+		return 0, err
+	}
+	best := benchmarks[0]
+	for _, b := range benchmarks[1:] {
+		if b.HashesPerSecond > best.HashesPerSecond {
+			best = b
+		}
+	}
+
+	init.logger.Info("initialization: selected the fastest compute provider",
+		zap.Uint("providerId", best.ID),
+		zap.String("model", best.Model),
+		zap.Stringer("deviceType", best.DeviceType),
+		zap.Int("hashesPerSecond", best.HashesPerSecond),
+	)
+	return best.ID, nil
+}
+
+// benchmarkProviders returns the benchmarks of the given providers. Benchmarks of the same providers on this host are
+// taken from the cache in the data directory, the others are measured and added to the cache.
+func (init *Initializer) benchmarkProviders(ctx context.Context, providers []Provider) ([]ProviderBenchmark, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host name: %w", err)
+	}
+
+	cache, err := loadBenchmarks(init.opts.DataDir)
+	if err != nil {
+		init.logger.Warn("initialization: ignoring cached benchmarks", zap.Error(err))
+		cache = make(map[string][]ProviderBenchmark)
+	}
+
+	difficulty := init.powDifficultyFunc(uint64(init.opts.NumUnits) * init.cfg.LabelsPerUnit)
+	benchmarks := make([]ProviderBenchmark, 0, len(providers))
+	updated := false
+	for _, p := range providers {
+		if b, ok := cachedBenchmark(cache[host], p, init.opts.Scrypt); ok {
+			init.logger.Debug("initialization: using cached benchmark",
+				zap.Uint("providerId", p.ID),
+				zap.Int("hashesPerSecond", b.HashesPerSecond),
+			)
+			benchmarks = append(benchmarks, b)
+			continue
+		}
+
+		init.logger.Info("initialization: benchmarking compute provider",
+			zap.Uint("providerId", p.ID),
+			zap.String("model", p.Model),
+		)
+		hashes, err := init.benchmark(ctx, p, init.opts.Scrypt, difficulty)
+		if err != nil {
+			return nil, fmt.Errorf("failed to benchmark provider %d: %w", p.ID, err)
+		}
+		b := ProviderBenchmark{Provider: p, Scrypt: init.opts.Scrypt, HashesPerSecond: hashes}
+		benchmarks = append(benchmarks, b)
+		cache[host] = replaceBenchmark(cache[host], b)
+		updated = true
+	}
+
+	if updated {
+		if err := saveBenchmarks(init.opts.DataDir, cache); err != nil {
+			init.logger.Warn("initialization: failed to cache benchmarks", zap.Error(err))
+		}
+	}
+	return benchmarks, nil
+}
+
+// cachedBenchmark returns the cached benchmark of the provider, if the cached provider with the same ID is the same
+// device and was benchmarked with the same scrypt parameters.
+func cachedBenchmark(benchmarks []ProviderBenchmark, p Provider, scrypt config.ScryptParams) (ProviderBenchmark, bool) {
+	for _, b := range benchmarks {
+		if b.Provider == p && b.Scrypt == scrypt {
+			return b, true
+		}
+	}
+	return ProviderBenchmark{}, false
+}
+
+func replaceBenchmark(benchmarks []ProviderBenchmark, b ProviderBenchmark) []ProviderBenchmark {
+	for i := range benchmarks {
+		if benchmarks[i].ID == b.ID {
+			benchmarks[i] = b
+			return benchmarks
+		}
+	}
+	return append(benchmarks, b)
+}
+
+// loadBenchmarks returns the cached benchmarks in the given directory by host name.
+func loadBenchmarks(dir string) (map[string][]ProviderBenchmark, error) {
+	data, err := os.ReadFile(filepath.Join(dir, benchmarkFileName))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return make(map[string][]ProviderBenchmark), nil
+	case err != nil:
+		return nil, err
+	}
+
+	cache := make(map[string][]ProviderBenchmark)
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("invalid benchmark file: %w", err)
+	}
+	return cache, nil
+}
+
+func saveBenchmarks(dir string, cache map[string][]ProviderBenchmark) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dir, benchmarkFileName, data)
+}
+
+func containsProvider(ids []uint, id uint) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package initialization
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+)
+
+func TestInitialize_SelectProvider(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 8
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits
+	opts.ComputeBatchSize = 1 << 6
+	opts.ProviderIDs = nil
+
+	providers := []Provider{
+		{ID: 0, Model: "slow GPU", DeviceType: postrs.ClassGPU},
+		{ID: 7, Model: "fast GPU", DeviceType: postrs.ClassGPU},
+		{ID: CPUProviderID(), Model: "CPU", DeviceType: postrs.ClassCPU},
+	}
+	hashes := map[uint]int{0: 100, 7: 1000, CPUProviderID(): 500}
+	benchmarked := make(map[uint]int)
+	benchmark := func(_ context.Context, p Provider, params config.ScryptParams, _ []byte) (int, error) {
+		r.Equal(opts.Scrypt, params)
+		benchmarked[p.ID]++
+		return hashes[p.ID], nil
+	}
+
+	initialize := func(opts config.InitOpts) *Initializer {
+		init, err := NewInitializer(
+			WithNodeId(nodeId),
+			WithCommitmentAtxId(commitmentAtxId),
+			WithConfig(cfg),
+			WithInitOpts(opts),
+			WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+			withProviders(func() ([]Provider, error) { return providers, nil }, benchmark),
+		)
+		r.NoError(err)
+		r.NoError(init.Initialize(context.Background()))
+		r.NoError(init.Reset()) // the next test case initializes again
+		return init
+	}
+
+	// the fastest provider that isn't excluded is selected
+	opts.ProviderSelection.Exclude = []uint{7}
+	init := initialize(opts)
+	r.Len(init.DeviceHealth(), 1)
+	r.Equal(CPUProviderID(), init.DeviceHealth()[0].ProviderID)
+	r.Equal(map[uint]int{0: 1, CPUProviderID(): 1}, benchmarked)
+
+	// benchmarks are cached in the data directory, only new providers are benchmarked
+	opts.ProviderSelection = config.ProviderSelection{ExcludeCPU: true, Exclude: []uint{7}}
+	init = initialize(opts)
+	r.Equal(uint(0), init.DeviceHealth()[0].ProviderID)
+	r.Equal(map[uint]int{0: 1, CPUProviderID(): 1}, benchmarked)
+
+	cache, err := loadBenchmarks(opts.DataDir)
+	r.NoError(err)
+	r.Len(cache, 1)
+	for _, benchmarks := range cache {
+		r.ElementsMatch([]ProviderBenchmark{
+			{Provider: providers[0], Scrypt: opts.Scrypt, HashesPerSecond: 100},
+			{Provider: providers[2], Scrypt: opts.Scrypt, HashesPerSecond: 500},
+		}, benchmarks)
+	}
+
+	// a different device with the same ID is benchmarked again
+	providers[2].Model = "other CPU"
+	hashes[0] = 1000
+	opts.ProviderSelection = config.ProviderSelection{Exclude: []uint{7}}
+	init = initialize(opts)
+	r.Equal(CPUProviderID(), init.DeviceHealth()[0].ProviderID, "the cached benchmark of provider 0 is used")
+	r.Equal(map[uint]int{0: 1, CPUProviderID(): 2}, benchmarked)
+
+	// providers are benchmarked again with different scrypt parameters
+	opts.Scrypt.N = 32
+	initialize(opts)
+	r.Equal(map[uint]int{0: 2, CPUProviderID(): 3}, benchmarked)
+
+	// failing benchmarks fail the initialization
+	providers[0].Model = "other GPU"
+	errBenchmark := errors.New("benchmark failed")
+	benchmark = func(context.Context, Provider, config.ScryptParams, []byte) (int, error) { return 0, errBenchmark }
+	init, err = NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+		withProviders(func() ([]Provider, error) { return providers, nil }, benchmark),
+	)
+	r.NoError(err)
+	r.ErrorIs(init.Initialize(context.Background()), errBenchmark)
+}
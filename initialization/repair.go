@@ -0,0 +1,214 @@
+package initialization
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/oracle"
+	"github.com/spacemeshos/post/persistence"
+	"github.com/spacemeshos/post/shared"
+)
+
+// LabelRange is a range of label positions, both Start and End are inclusive.
+type LabelRange struct {
+	Start uint64
+	End   uint64
+}
+
+// Repair recomputes the labels of the given ranges with the CPU provider and overwrites them in place. The labels
+// must already be written, Repair never extends a file.
+//
+// If a range contains the stored nonce it is checked again: if its label doesn't satisfy the proof of work anymore the
+// nonce is dropped in favor of the best nonce found in the repaired ranges. If none is found the next call to
+// Initialize searches for a new nonce.
+//
+// The checksums of the repaired files are updated in the manifest, also if Repair fails after some labels were
+// overwritten.
+func (init *Initializer) Repair(ctx context.Context, ranges []LabelRange) (err error) {
+	if !init.mtx.TryLock() {
+		return ErrAlreadyInitializing
+	}
+	defer init.mtx.Unlock()
+
+	layout, err := deriveFilesLayout(init.cfg, init.opts)
+	if err != nil {
+		return err
+	}
+	lastFileIndex := layout.FirstFileIdx + int(layout.NumFiles) - 1
+	lastLabel := firstLabelInFile(lastFileIndex, init.opts) + layout.LastFileNumLabels - 1
+
+	ranges = append([]LabelRange(nil), ranges...)
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	for _, r := range ranges {
+		if r.Start > r.End {
+			return fmt.Errorf("invalid range: start (%d) must not be greater than end (%d)", r.Start, r.End)
+		}
+		if r.Start < firstLabelInFile(layout.FirstFileIdx, init.opts) || r.End > lastLabel {
+			return fmt.Errorf("invalid range: labels %d to %d are not part of the layout", r.Start, r.End)
+		}
+	}
+
+	wo, err := init.cpuOracle()
+	if err != nil {
+		return err
+	}
+	defer wo.Close()
+
+	if nonce := init.nonce.Load(); nonce != nil {
+		for _, r := range ranges {
+			if r.Start <= *nonce && *nonce <= r.End {
+				if err := init.reevaluateNonce(ctx, wo, *nonce); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	repaired := make(map[int]bool)
+	defer func() {
+		if len(repaired) == 0 {
+			return
+		}
+		// The checksums are also updated if ctx was canceled, the files were already overwritten.
+		uErr := init.updateChecksums(withoutCancel(ctx), repaired)
+		switch {
+		case uErr == nil:
+		case err == nil:
+			err = uErr
+		default:
+			init.logger.Error("initialization: failed to update checksums of repaired files", zap.Error(uErr))
+		}
+	}()
+
+	maxFileNumLabels := init.opts.MaxFileNumLabels()
+	for _, r := range ranges {
+		// split ranges at file boundaries and into batches
+		for start := r.Start; start <= r.End; {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			fileIndex := int(start / maxFileNumLabels)
+			fileStart := firstLabelInFile(fileIndex, init.opts)
+			end := start + init.opts.ComputeBatchSize - 1
+			if fileEnd := fileStart + maxFileNumLabels - 1; end > fileEnd {
+				end = fileEnd
+			}
+			if end > r.End {
+				end = r.End
+			}
+
+			repaired[fileIndex] = true
+			if err := init.repairBatch(ctx, wo, fileIndex, start, end); err != nil {
+				return err
+			}
+			start = end + 1
+		}
+	}
+	return nil
+}
+
+func (init *Initializer) repairBatch(ctx context.Context, wo *oracle.WorkOracle, fileIndex int, start, end uint64) error {
+	init.logger.Info("initialization: repairing labels",
+		zap.Int("fileIndex", fileIndex),
+		zap.Uint64("startPosition", start),
+		zap.Uint64("endPosition", end),
+	)
+
+	res, err := wo.PositionsWithContext(ctx, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to compute labels %d to %d: %w", start, end, err)
+	}
+
+	writer, err := persistence.OpenLabelsRangeWriter(init.storage, fileIndex, config.BitsPerLabel)
+	if err != nil {
+		return err
+	}
+	if err := writer.WriteAt(start-firstLabelInFile(fileIndex, init.opts), res.Output); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write labels %d to %d: %w", start, end, err)
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	if res.Nonce != nil {
+		candidate := res.Output[(*res.Nonce-start)*postrs.LabelLength:]
+		init.updateNonce(wo.ProviderID(), *res.Nonce, candidate[:postrs.LabelLength], fileIndex)
+	}
+	return nil
+}
+
+// updateChecksums hashes the given files again and stores their checksums in the manifest. Files that aren't listed in
+// the manifest aren't completely initialized yet, their checksum is computed once they are.
+func (init *Initializer) updateChecksums(ctx context.Context, files map[int]bool) error {
+	manifest, err := LoadManifest(init.opts.DataDir)
+	if err != nil {
+		return err
+	}
+
+	for index := range files {
+		if _, ok := manifest.Files[index]; !ok {
+			continue
+		}
+
+		name := shared.InitFileName(index)
+		info, err := init.storage.Stat(name)
+		if err != nil {
+			return err
+		}
+		h := newFileHasher()
+		if err := hashFile(ctx, init.storage, name, info.Size, h); err != nil {
+			return fmt.Errorf("failed to hash file %d: %w", index, err)
+		}
+		manifest.Files[index] = FileChecksum{Size: uint64(info.Size), Checksum: h.Sum(nil)}
+		init.logger.Info("initialization: updated checksum of repaired file", zap.Int("fileIndex", index))
+	}
+
+	if err := SaveManifest(init.opts.DataDir, manifest); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return nil
+}
+
+// reevaluateNonce recomputes the label of the stored nonce. If it still satisfies the proof of work its value is
+// updated, otherwise the nonce is dropped.
+func (init *Initializer) reevaluateNonce(ctx context.Context, wo *oracle.WorkOracle, nonce uint64) error {
+	res, err := wo.PositionWithContext(ctx, nonce)
+	if err != nil {
+		return fmt.Errorf("failed to compute label of nonce %d: %w", nonce, err)
+	}
+
+	init.nonceMtx.Lock()
+	defer init.nonceMtx.Unlock()
+
+	if res.Nonce == nil {
+		init.logger.Warn("initialization: stored nonce is invalid, dropping it", zap.Uint64("nonce", nonce))
+		init.nonce.Store(nil)
+		init.nonceValue = nil
+	} else {
+		init.logger.Info("initialization: stored nonce is valid", zap.Uint64("nonce", nonce))
+		init.nonceValue = res.Output
+	}
+	return init.saveMetadataLocked()
+}
+
+// withoutCancel returns a context with the values of ctx that isn't canceled when ctx is.
+func withoutCancel(ctx context.Context) context.Context {
+	return uncanceledContext{ctx}
+}
+
+type uncanceledContext struct {
+	context.Context
+}
+
+func (uncanceledContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (uncanceledContext) Done() <-chan struct{}       { return nil }
+func (uncanceledContext) Err() error                  { return nil }
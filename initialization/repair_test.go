@@ -0,0 +1,168 @@
+package initialization
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestRepair(t *testing.T) {
+	r := require.New(t)
+	init, opts := initializeForDataCheck(t)
+
+	expected, err := initData(opts.DataDir)
+	r.NoError(err)
+
+	// corrupt the end of file 0 and the beginning of file 1
+	fileNumLabels := opts.MaxFileNumLabels()
+	for _, index := range []int{0, 1} {
+		path := filepath.Join(opts.DataDir, shared.InitFileName(index))
+		data, err := os.ReadFile(path)
+		r.NoError(err)
+		if index == 0 {
+			copy(data[len(data)-10*postrs.LabelLength:], make([]byte, 10*postrs.LabelLength))
+		} else {
+			copy(data, make([]byte, 10*postrs.LabelLength))
+		}
+		r.NoError(os.WriteFile(path, data, shared.OwnerReadWrite))
+	}
+
+	r.NoError(init.Repair(context.Background(), []LabelRange{{Start: fileNumLabels - 10, End: fileNumLabels + 9}}))
+
+	actual, err := initData(opts.DataDir)
+	r.NoError(err)
+	r.Equal(expected, actual)
+}
+
+func TestRepair_UpdatesChecksums(t *testing.T) {
+	r := require.New(t)
+	init, opts := initializeForDataCheck(t)
+
+	expected, err := initData(opts.DataDir)
+	r.NoError(err)
+
+	// labels that were already corrupted when they were written are part of the checksum of the file
+	path := filepath.Join(opts.DataDir, shared.InitFileName(1))
+	data, err := os.ReadFile(path)
+	r.NoError(err)
+	copy(data, make([]byte, 10*postrs.LabelLength))
+	r.NoError(os.WriteFile(path, data, shared.OwnerReadWrite))
+	r.NoError(init.updateChecksums(context.Background(), map[int]bool{1: true}))
+
+	report, err := VerifyChecksums(context.Background(), opts.DataDir)
+	r.NoError(err)
+	r.True(report.OK())
+
+	start := firstLabelInFile(1, opts)
+	r.NoError(init.Repair(context.Background(), []LabelRange{{Start: start, End: start + 9}}))
+
+	actual, err := initData(opts.DataDir)
+	r.NoError(err)
+	r.Equal(expected, actual)
+
+	report, err = VerifyChecksums(context.Background(), opts.DataDir)
+	r.NoError(err)
+	r.True(report.OK())
+	r.Len(report.Valid, opts.TotalFiles(1<<12))
+}
+
+func TestRepair_UpdatesChecksumsWhenCanceled(t *testing.T) {
+	r := require.New(t)
+	init, opts := initializeForDataCheck(t)
+
+	path := filepath.Join(opts.DataDir, shared.InitFileName(0))
+	data, err := os.ReadFile(path)
+	r.NoError(err)
+	copy(data[len(data)-10*postrs.LabelLength:], make([]byte, 10*postrs.LabelLength))
+	r.NoError(os.WriteFile(path, data, shared.OwnerReadWrite))
+	r.NoError(init.updateChecksums(context.Background(), map[int]bool{0: true}))
+
+	// cancel once file 0 is repaired and file 1 is about to be
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batches := 0
+	init.logger = zaptest.NewLogger(t, zaptest.WrapOptions(zap.Hooks(func(e zapcore.Entry) error {
+		if e.Message == "initialization: repairing labels" {
+			if batches++; batches == 2 {
+				cancel()
+			}
+		}
+		return nil
+	})))
+
+	fileNumLabels := opts.MaxFileNumLabels()
+	err = init.Repair(ctx, []LabelRange{{Start: fileNumLabels - 10, End: fileNumLabels + 9}})
+	r.ErrorIs(err, context.Canceled)
+
+	report, err := VerifyChecksums(context.Background(), opts.DataDir)
+	r.NoError(err)
+	r.True(report.OK(), "the checksum of file 0 is updated")
+}
+
+func TestRepair_InvalidRanges(t *testing.T) {
+	r := require.New(t)
+	init, opts := initializeForDataCheck(t)
+	numLabels := opts.TotalLabels(1 << 12)
+
+	r.Error(init.Repair(context.Background(), []LabelRange{{Start: 10, End: 9}}))
+	r.Error(init.Repair(context.Background(), []LabelRange{{Start: numLabels - 1, End: numLabels}}))
+
+	// labels that aren't written can't be repaired
+	path := filepath.Join(opts.DataDir, shared.InitFileName(0))
+	r.NoError(os.Truncate(path, 10*postrs.LabelLength))
+	r.Error(init.Repair(context.Background(), []LabelRange{{Start: 5, End: 15}}))
+}
+
+func TestRepair_ReevaluatesNonce(t *testing.T) {
+	r := require.New(t)
+	_, opts := initializeForDataCheck(t)
+
+	m, err := LoadMetadata(opts.DataDir)
+	r.NoError(err)
+	nonce := *m.Nonce
+	nonceValue := m.NonceValue
+
+	// store a nonce that doesn't satisfy the proof of work
+	invalid := nonce + 1
+	if invalid == opts.TotalLabels(1<<12) {
+		invalid = nonce - 1
+	}
+	m.Nonce = &invalid
+	m.NonceValue = make([]byte, postrs.LabelLength)
+	r.NoError(SaveMetadata(opts.DataDir, m))
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 12
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+	)
+	r.NoError(err)
+	r.Equal(invalid, *init.Nonce())
+
+	// repairing the range with both nonces drops the invalid one and finds the valid one again
+	start, end := nonce, invalid
+	if start > end {
+		start, end = end, start
+	}
+	r.NoError(init.Repair(context.Background(), []LabelRange{{Start: start, End: end}}))
+	r.Equal(nonce, *init.Nonce())
+
+	m, err = LoadMetadata(opts.DataDir)
+	r.NoError(err)
+	r.Equal(nonce, *m.Nonce)
+	r.Equal(nonceValue, m.NonceValue)
+}
@@ -0,0 +1,415 @@
+package initialization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/persistence"
+	"github.com/spacemeshos/post/shared"
+)
+
+// batch is a range of labels that is computed by a single call to a work oracle.
+type batch struct {
+	file  *fileJob
+	start uint64 // position of the first label of the batch
+	end   uint64 // position of the last label of the batch (inclusive)
+}
+
+func (b batch) numLabels() uint64 {
+	return b.end - b.start + 1
+}
+
+// fileJob tracks the progress of a single file.
+type fileJob struct {
+	index     int
+	offset    uint64 // position of the first label in the file
+	numLabels uint64
+
+	// next is the (file relative) position of the next label to be handed out. It is guarded by the scheduler, like
+	// opened and opening.
+	next    uint64
+	opened  bool // the writer was opened and the labels written before were hashed
+	opening bool // a caller of next is opening the file, no batches are handed out until it is done
+
+	mtx      sync.Mutex
+	written  uint64             // number of labels written to the file
+	computed map[uint64]*[]byte // computed batches waiting for their turn to be written, by relative position
+	writer   *persistence.FileWriter
+	hasher   hash.Hash // hash of the labels written to the file
+}
+
+func (f *fileJob) checksum() FileChecksum {
+	return FileChecksum{
+		Size:     shared.DataSize(f.written, config.BitsPerLabel),
+		Checksum: f.hasher.Sum(nil),
+	}
+}
+
+// scheduler hands out batches of labels to the work oracles that compute them. Batches are handed out in file order
+// to whichever oracle asks for work next, so faster devices compute more batches than slower ones, and batches of a
+// failed device are handed out again to the remaining ones.
+//
+// Every oracle asks for batches of its own size, see BatchSizeTuning. A batch of a failed device that is larger than
+// the size asked for is split.
+//
+// Computed batches are written to their file strictly in order, independent of the order in which they were computed.
+// The size of every file therefore always reflects its progress, which allows to resume initialization after a restart
+// even if files were completed out of order.
+type scheduler struct {
+	storage persistence.Storage
+	logger  *zap.Logger
+
+	// onWrite is called after labels have been written to a file.
+	onWrite func(fileIndex int, numLabels uint64)
+	// onFileCompleted is called after all labels of a file have been written.
+	onFileCompleted func(fileIndex int, checksum FileChecksum)
+	// release is called with the output of a batch once it isn't needed anymore, i.e. after it was written or
+	// dropped, so that its buffer can be reused.
+	release func(output *[]byte)
+
+	mtx  sync.Mutex
+	wake chan struct{} // closed and replaced whenever the state of the scheduler changes
+
+	files      []*fileJob // files that aren't completed yet, in order
+	current    int        // index in files of the file batches are handed out from
+	retry      []batch    // batches of failed devices
+	pending    int        // batches handed out but not yet written
+	maxPending int
+	remaining  int // number of files that aren't completed yet
+}
+
+// newScheduler creates a scheduler for the files of the given layout. Files that are already completely written are
+// skipped. It returns the scheduler and the number of labels that are already written to the files of the layout.
+func newScheduler(storage persistence.Storage, layout filesLayout, maxPending int, logger *zap.Logger) (*scheduler, uint64, error) {
+	s := &scheduler{
+		storage:         storage,
+		logger:          logger,
+		onWrite:         func(int, uint64) {},
+		onFileCompleted: func(int, FileChecksum) {},
+		release:         func(*[]byte) {},
+		wake:            make(chan struct{}),
+		maxPending:      maxPending,
+	}
+
+	lastFileIndex := layout.FirstFileIdx + int(layout.NumFiles) - 1
+
+	var numLabelsWritten uint64
+	for i := layout.FirstFileIdx; i <= lastFileIndex; i++ {
+		fileNumLabels := layout.FileNumLabels
+		if i == lastFileIndex {
+			fileNumLabels = layout.LastFileNumLabels
+		}
+
+		info, err := storage.Stat(shared.InitFileName(i))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, 0, err
+		case uint64(info.Size) == shared.DataSize(fileNumLabels, config.BitsPerLabel):
+			logger.Info("initialization: file already initialized",
+				zap.Int("fileIndex", i),
+				zap.Uint64("targetNumLabels", fileNumLabels),
+			)
+			numLabelsWritten += fileNumLabels
+			continue
+		default:
+			n := shared.NumLabels(uint64(info.Size), config.BitsPerLabel)
+			if n > fileNumLabels {
+				n = fileNumLabels
+			}
+			numLabelsWritten += n
+		}
+
+		s.files = append(s.files, &fileJob{
+			index:     i,
+			offset:    uint64(i) * layout.FileNumLabels,
+			numLabels: fileNumLabels,
+			computed:  make(map[uint64]*[]byte),
+		})
+	}
+	s.remaining = len(s.files)
+
+	return s, numLabelsWritten, nil
+}
+
+// next returns the next batch to compute, with at most batchSize labels. It blocks until a batch is available or the
+// context is canceled. If all files are completed it returns false.
+func (s *scheduler) next(ctx context.Context, batchSize uint64) (batch, bool, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return batch{}, false, err
+		}
+
+		s.mtx.Lock()
+		b, ok, open := s.nextLocked(batchSize)
+		done := s.remaining == 0
+		wake := s.wake
+		s.mtx.Unlock()
+
+		switch {
+		case open != nil:
+			if err := s.open(ctx, open); err != nil {
+				return batch{}, false, err
+			}
+			continue
+		case ok:
+			return b, true, nil
+		case done:
+			return batch{}, false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return batch{}, false, ctx.Err()
+		case <-wake:
+		}
+	}
+}
+
+// nextLocked returns the next batch to compute. If the file of the next batch has to be opened first, it is returned
+// instead and marked as opening; the caller has to open it with open. The caller must hold the scheduler's lock.
+func (s *scheduler) nextLocked(batchSize uint64) (batch, bool, *fileJob) {
+	if len(s.retry) > 0 {
+		b := s.retry[0]
+		if b.numLabels() <= batchSize {
+			s.retry = s.retry[1:]
+			return b, true, nil
+		}
+
+		// the remainder of the batch stays in the queue and is pending as a batch of its own
+		s.retry[0].start += batchSize
+		b.end = b.start + batchSize - 1
+		s.pending++
+		return b, true, nil
+	}
+
+	if s.pending >= s.maxPending {
+		return batch{}, false, nil
+	}
+
+	for i := s.current; i < len(s.files); i++ {
+		f := s.files[i]
+		switch {
+		case f.opening:
+			// batches of the following files are handed out in the meantime
+			continue
+		case !f.opened:
+			f.opening = true
+			return batch{}, false, f
+		case f.next == f.numLabels:
+			if i == s.current {
+				s.current++
+			}
+			continue
+		}
+
+		size := batchSize
+		if remaining := f.numLabels - f.next; remaining < size {
+			size = remaining
+		}
+		b := batch{
+			file:  f,
+			start: f.offset + f.next,
+			end:   f.offset + f.next + size - 1,
+		}
+		f.next += size
+		s.pending++
+		return b, true, nil
+	}
+
+	return batch{}, false, nil
+}
+
+// open opens the writer of a file that was marked as opening by nextLocked and determines how many labels are already
+// written to it. The labels written before are hashed without holding the scheduler's lock, which can take a while for
+// large files.
+func (s *scheduler) open(ctx context.Context, f *fileJob) error {
+	writer, numLabelsWritten, hasher, err := s.openWriter(ctx, f)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	defer s.notify()
+
+	f.opening = false
+	if err != nil {
+		return err
+	}
+
+	f.opened = true
+	f.writer = writer
+	f.hasher = hasher
+	f.written = numLabelsWritten
+	f.next = numLabelsWritten
+
+	if f.written == f.numLabels {
+		s.onFileCompleted(f.index, f.checksum())
+		return s.closeFile(f)
+	}
+	return nil
+}
+
+// openWriter opens the writer of a file, truncates it to the labels that are completely written and hashes them.
+func (s *scheduler) openWriter(ctx context.Context, f *fileJob) (*persistence.FileWriter, uint64, hash.Hash, error) {
+	writer, err := persistence.OpenLabelsWriter(s.storage, f.index, config.BitsPerLabel)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	numLabelsWritten, err := writer.NumLabelsWritten()
+	if err != nil {
+		writer.Close()
+		return nil, 0, nil, err
+	}
+
+	fields := []zap.Field{
+		zap.Int("fileIndex", f.index),
+		zap.Uint64("currentNumLabels", numLabelsWritten),
+		zap.Uint64("targetNumLabels", f.numLabels),
+		zap.Uint64("startPosition", f.offset),
+	}
+
+	switch {
+	case numLabelsWritten >= f.numLabels:
+		s.logger.Info("initialization: truncating file", fields...)
+		numLabelsWritten = f.numLabels
+	case numLabelsWritten > 0:
+		s.logger.Info("initialization: continuing to write file", fields...)
+	default:
+		s.logger.Info("initialization: starting to write file", fields...)
+	}
+
+	// Truncating also removes a partially written label at the end of the file, e.g. after a crash.
+	if err := writer.Truncate(numLabelsWritten); err != nil {
+		writer.Close()
+		return nil, 0, nil, err
+	}
+
+	// The checksum of the file is computed while writing, labels written before have to be hashed first.
+	hasher := newFileHasher()
+	size := int64(shared.DataSize(numLabelsWritten, config.BitsPerLabel))
+	if err := hashFile(ctx, s.storage, shared.InitFileName(f.index), size, hasher); err != nil {
+		writer.Close()
+		return nil, 0, nil, fmt.Errorf("failed to hash file %d: %w", f.index, err)
+	}
+	return writer, numLabelsWritten, hasher, nil
+}
+
+// complete writes a computed batch to its file. Batches of a file that are completed out of order are kept in memory
+// until all batches before them are written.
+func (s *scheduler) complete(b batch, output *[]byte) error {
+	f := b.file
+
+	f.mtx.Lock()
+	f.computed[b.start-f.offset] = output
+	numBatches := 0
+	numLabels := uint64(0)
+	for {
+		out, ok := f.computed[f.written]
+		if !ok {
+			break
+		}
+		if err := f.writer.Write(*out); err != nil {
+			f.mtx.Unlock()
+			return err
+		}
+		f.hasher.Write(*out)
+		delete(f.computed, f.written)
+
+		n := shared.NumLabels(uint64(len(*out)), config.BitsPerLabel)
+		s.release(out)
+		f.written += n
+		numLabels += n
+		numBatches++
+	}
+
+	var err error
+	var checksum FileChecksum
+	done := f.written == f.numLabels
+	if done {
+		checksum = f.checksum()
+		if err = f.writer.Flush(); err == nil {
+			s.logger.Info("initialization: completed",
+				zap.Int("fileIndex", f.index),
+				zap.Uint64("numLabelsWritten", f.written),
+			)
+		}
+	}
+	f.mtx.Unlock()
+
+	if numLabels > 0 {
+		s.onWrite(f.index, numLabels)
+	}
+	if done && err == nil {
+		s.onFileCompleted(f.index, checksum)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.pending -= numBatches
+	if done {
+		if cErr := s.closeFile(f); err == nil {
+			err = cErr
+		}
+	}
+	s.notify()
+	return err
+}
+
+// reschedule hands a batch that couldn't be computed out again.
+func (s *scheduler) reschedule(b batch) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.retry = append(s.retry, b)
+	s.notify()
+}
+
+// closeFile closes the writer of a completed file. The caller must hold the scheduler's lock.
+func (s *scheduler) closeFile(f *fileJob) error {
+	s.remaining--
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if err := f.writer.Close(); err != nil {
+		return fmt.Errorf("failed to close file %d: %w", f.index, err)
+	}
+	f.writer = nil
+	return nil
+}
+
+// close flushes and closes the writers of all files that aren't completed yet. Computed batches that couldn't be
+// written yet are dropped, they will be computed again when initialization is resumed.
+func (s *scheduler) close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var err error
+	for _, f := range s.files {
+		f.mtx.Lock()
+		if f.writer != nil {
+			if cErr := f.writer.Close(); cErr != nil && err == nil {
+				err = fmt.Errorf("failed to close file %d: %w", f.index, cErr)
+			}
+			f.writer = nil
+		}
+		for start, out := range f.computed {
+			s.release(out)
+			delete(f.computed, start)
+		}
+		f.mtx.Unlock()
+	}
+	return err
+}
+
+// notify wakes up all callers waiting for a batch. The caller must hold the scheduler's lock.
+func (s *scheduler) notify() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
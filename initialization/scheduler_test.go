@@ -0,0 +1,289 @@
+package initialization
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/persistence"
+	"github.com/spacemeshos/post/shared"
+)
+
+func labelsOf(b batch) *[]byte {
+	out := make([]byte, 0, b.numLabels()*postrs.LabelLength)
+	for i := b.start; i <= b.end; i++ {
+		label := make([]byte, postrs.LabelLength)
+		label[0] = byte(i)
+		out = append(out, label...)
+	}
+	return &out
+}
+
+func TestScheduler_WritesBatchesInOrder(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 32
+
+	opts := config.DefaultInitOpts()
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = 2
+	opts.MaxFileSize = 32 * postrs.LabelLength
+	opts.ComputeBatchSize = 8
+
+	layout, err := deriveFilesLayout(cfg, opts)
+	r.NoError(err)
+
+	s, numLabelsWritten, err := newScheduler(persistence.NewDirStorage(opts.DataDir), layout, 16, zaptest.NewLogger(t))
+	r.NoError(err)
+	r.Zero(numLabelsWritten)
+
+	// hand out all batches and complete them in reverse order
+	var batches []batch
+	for i := 0; i < 8; i++ {
+		b, ok, err := s.next(context.Background(), opts.ComputeBatchSize)
+		r.NoError(err)
+		r.True(ok)
+		batches = append(batches, b)
+	}
+	for i := len(batches) - 1; i >= 0; i-- {
+		r.NoError(s.complete(batches[i], labelsOf(batches[i])))
+	}
+
+	_, ok, err := s.next(context.Background(), opts.ComputeBatchSize)
+	r.NoError(err)
+	r.False(ok)
+	r.NoError(s.close())
+
+	for i := 0; i < 2; i++ {
+		data, err := os.ReadFile(filepath.Join(opts.DataDir, shared.InitFileName(i)))
+		r.NoError(err)
+		r.Len(data, 32*postrs.LabelLength)
+		for j := 0; j < 32; j++ {
+			r.Equal(byte(i*32+j), data[j*postrs.LabelLength])
+		}
+	}
+}
+
+func TestScheduler_ResumesOutOfOrderFiles(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 32
+
+	opts := config.DefaultInitOpts()
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = 3
+	opts.MaxFileSize = 32 * postrs.LabelLength
+	opts.ComputeBatchSize = 8
+
+	layout, err := deriveFilesLayout(cfg, opts)
+	r.NoError(err)
+
+	// file 1 is complete, file 0 is partially written with a torn label at the end, file 2 is missing
+	full := make([]byte, 32*postrs.LabelLength)
+	r.NoError(os.WriteFile(filepath.Join(opts.DataDir, shared.InitFileName(1)), full, shared.OwnerReadWrite))
+	partial := make([]byte, 10*postrs.LabelLength+3)
+	r.NoError(os.WriteFile(filepath.Join(opts.DataDir, shared.InitFileName(0)), partial, shared.OwnerReadWrite))
+
+	s, numLabelsWritten, err := newScheduler(persistence.NewDirStorage(opts.DataDir), layout, 16, zaptest.NewLogger(t))
+	r.NoError(err)
+	r.Equal(uint64(32+10), numLabelsWritten)
+
+	var starts []uint64
+	for {
+		b, ok, err := s.next(context.Background(), opts.ComputeBatchSize)
+		r.NoError(err)
+		if !ok {
+			break
+		}
+		starts = append(starts, b.start)
+		r.NoError(s.complete(b, labelsOf(b)))
+	}
+	r.NoError(s.close())
+
+	r.Equal([]uint64{10, 18, 26, 64, 72, 80, 88}, starts)
+	for i := 0; i < 3; i++ {
+		info, err := os.Stat(filepath.Join(opts.DataDir, shared.InitFileName(i)))
+		r.NoError(err)
+		r.EqualValues(32*postrs.LabelLength, info.Size())
+	}
+}
+
+// blockingStorage blocks the first Open of a file until released, e.g. while it is hashed.
+type blockingStorage struct {
+	persistence.Storage
+	name     string
+	opened   chan struct{}
+	released chan struct{}
+	once     sync.Once
+}
+
+func (s *blockingStorage) Open(name string) (persistence.File, error) {
+	if name == s.name {
+		s.once.Do(func() {
+			close(s.opened)
+			<-s.released
+		})
+	}
+	return s.Storage.Open(name)
+}
+
+func TestScheduler_OpensFilesWithoutBlocking(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 32
+
+	opts := config.DefaultInitOpts()
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = 2
+	opts.MaxFileSize = 32 * postrs.LabelLength
+	opts.ComputeBatchSize = 8
+
+	layout, err := deriveFilesLayout(cfg, opts)
+	r.NoError(err)
+
+	partial := make([]byte, 10*postrs.LabelLength)
+	r.NoError(os.WriteFile(filepath.Join(opts.DataDir, shared.InitFileName(0)), partial, shared.OwnerReadWrite))
+
+	storage := &blockingStorage{
+		Storage:  persistence.NewDirStorage(opts.DataDir),
+		name:     shared.InitFileName(0),
+		opened:   make(chan struct{}),
+		released: make(chan struct{}),
+	}
+	s, _, err := newScheduler(storage, layout, 16, zaptest.NewLogger(t))
+	r.NoError(err)
+
+	// the labels written to file 0 are hashed while it is opened
+	ctx, cancel := context.WithCancel(context.Background())
+	opened := make(chan error, 1)
+	go func() {
+		_, _, err := s.next(ctx, opts.ComputeBatchSize)
+		opened <- err
+	}()
+	<-storage.opened
+
+	// other callers get batches of the next file in the meantime
+	b, ok, err := s.next(context.Background(), opts.ComputeBatchSize)
+	r.NoError(err)
+	r.True(ok)
+	r.Equal(uint64(32), b.start)
+	r.NoError(s.complete(b, labelsOf(b)))
+
+	// canceling the context stops hashing, the file is opened again by the next caller
+	cancel()
+	close(storage.released)
+	r.ErrorIs(<-opened, context.Canceled)
+
+	var starts []uint64
+	for {
+		b, ok, err := s.next(context.Background(), opts.ComputeBatchSize)
+		r.NoError(err)
+		if !ok {
+			break
+		}
+		starts = append(starts, b.start)
+		r.NoError(s.complete(b, labelsOf(b)))
+	}
+	r.NoError(s.close())
+	r.Equal([]uint64{10, 18, 26, 40, 48, 56}, starts)
+}
+
+func TestScheduler_Reschedule(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 32
+
+	opts := config.DefaultInitOpts()
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = 1
+	opts.MaxFileSize = 32 * postrs.LabelLength
+	opts.ComputeBatchSize = 16
+
+	layout, err := deriveFilesLayout(cfg, opts)
+	r.NoError(err)
+
+	s, _, err := newScheduler(persistence.NewDirStorage(opts.DataDir), layout, 1, zaptest.NewLogger(t))
+	r.NoError(err)
+
+	first, ok, err := s.next(context.Background(), opts.ComputeBatchSize)
+	r.NoError(err)
+	r.True(ok)
+
+	// the number of pending batches is exhausted
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = s.next(ctx, opts.ComputeBatchSize)
+	r.ErrorIs(err, context.Canceled)
+
+	// a failed batch is handed out again
+	s.reschedule(first)
+	retried, ok, err := s.next(context.Background(), opts.ComputeBatchSize)
+	r.NoError(err)
+	r.True(ok)
+	r.Equal(first.start, retried.start)
+	r.Equal(first.end, retried.end)
+
+	r.NoError(s.complete(retried, labelsOf(retried)))
+	second, ok, err := s.next(context.Background(), opts.ComputeBatchSize)
+	r.NoError(err)
+	r.True(ok)
+	r.NoError(s.complete(second, labelsOf(second)))
+
+	_, ok, err = s.next(context.Background(), opts.ComputeBatchSize)
+	r.NoError(err)
+	r.False(ok)
+	r.NoError(s.close())
+}
+
+func TestScheduler_SplitsRescheduledBatches(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 32
+
+	opts := config.DefaultInitOpts()
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = 1
+	opts.MaxFileSize = 32 * postrs.LabelLength
+
+	layout, err := deriveFilesLayout(cfg, opts)
+	r.NoError(err)
+
+	s, _, err := newScheduler(persistence.NewDirStorage(opts.DataDir), layout, 2, zaptest.NewLogger(t))
+	r.NoError(err)
+
+	// a batch of a device with a large batch size fails and is handed to a device with a smaller one
+	large, ok, err := s.next(context.Background(), 32)
+	r.NoError(err)
+	r.True(ok)
+	s.reschedule(large)
+
+	var starts []uint64
+	for {
+		b, ok, err := s.next(context.Background(), 12)
+		r.NoError(err)
+		if !ok {
+			break
+		}
+		r.LessOrEqual(b.numLabels(), uint64(12))
+		starts = append(starts, b.start)
+		r.NoError(s.complete(b, labelsOf(b)))
+	}
+	r.NoError(s.close())
+
+	r.Equal([]uint64{0, 12, 24}, starts)
+	data, err := os.ReadFile(filepath.Join(opts.DataDir, shared.InitFileName(0)))
+	r.NoError(err)
+	r.Len(data, 32*postrs.LabelLength)
+}
@@ -0,0 +1,67 @@
+package initialization
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+
+	"github.com/spacemeshos/post/config"
+)
+
+// VerificationStats are counters of the verification of computed labels against the CPU reference.
+type VerificationStats struct {
+	LabelsChecked uint64 // labels compared with the reference
+	Mismatches    uint64 // batches that failed verification
+	Retries       uint64 // batches computed again on the same device after a mismatch
+	Rescheduled   uint64 // batches handed to the remaining devices after a device was given up
+}
+
+type verificationCounters struct {
+	labelsChecked atomic.Uint64
+	mismatches    atomic.Uint64
+	retries       atomic.Uint64
+	rescheduled   atomic.Uint64
+}
+
+func (c *verificationCounters) stats() VerificationStats {
+	return VerificationStats{
+		LabelsChecked: c.labelsChecked.Load(),
+		Mismatches:    c.mismatches.Load(),
+		Retries:       c.retries.Load(),
+		Rescheduled:   c.rescheduled.Load(),
+	}
+}
+
+// verificationPositions returns the sorted positions of the labels of a batch that are checked according to the
+// policy. The last label of the batch is always checked.
+func verificationPositions(policy config.VerificationPolicy, b batch) []uint64 {
+	numLabels := b.numLabels()
+
+	var n uint64
+	switch policy.Mode {
+	case config.VerifyRandomLabels:
+		n = uint64(policy.Labels)
+	case config.VerifyPercentage:
+		n = uint64(math.Ceil(float64(numLabels) * policy.Percentage / 100))
+	}
+	if n >= numLabels {
+		positions := make([]uint64, 0, numLabels)
+		for p := b.start; p <= b.end; p++ {
+			positions = append(positions, p)
+		}
+		return positions
+	}
+
+	selected := map[uint64]struct{}{b.end: {}}
+	for uint64(len(selected)) < n+1 {
+		selected[b.start+uint64(rand.Int63n(int64(numLabels)))] = struct{}{}
+	}
+
+	positions := make([]uint64, 0, len(selected))
+	for p := range selected {
+		positions = append(positions, p)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+	return positions
+}
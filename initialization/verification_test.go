@@ -0,0 +1,281 @@
+package initialization
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/oracle"
+)
+
+func TestVerificationPositions(t *testing.T) {
+	b := batch{start: 100, end: 199}
+
+	t.Run("last label", func(t *testing.T) {
+		policy := config.VerificationPolicy{Mode: config.VerifyLastLabel}
+		require.Equal(t, []uint64{199}, verificationPositions(policy, b))
+	})
+
+	t.Run("random labels", func(t *testing.T) {
+		policy := config.VerificationPolicy{Mode: config.VerifyRandomLabels, Labels: 10}
+		positions := verificationPositions(policy, b)
+		require.Len(t, positions, 11)
+		require.Equal(t, uint64(199), positions[len(positions)-1])
+		for i, p := range positions {
+			require.GreaterOrEqual(t, p, b.start)
+			require.LessOrEqual(t, p, b.end)
+			if i > 0 {
+				require.Greater(t, p, positions[i-1])
+			}
+		}
+	})
+
+	t.Run("percentage", func(t *testing.T) {
+		policy := config.VerificationPolicy{Mode: config.VerifyPercentage, Percentage: 2.5}
+		positions := verificationPositions(policy, b)
+		require.Len(t, positions, 4) // ceil(2.5) random labels and the last one
+		require.Equal(t, uint64(199), positions[len(positions)-1])
+	})
+
+	t.Run("more labels than in batch", func(t *testing.T) {
+		policy := config.VerificationPolicy{Mode: config.VerifyRandomLabels, Labels: 1000}
+		positions := verificationPositions(policy, b)
+		require.Len(t, positions, 100)
+		require.Equal(t, b.start, positions[0])
+		require.Equal(t, b.end, positions[99])
+	})
+}
+
+func TestInitialize_VerifyAllLabels(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 10
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits
+	opts.ProviderIDs = []uint{CPUProviderID()}
+	opts.ComputeBatchSize = 1 << 8
+	opts.Verification = config.VerificationPolicy{Mode: config.VerifyPercentage, Percentage: 100}
+
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+
+	stats := init.VerificationStats()
+	r.Equal(uint64(opts.NumUnits)*cfg.LabelsPerUnit, stats.LabelsChecked)
+	r.Zero(stats.Mismatches)
+	r.Zero(stats.Retries)
+	r.Zero(stats.Rescheduled)
+}
+
+func TestInitialize_VerificationRetries(t *testing.T) {
+	r := require.New(t)
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 10
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits
+	opts.ProviderIDs = []uint{CPUProviderID()}
+	opts.Verification = config.VerificationPolicy{Mode: config.VerifyRandomLabels, Labels: 4, MaxRetries: 2}
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+	woReference, err := oracle.New(
+		oracle.WithProviderID(CPUProviderID()),
+		oracle.WithCommitment(make([]byte, 32)), // different commitment to trigger mismatches
+		oracle.WithScryptParams(opts.Scrypt),
+		oracle.WithVRFDifficulty(make([]byte, 32)),
+		oracle.WithLogger(logger),
+	)
+	r.NoError(err)
+	defer woReference.Close()
+
+	var mismatchEvents int
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(logger),
+		withReferenceOracle(woReference),
+		WithProgressHandler(func(e Event) {
+			if e.Kind == EventLabelMismatch {
+				mismatchEvents++
+			}
+		}),
+	)
+	r.NoError(err)
+
+	var errWrongLabels ErrReferenceLabelMismatch
+	r.ErrorAs(init.Initialize(context.Background()), &errWrongLabels)
+
+	// the batch is computed three times on the only device, then the device is given up
+	stats := init.VerificationStats()
+	r.Equal(uint64(3), stats.Mismatches)
+	r.Equal(uint64(2), stats.Retries)
+	r.Equal(uint64(1), stats.Rescheduled)
+	r.Equal(3, mismatchEvents)
+}
+
+func TestInitialize_FallbackToCPU(t *testing.T) {
+	r := require.New(t)
+
+	providers, err := OpenCLProviders()
+	r.NoError(err)
+	var gpu *Provider
+	for i := range providers {
+		if providers[i].ID != CPUProviderID() {
+			gpu = &providers[i]
+			break
+		}
+	}
+	if gpu == nil {
+		t.Skip("no GPU provider available")
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 10
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits
+	opts.ProviderIDs = []uint{gpu.ID}
+	opts.ComputeBatchSize = 1 << 8
+	opts.Verification = config.VerificationPolicy{Mode: config.VerifyLastLabel}
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(logger),
+		WithHealthPolicy(oracle.HealthPolicy{MaxFailures: 2, FailureWindow: time.Hour, Cooldown: time.Hour}),
+	)
+	r.NoError(err)
+
+	// a device that computes wrong labels
+	numLabels := uint64(opts.NumUnits) * cfg.LabelsPerUnit
+	difficulty := init.powDifficultyFunc(numLabels)
+	woFlapping, err := oracle.New(
+		oracle.WithProviderID(gpu.ID),
+		oracle.WithCommitment(make([]byte, 32)),
+		oracle.WithScryptParams(opts.Scrypt),
+		oracle.WithVRFDifficulty(difficulty),
+		oracle.WithLogger(logger),
+		oracle.WithHealthTracker(init.health),
+	)
+	r.NoError(err)
+	defer woFlapping.Close()
+
+	woReference, err := init.cpuOracle()
+	r.NoError(err)
+	defer woReference.Close()
+
+	layout, err := deriveFilesLayout(cfg, opts)
+	r.NoError(err)
+	r.NoError(init.initFiles(context.Background(), []*oracle.WorkOracle{woFlapping}, woReference, layout, nil))
+	r.Equal(numLabels, init.NumLabelsWritten())
+
+	devices := init.DeviceHealth()
+	r.Len(devices, 2)
+	for _, d := range devices {
+		if d.ProviderID == gpu.ID {
+			r.True(d.Blacklisted)
+			r.Equal(uint64(2), d.Mismatches)
+		} else {
+			r.Equal(CPUProviderID(), d.ProviderID)
+			r.False(d.Blacklisted)
+			r.NotZero(d.Successes)
+		}
+	}
+
+	report, err := init.VerifySamples(context.Background(), 100)
+	r.NoError(err)
+	r.Empty(report.Mismatches)
+}
+
+func TestInitialize_SearchNonceFallsBackToCPU(t *testing.T) {
+	r := require.New(t)
+
+	providers, err := OpenCLProviders()
+	r.NoError(err)
+	var gpu *Provider
+	for i := range providers {
+		if providers[i].ID != CPUProviderID() {
+			gpu = &providers[i]
+			break
+		}
+	}
+	if gpu == nil {
+		t.Skip("no GPU provider available")
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.LabelsPerUnit = 1 << 10
+
+	opts := config.DefaultInitOpts()
+	opts.Scrypt.N = 16
+	opts.DataDir = t.TempDir()
+	opts.NumUnits = cfg.MinNumUnits
+	opts.ProviderIDs = []uint{gpu.ID}
+	opts.ComputeBatchSize = 1 << 8
+
+	var nonceFoundBy []uint
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+	init, err := NewInitializer(
+		WithNodeId(nodeId),
+		WithCommitmentAtxId(commitmentAtxId),
+		WithConfig(cfg),
+		WithInitOpts(opts),
+		WithLogger(logger),
+		WithHealthPolicy(oracle.HealthPolicy{MaxFailures: 1, FailureWindow: time.Hour, Cooldown: time.Hour}),
+		WithProgressHandler(func(e Event) {
+			if e.Kind == EventNonceFound {
+				nonceFoundBy = append(nonceFoundBy, e.ProviderID)
+			}
+		}),
+	)
+	r.NoError(err)
+
+	numLabels := uint64(opts.NumUnits) * cfg.LabelsPerUnit
+	woGPU, err := oracle.New(
+		oracle.WithProviderID(gpu.ID),
+		oracle.WithCommitment(init.commitment),
+		oracle.WithScryptParams(opts.Scrypt),
+		oracle.WithVRFDifficulty(init.powDifficultyFunc(numLabels)),
+		oracle.WithLogger(logger),
+		oracle.WithHealthTracker(init.health),
+	)
+	r.NoError(err)
+	defer woGPU.Close()
+
+	// the device was given up while initializing the files
+	init.health.RecordFailure(gpu.ID)
+	init.lastPosition.Store(&numLabels)
+
+	r.NoError(init.searchNonce(context.Background(), []*oracle.WorkOracle{woGPU}, nil))
+	r.NotNil(init.nonce.Load())
+	r.Equal([]uint{CPUProviderID()}, nonceFoundBy)
+
+	// without the CPU to fall back to the search fails
+	init.health.RecordFailure(CPUProviderID())
+	r.Error(init.searchNonce(context.Background(), []*oracle.WorkOracle{woGPU}, nil))
+}
@@ -5,9 +5,12 @@ package postrs
 import "C"
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 
 	"go.uber.org/zap"
 )
@@ -17,6 +20,10 @@ import (
 // ErrScryptClosed is returned when calling a method on an already closed Scrypt instance.
 var ErrScryptClosed = errors.New("scrypt has been closed")
 
+// DefaultChunkSize is the default number of labels computed per call to post-rs. A cancellation takes effect at the
+// latest after the chunk that is being computed is finished.
+const DefaultChunkSize = 1 << 16
+
 func OpenCLProviders() ([]Provider, error) {
 	return cGetProviders()
 }
@@ -34,6 +41,9 @@ type ScryptPositionsResult struct {
 type Scrypter interface {
 	io.Closer
 	Positions(start, end uint64) (ScryptPositionsResult, error)
+	PositionsWithContext(ctx context.Context, start, end uint64) (ScryptPositionsResult, error)
+	PositionsInto(start, end uint64, dst []byte) (ScryptPositionsResult, error)
+	PositionsIntoWithContext(ctx context.Context, start, end uint64, dst []byte) (ScryptPositionsResult, error)
 }
 
 type option struct {
@@ -43,6 +53,8 @@ type option struct {
 	n             uint
 	vrfDifficulty []byte
 
+	chunkSize uint64
+
 	logger *zap.Logger
 }
 
@@ -59,6 +71,10 @@ func (o *option) validate() error {
 		return fmt.Errorf("invalid `n`; expected: power of 2, given: %v", o.n)
 	}
 
+	if o.chunkSize == 0 {
+		return errors.New("`chunkSize` must be greater than 0")
+	}
+
 	return nil
 }
 
@@ -106,6 +122,15 @@ func WithVRFDifficulty(difficulty []byte) OptionFunc {
 	}
 }
 
+// WithChunkSize sets the number of labels computed per call to post-rs. Smaller chunks make cancellation more
+// responsive at the cost of some overhead per call.
+func WithChunkSize(chunkSize uint64) OptionFunc {
+	return func(opts *option) error {
+		opts.chunkSize = chunkSize
+		return nil
+	}
+}
+
 // WithLogger sets the logger to use.
 func WithLogger(logger *zap.Logger) OptionFunc {
 	return func(opts *option) error {
@@ -115,15 +140,20 @@ func WithLogger(logger *zap.Logger) OptionFunc {
 }
 
 // Scrypt is a scrypt computation instance. It communicates with post-rs to perform
-// the scrypt computation on the GPU or CPU.
+// the scrypt computation on the GPU or CPU. It is safe for concurrent use, calls to post-rs are serialized.
 type Scrypt struct {
 	options *option
-	init    *C.Initializer
+
+	mtx         sync.Mutex // post-rs doesn't support concurrent calls to the same initializer
+	init        *C.Initializer
+	idxSolution C.uint64_t // receives the index of the solution of a call, guarded by mtx
 }
 
 // NewScrypt creates a new Scrypt instance.
 func NewScrypt(opts ...OptionFunc) (*Scrypt, error) {
-	options := &option{}
+	options := &option{
+		chunkSize: DefaultChunkSize,
+	}
 	for _, opt := range opts {
 		if err := opt(options); err != nil {
 			return nil, err
@@ -150,6 +180,9 @@ func NewScrypt(opts ...OptionFunc) (*Scrypt, error) {
 
 // Close closes the Scrypt instance.
 func (s *Scrypt) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
 	if s.init == nil {
 		return ErrScryptClosed
 	}
@@ -164,21 +197,88 @@ func (s *Scrypt) Close() error {
 
 // Positions computes the scrypt output for the given options.
 func (s *Scrypt) Positions(start, end uint64) (ScryptPositionsResult, error) {
-	if s.init == nil {
-		return ScryptPositionsResult{}, ErrScryptClosed
+	return s.PositionsWithContext(context.Background(), start, end)
+}
+
+// PositionsWithContext computes the scrypt output for the given options. The range is computed in chunks, ctx is
+// checked before each of them.
+func (s *Scrypt) PositionsWithContext(ctx context.Context, start, end uint64) (ScryptPositionsResult, error) {
+	if start > end {
+		return ScryptPositionsResult{}, fmt.Errorf("invalid `start` and `end`; expected: start <= end, given: %v > %v", start, end)
 	}
+	return s.PositionsIntoWithContext(ctx, start, end, make([]byte, LabelLength*(end-start+1)))
+}
 
+// PositionsInto computes the scrypt output for the given options into dst, see PositionsIntoWithContext.
+func (s *Scrypt) PositionsInto(start, end uint64, dst []byte) (ScryptPositionsResult, error) {
+	return s.PositionsIntoWithContext(context.Background(), start, end, dst)
+}
+
+// PositionsIntoWithContext computes the scrypt output for the given options like PositionsWithContext, but writes
+// the labels to dst instead of allocating a new buffer, so it can be reused for the next call. dst must hold at least
+// LabelLength * (end - start + 1) bytes, the Output of the result is the beginning of dst that holds the labels.
+func (s *Scrypt) PositionsIntoWithContext(ctx context.Context, start, end uint64, dst []byte) (ScryptPositionsResult, error) {
 	if start > end {
 		return ScryptPositionsResult{}, fmt.Errorf("invalid `start` and `end`; expected: start <= end, given: %v > %v", start, end)
 	}
 
+	size := LabelLength * (end - start + 1)
+	if uint64(len(dst)) < size {
+		return ScryptPositionsResult{}, fmt.Errorf("%w: `dst` too small; expected: >= %d bytes, given: %d", ErrInvalidArgument, size, len(dst))
+	}
+
 	if err := s.options.validate(); err != nil {
 		return ScryptPositionsResult{}, err
 	}
 
-	output, idxSolution, err := cScryptPositions(s.init, s.options, start, end)
+	output := dst[:size]
+	var idxSolution *uint64
+	for chunkStart := start; ; {
+		if err := ctx.Err(); err != nil {
+			return ScryptPositionsResult{}, err
+		}
+
+		chunkEnd := end
+		if end-chunkStart >= s.options.chunkSize {
+			chunkEnd = chunkStart + s.options.chunkSize - 1
+		}
+
+		chunk := output[(chunkStart-start)*LabelLength : (chunkEnd-start+1)*LabelLength]
+		chunkIdxSolution, err := s.positions(chunkStart, chunkEnd, chunk)
+		if err != nil {
+			return ScryptPositionsResult{}, err
+		}
+
+		// the solution of the range is the one with the lowest label of all chunks
+		if chunkIdxSolution != nil && (idxSolution == nil || bytes.Compare(label(output, start, *chunkIdxSolution), label(output, start, *idxSolution)) < 0) {
+			idxSolution = chunkIdxSolution
+		}
+
+		if chunkEnd == end {
+			break
+		}
+		chunkStart = chunkEnd + 1
+	}
+
 	return ScryptPositionsResult{
 		Output:      output,
 		IdxSolution: idxSolution,
-	}, err
+	}, nil
+}
+
+// positions computes a single chunk. Calls of different goroutines are interleaved chunk by chunk.
+func (s *Scrypt) positions(start, end uint64, dst []byte) (*uint64, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.init == nil {
+		return nil, ErrScryptClosed
+	}
+	return cScryptPositions(s.init, start, end, dst, &s.idxSolution)
+}
+
+// label returns the label at position p of output, which contains the labels starting at position start.
+func label(output []byte, start, p uint64) []byte {
+	offset := (p - start) * LabelLength
+	return output[offset : offset+LabelLength]
 }
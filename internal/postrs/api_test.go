@@ -1,7 +1,10 @@
 package postrs
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
 	"testing"
@@ -9,6 +12,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
+	"golang.org/x/sync/errgroup"
 )
 
 var (
@@ -130,6 +134,119 @@ func TestScrypt_Close(t *testing.T) {
 	}
 }
 
+func TestScryptPositions_Chunks(t *testing.T) {
+	vrfDifficulty := make([]byte, 32)
+	copy(vrfDifficulty, defaultDifficulty)
+	vrfDifficulty[0] = 0
+
+	start := uint64(1)
+	end := uint64(1 << 8)
+
+	scrypt, err := NewScrypt(
+		WithProviderID(CPUProviderID()),
+		WithCommitment(commitment),
+		WithVRFDifficulty(vrfDifficulty),
+		WithScryptN(32),
+	)
+	require.NoError(t, err)
+	defer scrypt.Close()
+	reference, err := scrypt.Positions(start, end)
+	require.NoError(t, err)
+	require.NotNil(t, reference.IdxSolution)
+	require.NoError(t, scrypt.Close())
+
+	scrypt, err = NewScrypt(
+		WithProviderID(CPUProviderID()),
+		WithCommitment(commitment),
+		WithVRFDifficulty(vrfDifficulty),
+		WithScryptN(32),
+		WithChunkSize(7),
+	)
+	require.NoError(t, err)
+	defer scrypt.Close()
+
+	t.Run("chunks produce the same result", func(t *testing.T) {
+		res, err := scrypt.PositionsWithContext(context.Background(), start, end)
+		require.NoError(t, err)
+		require.Equal(t, reference.Output, res.Output)
+		require.Equal(t, reference.IdxSolution, res.IdxSolution)
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := scrypt.PositionsWithContext(ctx, start, end)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("concurrent calls", func(t *testing.T) {
+		var eg errgroup.Group
+		for i := 0; i < 4; i++ {
+			eg.Go(func() error {
+				res, err := scrypt.PositionsWithContext(context.Background(), start, end)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(reference.Output, res.Output) {
+					return errors.New("output differs from the reference")
+				}
+				return nil
+			})
+		}
+		require.NoError(t, eg.Wait())
+	})
+}
+
+func TestScryptPositionsInto(t *testing.T) {
+	vrfDifficulty := make([]byte, 32)
+	copy(vrfDifficulty, defaultDifficulty)
+	vrfDifficulty[0] = 0
+
+	start := uint64(1)
+	end := uint64(1 << 8)
+
+	scrypt, err := NewScrypt(
+		WithProviderID(CPUProviderID()),
+		WithCommitment(commitment),
+		WithVRFDifficulty(vrfDifficulty),
+		WithScryptN(32),
+		WithChunkSize(7),
+	)
+	require.NoError(t, err)
+	defer scrypt.Close()
+
+	reference, err := scrypt.Positions(start, end)
+	require.NoError(t, err)
+
+	// dst may be larger than the output, the labels are written to its beginning
+	dst := make([]byte, LabelLength*(end-start+1)+LabelLength)
+	res, err := scrypt.PositionsInto(start, end, dst)
+	require.NoError(t, err)
+	require.Equal(t, reference.Output, res.Output)
+	require.Equal(t, reference.IdxSolution, res.IdxSolution)
+	require.Same(t, &dst[0], &res.Output[0])
+
+	_, err = scrypt.PositionsInto(start, end, dst[:LabelLength*(end-start)])
+	require.ErrorIs(t, err, ErrInvalidArgument)
+
+	// without a solution to the proof of work nothing is allocated
+	noPow, err := NewScrypt(
+		WithProviderID(CPUProviderID()),
+		WithCommitment(commitment),
+		WithVRFDifficulty(make([]byte, 32)),
+		WithScryptN(32),
+		WithChunkSize(7),
+	)
+	require.NoError(t, err)
+	defer noPow.Close()
+	allocs := testing.AllocsPerRun(10, func() {
+		if _, err := noPow.PositionsInto(start, end, dst); err != nil {
+			panic(err)
+		}
+	})
+	require.Zero(t, allocs)
+}
+
 func TestScryptPositions_InvalidProviderId(t *testing.T) {
 	invalidProviderId := uint(1 << 10)
 	_, err := NewScrypt(
@@ -7,6 +7,7 @@ import "C"
 
 import (
 	"errors"
+	"unsafe"
 )
 
 // gpuMtx is an instance of deviceMutex that can be used to prevent concurrent calls
@@ -103,30 +104,26 @@ func cFreeInitializer(init *C.Initializer) {
 }
 
 // cScryptPositions calls the C functions from libpostrs that create the labels
-// and VRF proofs.
-func cScryptPositions(init *C.Initializer, opt *option, start, end uint64) ([]byte, *uint64, error) {
-	outputSize := LabelLength * (end - start + 1)
+// and VRF proofs. The labels are written to dst, which must hold at least
+// LabelLength * (end - start + 1) bytes. cIdxSolution receives the index of
+// the solution, it is passed in so that it doesn't escape to the heap on every call.
+func cScryptPositions(init *C.Initializer, start, end uint64, dst []byte, cIdxSolution *C.uint64_t) (*uint64, error) {
 	cStartPosition := C.uint64_t(start)
 	cEndPosition := C.uint64_t(end)
-	cOutputSize := C.size_t(outputSize)
-	cOut := (C.malloc(cOutputSize))
-	defer C.free(cOut)
+	cOut := (*C.uint8_t)(unsafe.Pointer(&dst[0]))
 
-	var cIdxSolution C.uint64_t
-	retVal := C.initialize(init, cStartPosition, cEndPosition, (*C.uint8_t)(cOut), &cIdxSolution)
+	retVal := C.initialize(init, cStartPosition, cEndPosition, cOut, cIdxSolution)
 	if err := InitResultToError(retVal); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	output := C.GoBytes(cOut, C.int(cOutputSize))
-
 	if retVal == C.InitializeOkNonceNotFound {
-		return output, nil, nil
+		return nil, nil
 	}
 
 	vrfNonce := new(uint64)
-	*vrfNonce = uint64(cIdxSolution)
-	return output, vrfNonce, nil
+	*vrfNonce = uint64(*cIdxSolution)
+	return vrfNonce, nil
 }
 
 // cCPUProviderID returns the ID for the (non OpenCL) CPU provider.
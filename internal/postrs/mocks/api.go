@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -62,3 +63,48 @@ func (mr *MockScrypterMockRecorder) Positions(arg0, arg1 interface{}) *gomock.Ca
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Positions", reflect.TypeOf((*MockScrypter)(nil).Positions), arg0, arg1)
 }
+
+// PositionsInto mocks base method.
+func (m *MockScrypter) PositionsInto(arg0, arg1 uint64, arg2 []byte) (postrs.ScryptPositionsResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PositionsInto", arg0, arg1, arg2)
+	ret0, _ := ret[0].(postrs.ScryptPositionsResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PositionsInto indicates an expected call of PositionsInto.
+func (mr *MockScrypterMockRecorder) PositionsInto(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PositionsInto", reflect.TypeOf((*MockScrypter)(nil).PositionsInto), arg0, arg1, arg2)
+}
+
+// PositionsIntoWithContext mocks base method.
+func (m *MockScrypter) PositionsIntoWithContext(arg0 context.Context, arg1, arg2 uint64, arg3 []byte) (postrs.ScryptPositionsResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PositionsIntoWithContext", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(postrs.ScryptPositionsResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PositionsIntoWithContext indicates an expected call of PositionsIntoWithContext.
+func (mr *MockScrypterMockRecorder) PositionsIntoWithContext(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PositionsIntoWithContext", reflect.TypeOf((*MockScrypter)(nil).PositionsIntoWithContext), arg0, arg1, arg2, arg3)
+}
+
+// PositionsWithContext mocks base method.
+func (m *MockScrypter) PositionsWithContext(arg0 context.Context, arg1, arg2 uint64) (postrs.ScryptPositionsResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PositionsWithContext", arg0, arg1, arg2)
+	ret0, _ := ret[0].(postrs.ScryptPositionsResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PositionsWithContext indicates an expected call of PositionsWithContext.
+func (mr *MockScrypterMockRecorder) PositionsWithContext(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PositionsWithContext", reflect.TypeOf((*MockScrypter)(nil).PositionsWithContext), arg0, arg1, arg2)
+}
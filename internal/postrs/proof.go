@@ -138,9 +138,13 @@ const (
 	PowArgon2 = C.RandomXFlag_FLAG_ARGON2
 )
 
+// ErrInvalidProof is returned by VerifyProof if the proof is invalid.
+var ErrInvalidProof = errors.New("invalid proof")
+
+// Verifier verifies proofs. It is safe for concurrent use, Close waits for verifications in progress to finish.
 type Verifier struct {
-	inner     *C.Verifier
-	closeOnce sync.Once
+	mtx   sync.RWMutex
+	inner *C.Verifier
 }
 
 // Create a new verifier.
@@ -155,7 +159,13 @@ func NewVerifier(powFlags PowFlags) (*Verifier, error) {
 }
 
 func (v *Verifier) Close() error {
-	v.closeOnce.Do(func() { C.free_verifier(v.inner) })
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	if v.inner != nil {
+		C.free_verifier(v.inner)
+		v.inner = nil
+	}
 	return nil
 }
 
@@ -235,6 +245,12 @@ func (v *Verifier) VerifyProof(
 		num_units:         C.uint32_t(metadata.NumUnits),
 		labels_per_unit:   C.uint64_t(metadata.LabelsPerUnit),
 	}
+	v.mtx.RLock()
+	defer v.mtx.RUnlock()
+	if v.inner == nil {
+		return errors.New("verifier is closed")
+	}
+
 	result := C.verify_proof(
 		v.inner,
 		cProof,
@@ -246,10 +262,10 @@ func (v *Verifier) VerifyProof(
 	case C.Ok:
 		return nil
 	case C.Invalid:
-		return fmt.Errorf("invalid proof")
+		return ErrInvalidProof
 	case C.InvalidArgument:
-		return fmt.Errorf("invalid argument")
+		return ErrInvalidArgument
 	default:
-		return fmt.Errorf("unknown error")
+		return fmt.Errorf("unknown error: %d", result)
 	}
 }
@@ -0,0 +1,149 @@
+package scrypt
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	// keccakRate is the number of bytes absorbed per permutation by Keccak-512.
+	keccakRate = 72
+	// keccakSize is the size of a Keccak-512 digest.
+	keccakSize = 64
+)
+
+var keccakRoundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808a, 0x8000000080008000,
+	0x000000000000808b, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008a, 0x0000000000000088, 0x0000000080008009, 0x000000008000000a,
+	0x000000008000808b, 0x800000000000008b, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800a, 0x800000008000000a,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+var (
+	keccakRotations = [24]int{1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14, 27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44}
+	keccakLanes     = [24]int{10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4, 15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1}
+)
+
+func keccakF1600(st *[25]uint64) {
+	var bc [5]uint64
+	for round := 0; round < 24; round++ {
+		// theta
+		for i := 0; i < 5; i++ {
+			bc[i] = st[i] ^ st[i+5] ^ st[i+10] ^ st[i+15] ^ st[i+20]
+		}
+		for i := 0; i < 5; i++ {
+			t := bc[(i+4)%5] ^ bits.RotateLeft64(bc[(i+1)%5], 1)
+			for j := 0; j < 25; j += 5 {
+				st[j+i] ^= t
+			}
+		}
+
+		// rho and pi
+		t := st[1]
+		for i := 0; i < 24; i++ {
+			j := keccakLanes[i]
+			bc[0] = st[j]
+			st[j] = bits.RotateLeft64(t, keccakRotations[i])
+			t = bc[0]
+		}
+
+		// chi
+		for j := 0; j < 25; j += 5 {
+			for i := 0; i < 5; i++ {
+				bc[i] = st[j+i]
+			}
+			for i := 0; i < 5; i++ {
+				st[j+i] ^= ^bc[(i+1)%5] & bc[(i+2)%5]
+			}
+		}
+
+		// iota
+		st[0] ^= keccakRoundConstants[round]
+	}
+}
+
+// keccak512 is the original Keccak-512 as used by scrypt-jane, it differs from SHA3-512 in its padding.
+type keccak512 struct {
+	state  [25]uint64
+	buffer [keccakRate]byte
+	n      int
+}
+
+func (k *keccak512) absorb(block []byte) {
+	for i := 0; i < keccakRate/8; i++ {
+		k.state[i] ^= binary.LittleEndian.Uint64(block[i*8:])
+	}
+	keccakF1600(&k.state)
+}
+
+func (k *keccak512) Write(p []byte) {
+	if k.n > 0 {
+		c := copy(k.buffer[k.n:], p)
+		k.n += c
+		p = p[c:]
+		if k.n < keccakRate {
+			return
+		}
+		k.absorb(k.buffer[:])
+		k.n = 0
+	}
+	for len(p) >= keccakRate {
+		k.absorb(p[:keccakRate])
+		p = p[keccakRate:]
+	}
+	k.n = copy(k.buffer[:], p)
+}
+
+func (k *keccak512) Sum() [keccakSize]byte {
+	buf := k.buffer
+	for i := k.n; i < keccakRate; i++ {
+		buf[i] = 0
+	}
+	buf[k.n] = 0x01
+	buf[keccakRate-1] |= 0x80
+	k.absorb(buf[:])
+
+	var out [keccakSize]byte
+	for i := 0; i < keccakSize/8; i++ {
+		binary.LittleEndian.PutUint64(out[i*8:], k.state[i])
+	}
+	return out
+}
+
+// hmacKeccak512 is HMAC with Keccak-512, keyed once and cloned for every message.
+type hmacKeccak512 struct {
+	inner, outer keccak512
+}
+
+func newHMAC(key []byte) hmacKeccak512 {
+	if len(key) > keccakRate {
+		var k keccak512
+		k.Write(key)
+		sum := k.Sum()
+		key = sum[:]
+	}
+
+	var pad [keccakRate]byte
+	var h hmacKeccak512
+	copy(pad[:], key)
+	for i := range pad {
+		pad[i] ^= 0x36
+	}
+	h.inner.Write(pad[:])
+	for i := range pad {
+		pad[i] ^= 0x36 ^ 0x5c
+	}
+	h.outer.Write(pad[:])
+	return h
+}
+
+func (h hmacKeccak512) sum(msgs ...[]byte) [keccakSize]byte {
+	for _, msg := range msgs {
+		h.inner.Write(msg)
+	}
+	inner := h.inner.Sum()
+	h.outer.Write(inner[:])
+	return h.outer.Sum()
+}
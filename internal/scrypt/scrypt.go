@@ -0,0 +1,136 @@
+// Package scrypt implements the variant of scrypt that is used to compute labels, in pure Go.
+//
+// It follows scrypt-jane configured with ChaCha20/8 as mixing function and Keccak-512 as hash function, which is what
+// the native implementation of the labels uses. It is meant for verifiers that compute a few labels and can't link
+// the native library, initializing with it is orders of magnitude slower than with the native implementation.
+package scrypt
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// blockWords is the number of 32 bit words of a block of the mixing function.
+const blockWords = 16
+
+// Key derives a key of len(out) bytes from password and salt. N must be a power of 2 greater than 1, r and p must be
+// powers of 2 as well.
+func Key(password, salt []byte, n, r, p uint, out []byte) error {
+	switch {
+	case n < 2 || n&(n-1) != 0:
+		return errors.New("scrypt: N must be a power of 2 greater than 1")
+	case r == 0 || r&(r-1) != 0:
+		return errors.New("scrypt: r must be a power of 2")
+	case p == 0 || p&(p-1) != 0:
+		return errors.New("scrypt: p must be a power of 2")
+	}
+
+	mac := newHMAC(password)
+	chunkBytes := int(r) * 2 * blockWords * 4
+	x := make([]byte, chunkBytes*int(p))
+	pbkdf2(mac, salt, x)
+
+	chunk := make([]uint32, chunkBytes/4)
+	y := make([]uint32, len(chunk))
+	v := make([]uint32, len(chunk)*int(n))
+	for i := 0; i < int(p); i++ {
+		b := x[i*chunkBytes : (i+1)*chunkBytes]
+		for j := range chunk {
+			chunk[j] = binary.LittleEndian.Uint32(b[j*4:])
+		}
+		roMix(chunk, y, v, uint32(n), int(r))
+		for j := range chunk {
+			binary.LittleEndian.PutUint32(b[j*4:], chunk[j])
+		}
+	}
+
+	pbkdf2(mac, x, out)
+	return nil
+}
+
+// pbkdf2 is PBKDF2 with a single iteration.
+func pbkdf2(mac hmacKeccak512, salt, out []byte) {
+	var be [4]byte
+	for i := uint32(1); len(out) > 0; i++ {
+		binary.BigEndian.PutUint32(be[:], i)
+		sum := mac.sum(salt, be[:])
+		out = out[copy(out, sum[:]):]
+	}
+}
+
+// roMix is the sequential memory-hard mixing of scrypt, it replaces x with its mix.
+func roMix(x, y, v []uint32, n uint32, r int) {
+	chunkWords := len(x)
+	copy(v, x)
+	for i := 0; i < int(n)-1; i++ {
+		chunkMix(v[(i+1)*chunkWords:(i+2)*chunkWords], v[i*chunkWords:(i+1)*chunkWords], nil, r)
+	}
+	chunkMix(x, v[(int(n)-1)*chunkWords:], nil, r)
+
+	for i := uint32(0); i < n; i += 2 {
+		j := x[chunkWords-blockWords] & (n - 1)
+		chunkMix(y, x, v[int(j)*chunkWords:(int(j)+1)*chunkWords], r)
+		j = y[chunkWords-blockWords] & (n - 1)
+		chunkMix(x, y, v[int(j)*chunkWords:(int(j)+1)*chunkWords], r)
+	}
+}
+
+// chunkMix is BlockMix of scrypt over the 2*r blocks of in, xored with the blocks of xor if given.
+func chunkMix(out, in, xor []uint32, r int) {
+	var x [blockWords]uint32
+	last := in[(2*r-1)*blockWords:]
+	copy(x[:], last)
+	if xor != nil {
+		for i := range x {
+			x[i] ^= xor[(2*r-1)*blockWords+i]
+		}
+	}
+
+	half := 0
+	for i := 0; i < 2*r; i++ {
+		for j := range x {
+			x[j] ^= in[i*blockWords+j]
+		}
+		if xor != nil {
+			for j := range x {
+				x[j] ^= xor[i*blockWords+j]
+			}
+		}
+		chachaCore(&x, 8)
+
+		// even blocks go to the first half of the output, odd blocks to the second
+		k := i/2 + half
+		copy(out[k*blockWords:(k+1)*blockWords], x[:])
+		half ^= r
+	}
+}
+
+// chachaCore applies the given number of ChaCha rounds to x and adds the input to the result.
+func chachaCore(x *[blockWords]uint32, rounds int) {
+	s := *x
+	for ; rounds > 0; rounds -= 2 {
+		quarterRound(&s, 0, 4, 8, 12)
+		quarterRound(&s, 1, 5, 9, 13)
+		quarterRound(&s, 2, 6, 10, 14)
+		quarterRound(&s, 3, 7, 11, 15)
+		quarterRound(&s, 0, 5, 10, 15)
+		quarterRound(&s, 1, 6, 11, 12)
+		quarterRound(&s, 2, 7, 8, 13)
+		quarterRound(&s, 3, 4, 9, 14)
+	}
+	for i := range x {
+		x[i] += s[i]
+	}
+}
+
+func quarterRound(s *[blockWords]uint32, a, b, c, d int) {
+	s[a] += s[b]
+	s[d] = bits.RotateLeft32(s[d]^s[a], 16)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], 12)
+	s[a] += s[b]
+	s[d] = bits.RotateLeft32(s[d]^s[a], 8)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], 7)
+}
@@ -0,0 +1,91 @@
+package scrypt
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeccak512(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected string
+	}{
+		{"", "0eab42de4c3ceb9235fc91acffe746b29c29a8c366b7c60e4e67c466f36a4304c00fa9caf9d87976ba469bcbe06713b435f091ef2769fb160cdab33d3670680e"},
+		{"abc", "18587dc2ea106b9a1563e32b3312421ca164c7f1f07bc922a9c83d77cea3a1e5d0c69910739025372dc14ac9642629379540c17e2a65b19d77aa511a9d00bb96"},
+	} {
+		var k keccak512
+		k.Write([]byte(tc.input))
+		sum := k.Sum()
+		require.Equal(t, tc.expected, hex.EncodeToString(sum[:]), "input %q", tc.input)
+	}
+
+	// input that spans multiple blocks gives the same digest independent of how it is written
+	data := make([]byte, 3*keccakRate+5)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	var whole, parts keccak512
+	whole.Write(data)
+	for i := 0; i < len(data); i += 7 {
+		end := i + 7
+		if end > len(data) {
+			end = len(data)
+		}
+		parts.Write(data[i:end])
+	}
+	require.Equal(t, whole.Sum(), parts.Sum())
+}
+
+func TestChaChaCore(t *testing.T) {
+	// the block function test vector of RFC 8439, section 2.3.2
+	var x [blockWords]uint32
+	x[0], x[1], x[2], x[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	for i := 0; i < 8; i++ {
+		x[4+i] = binary.LittleEndian.Uint32([]byte{byte(4 * i), byte(4*i + 1), byte(4*i + 2), byte(4*i + 3)})
+	}
+	x[12], x[13], x[14], x[15] = 1, 0x09000000, 0x4a000000, 0
+
+	chachaCore(&x, 20)
+	out := make([]byte, 64)
+	for i, w := range x {
+		binary.LittleEndian.PutUint32(out[i*4:], w)
+	}
+	expected := "10f1e7e4d13b5915500fdd1fa32071c4c7d1f4c733c068030422aa9ac3d46c4e" +
+		"d2826446079faa0914c2d705d98b02a2b5129cd1de164eb9cbd083e8a2503c4e"
+	require.Equal(t, expected, hex.EncodeToString(out))
+}
+
+// TestKey checks the properties of Key, its known answers are the labels of post-rs checked by the verifying
+// package.
+func TestKey(t *testing.T) {
+	r := require.New(t)
+
+	out1 := make([]byte, 16)
+	r.NoError(Key([]byte("password"), nil, 16, 1, 1, out1))
+	out2 := make([]byte, 16)
+	r.NoError(Key([]byte("password"), nil, 16, 1, 1, out2))
+	r.Equal(out1, out2)
+
+	// every parameter changes the output
+	for _, params := range [][3]uint{{32, 1, 1}, {16, 2, 1}, {16, 1, 2}} {
+		out := make([]byte, 16)
+		r.NoError(Key([]byte("password"), nil, params[0], params[1], params[2], out))
+		r.NotEqual(out1, out, "params %v", params)
+	}
+	out := make([]byte, 16)
+	r.NoError(Key([]byte("password"), []byte("salt"), 16, 1, 1, out))
+	r.NotEqual(out1, out)
+
+	// longer outputs extend shorter ones
+	long := make([]byte, 100)
+	r.NoError(Key([]byte("password"), nil, 16, 1, 1, long))
+	r.Equal(out1, long[:16])
+
+	r.Error(Key(nil, nil, 3, 1, 1, out))
+	r.Error(Key(nil, nil, 1, 1, 1, out))
+	r.Error(Key(nil, nil, 16, 3, 1, out))
+	r.Error(Key(nil, nil, 16, 1, 0, out))
+}
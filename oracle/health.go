@@ -0,0 +1,178 @@
+package oracle
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrProviderUnhealthy is returned when a WorkOracle is used while its provider is blacklisted.
+var ErrProviderUnhealthy = errors.New("provider is blacklisted after repeated failures")
+
+// latencyWeight is the weight of a new sample in the moving average of the latency of a provider.
+const latencyWeight = 0.2
+
+// HealthPolicy determines when a provider is blacklisted.
+type HealthPolicy struct {
+	// MaxFailures is the number of failures within FailureWindow after which a provider is blacklisted.
+	MaxFailures int
+	// FailureWindow is the period in which failures are counted.
+	FailureWindow time.Duration
+	// Cooldown is the time a provider stays blacklisted before it is used again.
+	Cooldown time.Duration
+}
+
+// DefaultHealthPolicy returns the default HealthPolicy.
+func DefaultHealthPolicy() HealthPolicy {
+	return HealthPolicy{
+		MaxFailures:   3,
+		FailureWindow: 10 * time.Minute,
+		Cooldown:      time.Hour,
+	}
+}
+
+// DeviceHealth is a snapshot of the health of a provider.
+type DeviceHealth struct {
+	ProviderID uint
+
+	Successes  uint64
+	Failures   uint64 // calls that returned an error
+	Mismatches uint64 // calls that returned labels that failed verification
+
+	// Latency is a moving average of the duration of successful calls.
+	Latency time.Duration
+	// LabelsPerSecond is a moving average of the throughput of successful calls.
+	LabelsPerSecond float64
+
+	Blacklisted      bool
+	BlacklistedUntil time.Time
+}
+
+type deviceHealth struct {
+	DeviceHealth
+	recentFailures []time.Time
+}
+
+// HealthTracker tracks the health of providers, so that a provider that keeps failing can be given up in favor of
+// others. It is safe for concurrent use and can be shared by multiple WorkOracles. All methods can be called on a nil
+// HealthTracker, in which case every provider is considered healthy.
+type HealthTracker struct {
+	policy HealthPolicy
+	now    func() time.Time
+
+	mtx     sync.Mutex
+	devices map[uint]*deviceHealth
+}
+
+// NewHealthTracker creates a HealthTracker with the given policy.
+func NewHealthTracker(policy HealthPolicy) *HealthTracker {
+	return &HealthTracker{
+		policy:  policy,
+		now:     time.Now,
+		devices: make(map[uint]*deviceHealth),
+	}
+}
+
+func (h *HealthTracker) device(id uint) *deviceHealth {
+	d, ok := h.devices[id]
+	if !ok {
+		d = &deviceHealth{DeviceHealth: DeviceHealth{ProviderID: id}}
+		h.devices[id] = d
+	}
+	return d
+}
+
+// RecordSuccess records a successful computation of numLabels labels by a provider.
+func (h *HealthTracker) RecordSuccess(id uint, numLabels uint64, latency time.Duration) {
+	if h == nil {
+		return
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	d := h.device(id)
+	d.Successes++
+
+	labelsPerSecond := float64(numLabels) / latency.Seconds()
+	if d.Successes == 1 {
+		d.Latency = latency
+		d.LabelsPerSecond = labelsPerSecond
+		return
+	}
+	d.Latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(d.Latency))
+	d.LabelsPerSecond = latencyWeight*labelsPerSecond + (1-latencyWeight)*d.LabelsPerSecond
+}
+
+// RecordFailure records a failed computation of a provider.
+func (h *HealthTracker) RecordFailure(id uint) {
+	if h == nil {
+		return
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	d := h.device(id)
+	d.Failures++
+	h.failed(d)
+}
+
+// RecordMismatch records that labels computed by a provider failed verification.
+func (h *HealthTracker) RecordMismatch(id uint) {
+	if h == nil {
+		return
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	d := h.device(id)
+	d.Mismatches++
+	h.failed(d)
+}
+
+func (h *HealthTracker) failed(d *deviceHealth) {
+	now := h.now()
+	recent := d.recentFailures[:0]
+	for _, t := range d.recentFailures {
+		if now.Sub(t) < h.policy.FailureWindow {
+			recent = append(recent, t)
+		}
+	}
+	d.recentFailures = append(recent, now)
+
+	if len(d.recentFailures) >= h.policy.MaxFailures {
+		d.BlacklistedUntil = now.Add(h.policy.Cooldown)
+		d.recentFailures = nil
+	}
+}
+
+// Healthy returns false if the provider is blacklisted.
+func (h *HealthTracker) Healthy(id uint) bool {
+	if h == nil {
+		return true
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	d, ok := h.devices[id]
+	return !ok || !h.now().Before(d.BlacklistedUntil)
+}
+
+// Devices returns the health of all providers that were used, ordered by provider ID.
+func (h *HealthTracker) Devices() []DeviceHealth {
+	if h == nil {
+		return nil
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	now := h.now()
+	devices := make([]DeviceHealth, 0, len(h.devices))
+	for _, d := range h.devices {
+		health := d.DeviceHealth
+		health.Blacklisted = now.Before(d.BlacklistedUntil)
+		devices = append(devices, health)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ProviderID < devices[j].ProviderID })
+	return devices
+}
@@ -0,0 +1,55 @@
+package oracle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthTracker(t *testing.T) {
+	now := time.Now()
+	h := NewHealthTracker(HealthPolicy{MaxFailures: 3, FailureWindow: time.Minute, Cooldown: time.Hour})
+	h.now = func() time.Time { return now }
+
+	t.Run("failures outside the window are forgotten", func(t *testing.T) {
+		h.RecordFailure(1)
+		h.RecordMismatch(1)
+		now = now.Add(2 * time.Minute)
+		h.RecordFailure(1)
+		require.True(t, h.Healthy(1))
+	})
+
+	t.Run("flapping provider is blacklisted", func(t *testing.T) {
+		h.RecordSuccess(1, 100, time.Second)
+		h.RecordMismatch(1)
+		h.RecordSuccess(1, 100, time.Second)
+		h.RecordFailure(1)
+		require.False(t, h.Healthy(1))
+		require.True(t, h.Healthy(2))
+	})
+
+	t.Run("provider is used again after the cooldown", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		require.True(t, h.Healthy(1))
+	})
+
+	devices := h.Devices()
+	require.Len(t, devices, 1)
+	require.Equal(t, uint(1), devices[0].ProviderID)
+	require.Equal(t, uint64(2), devices[0].Successes)
+	require.Equal(t, uint64(3), devices[0].Failures)
+	require.Equal(t, uint64(2), devices[0].Mismatches)
+	require.Equal(t, time.Second, devices[0].Latency)
+	require.Equal(t, 100.0, devices[0].LabelsPerSecond)
+	require.False(t, devices[0].Blacklisted)
+}
+
+func TestHealthTracker_Nil(t *testing.T) {
+	var h *HealthTracker
+	h.RecordFailure(1)
+	h.RecordMismatch(1)
+	h.RecordSuccess(1, 1, time.Second)
+	require.True(t, h.Healthy(1))
+	require.Empty(t, h.Devices())
+}
@@ -1,6 +1,7 @@
 package oracle
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -26,6 +27,8 @@ type option struct {
 	maxRetries int
 	retryDelay time.Duration
 
+	health *HealthTracker
+
 	scrypter postrs.Scrypter
 }
 
@@ -123,6 +126,16 @@ func WithMaxRetries(maxRetries int) OptionFunc {
 	}
 }
 
+// WithHealthTracker sets the HealthTracker that records the outcome of every computation. Once the tracker blacklists
+// the provider the WorkOracle stops retrying and returns ErrProviderUnhealthy, so that the caller can move the work to
+// another provider.
+func WithHealthTracker(health *HealthTracker) OptionFunc {
+	return func(opts *option) error {
+		opts.health = health
+		return nil
+	}
+}
+
 func withScrypter(scrypter postrs.Scrypter) OptionFunc {
 	return func(opts *option) error {
 		opts.scrypter = scrypter
@@ -189,6 +202,11 @@ func (w *WorkOracle) Close() error {
 	return nil
 }
 
+// ProviderID returns the ID of the provider used by the WorkOracle.
+func (w *WorkOracle) ProviderID() uint {
+	return *w.options.providerID
+}
+
 // WorkOracleResult is the result of a call to WorkOracle.
 // It contains the computed labels and a nonce for a proof of work.
 type WorkOracleResult struct {
@@ -201,8 +219,41 @@ func (w *WorkOracle) Position(p uint64) (WorkOracleResult, error) {
 	return w.Positions(p, p)
 }
 
+// PositionWithContext computes the label for a given position.
+func (w *WorkOracle) PositionWithContext(ctx context.Context, p uint64) (WorkOracleResult, error) {
+	return w.PositionsWithContext(ctx, p, p)
+}
+
 // Positions computes the labels for a given range of positions.
 func (w *WorkOracle) Positions(start, end uint64) (WorkOracleResult, error) {
+	return w.PositionsWithContext(context.Background(), start, end)
+}
+
+// PositionsWithContext computes the labels for a given range of positions. It stops computing and returns ctx.Err()
+// as soon as ctx is canceled, also while waiting to retry a failed computation.
+func (w *WorkOracle) PositionsWithContext(ctx context.Context, start, end uint64) (WorkOracleResult, error) {
+	return w.positions(ctx, start, end, func() (postrs.ScryptPositionsResult, error) {
+		return w.scrypt.PositionsWithContext(ctx, start, end)
+	})
+}
+
+// PositionsInto computes the labels for a given range of positions into dst, see PositionsIntoWithContext.
+func (w *WorkOracle) PositionsInto(start, end uint64, dst []byte) (WorkOracleResult, error) {
+	return w.PositionsIntoWithContext(context.Background(), start, end, dst)
+}
+
+// PositionsIntoWithContext computes the labels for a given range of positions like PositionsWithContext, but writes
+// them to dst instead of allocating a new buffer. dst must hold at least postrs.LabelLength * (end - start + 1)
+// bytes, the Output of the result is the beginning of dst that holds the labels.
+func (w *WorkOracle) PositionsIntoWithContext(ctx context.Context, start, end uint64, dst []byte) (WorkOracleResult, error) {
+	return w.positions(ctx, start, end, func() (postrs.ScryptPositionsResult, error) {
+		return w.scrypt.PositionsIntoWithContext(ctx, start, end, dst)
+	})
+}
+
+// positions calls compute to compute the labels for a given range of positions, retrying failed computations and
+// recording the health of the provider.
+func (w *WorkOracle) positions(ctx context.Context, start, end uint64, compute func() (postrs.ScryptPositionsResult, error)) (WorkOracleResult, error) {
 	if w.scrypt == nil {
 		return WorkOracleResult{}, ErrWorkOracleClosed
 	}
@@ -211,21 +262,37 @@ func (w *WorkOracle) Positions(start, end uint64) (WorkOracleResult, error) {
 		return WorkOracleResult{}, fmt.Errorf("invalid `start` and `end`; expected: start <= end, given: %v > %v", start, end)
 	}
 
+	id := w.ProviderID()
+	health := w.options.health
 	tries := 0
 	for {
-		res, err := w.scrypt.Positions(start, end)
+		if !health.Healthy(id) {
+			return WorkOracleResult{}, fmt.Errorf("%w: provider %d", ErrProviderUnhealthy, id)
+		}
+
+		t := time.Now()
+		res, err := compute()
 		tries += 1
 		switch {
+		case ctx.Err() != nil:
+			return WorkOracleResult{}, ctx.Err()
 		case errors.Is(err, postrs.ErrInitializationFailed):
+			health.RecordFailure(id)
 			w.options.logger.With().Warn("failure during initialization", zap.Error(err))
 			if tries > w.options.maxRetries {
 				return WorkOracleResult{}, fmt.Errorf("failed to initialize scrypt after %v tries", tries)
 			}
 			w.options.logger.With().Warn("retrying initialization", zap.Int("tries", tries))
-			time.Sleep(w.options.retryDelay)
+			select {
+			case <-ctx.Done():
+				return WorkOracleResult{}, ctx.Err()
+			case <-time.After(w.options.retryDelay):
+			}
 		case err != nil:
+			health.RecordFailure(id)
 			return WorkOracleResult{}, err
 		default:
+			health.RecordSuccess(id, end-start+1, time.Since(t))
 			return WorkOracleResult{
 				Output: res.Output,
 				Nonce:  res.IdxSolution,
@@ -1,8 +1,10 @@
 package oracle
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
@@ -19,19 +21,19 @@ func TestOracleRetryPositions(t *testing.T) {
 	o, err := New(WithCommitment(commitment), WithVRFDifficulty(vrfDifficulty), WithMaxRetries(2), WithRetryDelay(0), withScrypter(mockScrypter))
 
 	t.Run("retries max time and quits", func(t *testing.T) {
-		mockScrypter.EXPECT().Positions(uint64(0), uint64(10)).Return(postrs.ScryptPositionsResult{}, postrs.ErrInitializationFailed).Times(3)
+		mockScrypter.EXPECT().PositionsWithContext(gomock.Any(), uint64(0), uint64(10)).Return(postrs.ScryptPositionsResult{}, postrs.ErrInitializationFailed).Times(3)
 		require.NoError(t, err)
 		_, err = o.Positions(0, 10)
 		require.Error(t, err)
 	})
 	t.Run("eventually succeeds", func(t *testing.T) {
-		mockScrypter.EXPECT().Positions(uint64(0), uint64(10)).Return(postrs.ScryptPositionsResult{}, postrs.ErrInitializationFailed).Times(2)
-		mockScrypter.EXPECT().Positions(uint64(0), uint64(10)).Return(postrs.ScryptPositionsResult{}, nil).Times(1)
+		mockScrypter.EXPECT().PositionsWithContext(gomock.Any(), uint64(0), uint64(10)).Return(postrs.ScryptPositionsResult{}, postrs.ErrInitializationFailed).Times(2)
+		mockScrypter.EXPECT().PositionsWithContext(gomock.Any(), uint64(0), uint64(10)).Return(postrs.ScryptPositionsResult{}, nil).Times(1)
 		_, err = o.Positions(0, 10)
 		require.NoError(t, err)
 	})
 	t.Run("does not retry on unknown error", func(t *testing.T) {
-		mockScrypter.EXPECT().Positions(uint64(0), uint64(10)).Return(postrs.ScryptPositionsResult{}, errors.New("unknown error")).Times(1)
+		mockScrypter.EXPECT().PositionsWithContext(gomock.Any(), uint64(0), uint64(10)).Return(postrs.ScryptPositionsResult{}, errors.New("unknown error")).Times(1)
 		_, err = o.Positions(0, 10)
 		require.Error(t, err)
 	})
@@ -63,3 +65,69 @@ func TestOracleCantInitializeAfterClose(t *testing.T) {
 	_, err = o.Positions(0, 10)
 	require.Error(t, err)
 }
+
+func TestOracleStopsRetryingOnUnhealthyProvider(t *testing.T) {
+	t.Parallel()
+	commitment := make([]byte, 32)
+	vrfDifficulty := make([]byte, 32)
+	mockScrypter := mocks.NewMockScrypter(gomock.NewController(t))
+	health := NewHealthTracker(HealthPolicy{MaxFailures: 2, FailureWindow: time.Hour, Cooldown: time.Hour})
+	o, err := New(
+		WithCommitment(commitment),
+		WithVRFDifficulty(vrfDifficulty),
+		WithMaxRetries(10),
+		WithRetryDelay(0),
+		WithHealthTracker(health),
+		withScrypter(mockScrypter),
+	)
+	require.NoError(t, err)
+
+	// the provider is blacklisted after the second failure and not retried anymore
+	mockScrypter.EXPECT().PositionsWithContext(gomock.Any(), uint64(0), uint64(10)).Return(postrs.ScryptPositionsResult{}, postrs.ErrInitializationFailed).Times(2)
+	_, err = o.Positions(0, 10)
+	require.ErrorIs(t, err, ErrProviderUnhealthy)
+	require.False(t, health.Healthy(o.ProviderID()))
+
+	devices := health.Devices()
+	require.Len(t, devices, 1)
+	require.Equal(t, uint64(2), devices[0].Failures)
+	require.True(t, devices[0].Blacklisted)
+}
+
+func TestOracleRetryInterruptedByContext(t *testing.T) {
+	t.Parallel()
+	commitment := make([]byte, 32)
+	vrfDifficulty := make([]byte, 32)
+	mockScrypter := mocks.NewMockScrypter(gomock.NewController(t))
+	o, err := New(WithCommitment(commitment), WithVRFDifficulty(vrfDifficulty), WithMaxRetries(2), WithRetryDelay(time.Hour), withScrypter(mockScrypter))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mockScrypter.EXPECT().PositionsWithContext(gomock.Any(), uint64(0), uint64(10)).DoAndReturn(
+		func(context.Context, uint64, uint64) (postrs.ScryptPositionsResult, error) {
+			time.AfterFunc(10*time.Millisecond, cancel)
+			return postrs.ScryptPositionsResult{}, postrs.ErrInitializationFailed
+		}).Times(1)
+
+	_, err = o.PositionsWithContext(ctx, 0, 10)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestOraclePositionsInto(t *testing.T) {
+	t.Parallel()
+	commitment := make([]byte, 32)
+	vrfDifficulty := make([]byte, 32)
+	mockScrypter := mocks.NewMockScrypter(gomock.NewController(t))
+	o, err := New(WithCommitment(commitment), WithVRFDifficulty(vrfDifficulty), WithMaxRetries(2), WithRetryDelay(0), withScrypter(mockScrypter))
+	require.NoError(t, err)
+
+	dst := make([]byte, 11*postrs.LabelLength)
+	nonce := uint64(3)
+	mockScrypter.EXPECT().PositionsIntoWithContext(gomock.Any(), uint64(0), uint64(10), dst).Return(postrs.ScryptPositionsResult{}, postrs.ErrInitializationFailed).Times(1)
+	mockScrypter.EXPECT().PositionsIntoWithContext(gomock.Any(), uint64(0), uint64(10), dst).Return(postrs.ScryptPositionsResult{Output: dst, IdxSolution: &nonce}, nil).Times(1)
+
+	res, err := o.PositionsInto(0, 10, dst)
+	require.NoError(t, err)
+	require.Equal(t, dst, res.Output)
+	require.Equal(t, &nonce, res.Nonce)
+}
@@ -0,0 +1,29 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package persistence
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// FreeSpace returns the number of bytes available to the current user on the file system of the given directory.
+func FreeSpace(dir string) (uint64, error) {
+	return 0, fmt.Errorf("determining free space is not supported on %s", runtime.GOOS)
+}
+
+// DiskUsage returns the number of bytes allocated on disk for the given file. It is the size of the file on this
+// platform.
+func DiskUsage(path string) (uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(info.Size()), nil
+}
+
+// FilesystemType returns the name of the file system of the given directory. It is unknown on this platform.
+func FilesystemType(dir string) (string, error) {
+	return "", fmt.Errorf("determining the file system is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,31 @@
+//go:build linux || darwin || freebsd
+
+package persistence
+
+import (
+	"os"
+	"syscall"
+)
+
+// FreeSpace returns the number of bytes available to the current user on the file system of the given directory.
+func FreeSpace(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// DiskUsage returns the number of bytes allocated on disk for the given file. It differs from the size of the file if
+// the file is sparse or space was preallocated for it.
+func DiskUsage(path string) (uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return uint64(info.Size()), nil
+	}
+	return uint64(st.Blocks) * 512, nil
+}
@@ -0,0 +1,63 @@
+//go:build windows
+
+package persistence
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                  = syscall.NewLazyDLL("kernel32.dll")
+	procGetDiskFreeSpaceExW   = kernel32.NewProc("GetDiskFreeSpaceExW")
+	procGetVolumePathNameW    = kernel32.NewProc("GetVolumePathNameW")
+	procGetVolumeInformationW = kernel32.NewProc("GetVolumeInformationW")
+)
+
+// FreeSpace returns the number of bytes available to the current user on the file system of the given directory.
+func FreeSpace(dir string) (uint64, error) {
+	path, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var available uint64
+	ret, _, err := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(&available)), 0, 0)
+	if ret == 0 {
+		return 0, err
+	}
+	return available, nil
+}
+
+// DiskUsage returns the number of bytes allocated on disk for the given file. It is the size of the file on this
+// platform.
+func DiskUsage(path string) (uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(info.Size()), nil
+}
+
+// FilesystemType returns the name of the file system of the given directory in lower case, e.g. "ntfs" or "fat32".
+func FilesystemType(dir string) (string, error) {
+	path, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return "", err
+	}
+
+	volume := make([]uint16, syscall.MAX_PATH+1)
+	ret, _, err := procGetVolumePathNameW.Call(uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(&volume[0])), uintptr(len(volume)))
+	if ret == 0 {
+		return "", err
+	}
+
+	name := make([]uint16, syscall.MAX_PATH+1)
+	ret, _, err = procGetVolumeInformationW.Call(uintptr(unsafe.Pointer(&volume[0])), 0, 0, 0, 0, 0, uintptr(unsafe.Pointer(&name[0])), uintptr(len(name)))
+	if ret == 0 {
+		return "", err
+	}
+	return strings.ToLower(syscall.UTF16ToString(name)), nil
+}
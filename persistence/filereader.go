@@ -9,7 +9,7 @@ import (
 )
 
 type FileReader struct {
-	file *os.File
+	file File
 	buf  *bufio.Reader
 
 	bitsPerLabel uint
@@ -23,13 +23,16 @@ func NewFileReader(name string, bitsPerLabel uint) (*FileReader, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file for labels reader: %w", err)
 	}
-	buf := bufio.NewReader(file)
+	return newFileReader(dirFile{file}, bitsPerLabel), nil
+}
 
+// newFileReader returns a FileReader that reads the labels of the given file.
+func newFileReader(file File, bitsPerLabel uint) *FileReader {
 	return &FileReader{
 		file,
-		buf,
+		bufio.NewReader(file),
 		bitsPerLabel,
-	}, nil
+	}
 }
 
 func (r *FileReader) Read(p []byte) (int, error) {
@@ -37,11 +40,11 @@ func (r *FileReader) Read(p []byte) (int, error) {
 }
 
 func (r *FileReader) NumLabels() (uint64, error) {
-	info, err := r.file.Stat()
+	size, err := r.file.Size()
 	if err != nil {
 		return 0, err
 	}
-	return uint64(info.Size()) * 8 / uint64(r.bitsPerLabel), nil
+	return uint64(size) * 8 / uint64(r.bitsPerLabel), nil
 }
 
 func (r *FileReader) Close() error {
@@ -0,0 +1,22 @@
+//go:build darwin || freebsd
+
+package persistence
+
+import "syscall"
+
+// FilesystemType returns the name of the file system of the given directory, e.g. "apfs" or "msdos".
+func FilesystemType(dir string) (string, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return "", err
+	}
+
+	name := make([]byte, 0, len(st.Fstypename))
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return string(name), nil
+}
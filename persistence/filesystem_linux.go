@@ -0,0 +1,38 @@
+package persistence
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// filesystems are the names of the file systems relevant for PoST data by their magic number, see statfs(2).
+var filesystems = map[uint32]string{
+	0xef53:     "ext4",
+	0x58465342: "xfs",
+	0x9123683e: "btrfs",
+	0x2fc12fc1: "zfs",
+	0x5346544e: "ntfs",
+	0x65735546: "fuseblk",
+	0x2011bab0: "exfat",
+	0x4d44:     "vfat",
+	0x01021994: "tmpfs",
+	0x858458f6: "ramfs",
+	0x794c7630: "overlay",
+	0x6969:     "nfs",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+}
+
+// FilesystemType returns the name of the file system of the given directory, e.g. "ext4" or "vfat". File systems
+// that aren't known are named by their magic number.
+func FilesystemType(dir string) (string, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return "", err
+	}
+	magic := uint32(st.Type)
+	if name, ok := filesystems[magic]; ok {
+		return name, nil
+	}
+	return fmt.Sprintf("0x%x", magic), nil
+}
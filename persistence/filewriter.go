@@ -10,7 +10,7 @@ import (
 )
 
 type FileWriter struct {
-	file *os.File
+	file File
 	buf  *bufio.Writer
 
 	bitsPerLabel uint
@@ -21,7 +21,15 @@ func NewFileWriter(filename string, bitsPerLabel uint) (*FileWriter, error) {
 	if err != nil {
 		return nil, err
 	}
-	f.Seek(0, io.SeekEnd)
+	return newFileWriter(dirFile{f}, bitsPerLabel)
+}
+
+// newFileWriter returns a FileWriter that appends labels to the given file.
+func newFileWriter(f File, bitsPerLabel uint) (*FileWriter, error) {
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to seek file: %w", err)
+	}
 	return &FileWriter{
 		file:         f,
 		buf:          bufio.NewWriter(f),
@@ -43,12 +51,12 @@ func (w *FileWriter) Flush() error {
 }
 
 func (w *FileWriter) NumLabelsWritten() (uint64, error) {
-	info, err := w.file.Stat()
+	size, err := w.file.Size()
 	if err != nil {
 		return 0, err
 	}
 
-	return uint64(info.Size()) * 8 / uint64(w.bitsPerLabel), nil
+	return uint64(size) * 8 / uint64(w.bitsPerLabel), nil
 }
 
 func (w *FileWriter) Truncate(numLabels uint64) error {
@@ -57,11 +65,20 @@ func (w *FileWriter) Truncate(numLabels uint64) error {
 		return fmt.Errorf("invalid `numLabels`; expected: evenly divisible by 8 (alone, or when multiplied by `labelSize`), given: %d", numLabels)
 	}
 
+	if err := w.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to flush disk writer: %w", err)
+	}
+
 	size := int64(bitSize / 8)
 	if err := w.file.Truncate(size); err != nil {
 		return fmt.Errorf("failed to truncate file: %w", err)
 	}
 	w.file.Sync()
+
+	// Continue writing at the new end of the file.
+	if _, err := w.file.Seek(size, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek file: %w", err)
+	}
 	return nil
 }
 
@@ -0,0 +1,244 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"sync"
+)
+
+// MemStorage is a Storage that keeps files in memory. It is meant for tests and for initializations that are small
+// enough to fit into memory.
+type MemStorage struct {
+	mtx   sync.Mutex
+	files map[string]*memData
+}
+
+// A compile time check to ensure that MemStorage fully implements the Storage interface.
+var _ Storage = (*MemStorage)(nil)
+
+// NewMemStorage returns an empty MemStorage.
+func NewMemStorage() *MemStorage {
+	return &MemStorage{files: make(map[string]*memData)}
+}
+
+type memData struct {
+	mtx  sync.RWMutex
+	data []byte
+}
+
+func (s *MemStorage) get(name string) (*memData, error) {
+	d, ok := s.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return d, nil
+}
+
+func (s *MemStorage) Open(name string) (File, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	d, err := s.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return &memFile{data: d, readOnly: true}, nil
+}
+
+func (s *MemStorage) OpenFile(name string, create bool) (File, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	d, err := s.get(name)
+	switch {
+	case err != nil && create:
+		d = &memData{}
+		s.files[name] = d
+	case err != nil:
+		return nil, err
+	}
+	return &memFile{data: d}, nil
+}
+
+func (s *MemStorage) List() ([]FileInfo, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	files := make([]FileInfo, 0, len(s.files))
+	for name, d := range s.files {
+		files = append(files, FileInfo{Name: name, Size: d.size()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+func (s *MemStorage) Stat(name string) (FileInfo, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	d, err := s.get(name)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{Name: name, Size: d.size()}, nil
+}
+
+func (s *MemStorage) Truncate(name string, size int64) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	d, err := s.get(name)
+	if err != nil {
+		return err
+	}
+	return d.truncate(size)
+}
+
+func (s *MemStorage) Remove(name string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, err := s.get(name); err != nil {
+		return err
+	}
+	delete(s.files, name)
+	return nil
+}
+
+func (d *memData) size() int64 {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	return int64(len(d.data))
+}
+
+func (d *memData) truncate(size int64) error {
+	if size < 0 {
+		return errors.New("negative size")
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if size <= int64(len(d.data)) {
+		d.data = d.data[:size]
+		return nil
+	}
+	d.data = append(d.data, make([]byte, size-int64(len(d.data)))...)
+	return nil
+}
+
+// memFile is an open file of a MemStorage. Like an *os.File it must not be used concurrently, except for ReadAt and
+// WriteAt.
+type memFile struct {
+	data     *memData
+	offset   int64
+	readOnly bool
+	closed   bool
+}
+
+var errMemFileClosed = errors.New("file already closed")
+
+func (f *memFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if errors.Is(err, io.EOF) && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, errMemFileClosed
+	}
+
+	f.data.mtx.RLock()
+	defer f.data.mtx.RUnlock()
+	if off >= int64(len(f.data.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	n, err := f.WriteAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	switch {
+	case f.closed:
+		return 0, errMemFileClosed
+	case f.readOnly:
+		return 0, errors.New("file is opened read only")
+	case off < 0:
+		return 0, errors.New("negative offset")
+	}
+
+	f.data.mtx.Lock()
+	defer f.data.mtx.Unlock()
+	if end := off + int64(len(p)); end > int64(len(f.data.data)) {
+		f.data.data = append(f.data.data, make([]byte, end-int64(len(f.data.data)))...)
+	}
+	return copy(f.data.data[off:], p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, errMemFileClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.data.size()
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Size() (int64, error) {
+	if f.closed {
+		return 0, errMemFileClosed
+	}
+	return f.data.size(), nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	switch {
+	case f.closed:
+		return errMemFileClosed
+	case f.readOnly:
+		return errors.New("file is opened read only")
+	}
+	return f.data.truncate(size)
+}
+
+func (f *memFile) Sync() error {
+	if f.closed {
+		return errMemFileClosed
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return errMemFileClosed
+	}
+	f.closed = true
+	return nil
+}
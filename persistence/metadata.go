@@ -0,0 +1,67 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+var (
+	ErrMetadataFileMissing         = errors.New("metadata file is missing")
+	ErrMetadataVersionNotSupported = errors.New("metadata version not supported")
+)
+
+// metadataMigrations upgrade metadata from the version they are keyed with to the next version.
+var metadataMigrations = map[uint32]func(*shared.PostMetadata) error{
+	// Version 0 is the format before versioning was introduced, it only lacks the version field.
+	0: func(*shared.PostMetadata) error { return nil },
+}
+
+// LoadMetadata reads the metadata from the given directory and migrates it to the current version.
+// If the metadata file is missing or corrupted the backup next to it is used instead.
+func LoadMetadata(dir string) (*shared.PostMetadata, error) {
+	metadata, err := loadMetadataFile(filepath.Join(dir, shared.MetadataFileName))
+	if err != nil {
+		backup, bErr := loadMetadataFile(filepath.Join(dir, shared.MetadataBackupFileName))
+		switch {
+		case errors.Is(bErr, os.ErrNotExist) && os.IsNotExist(err):
+			return nil, ErrMetadataFileMissing
+		case bErr != nil:
+			return nil, fmt.Errorf("read file failure: %w", err)
+		}
+		metadata = backup
+	}
+
+	for metadata.Version < shared.MetadataVersion {
+		migrate, ok := metadataMigrations[metadata.Version]
+		if !ok {
+			return nil, fmt.Errorf("%w: no migration from version %d", ErrMetadataVersionNotSupported, metadata.Version)
+		}
+		if err := migrate(metadata); err != nil {
+			return nil, fmt.Errorf("failed to migrate metadata from version %d: %w", metadata.Version, err)
+		}
+		metadata.Version++
+	}
+	if metadata.Version > shared.MetadataVersion {
+		return nil, fmt.Errorf("%w: version %d is newer than %d", ErrMetadataVersionNotSupported, metadata.Version, shared.MetadataVersion)
+	}
+
+	return metadata, nil
+}
+
+func loadMetadataFile(filename string) (*shared.PostMetadata, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := shared.PostMetadata{}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
@@ -0,0 +1,357 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/shared"
+)
+
+// Placement selects the directory of a new file of a MultiDirStorage.
+type Placement int
+
+const (
+	// PlaceRoundRobin places the file with index N in directory N modulo the number of directories.
+	PlaceRoundRobin Placement = iota
+	// PlaceByCapacity places a file in the directory with the most free space, taking into account the space still
+	// needed by the files already placed in it.
+	PlaceByCapacity
+)
+
+// PlacementOf returns the Placement of a file placement of the initialization options.
+func PlacementOf(placement config.FilePlacement) (Placement, error) {
+	switch placement {
+	case config.PlaceRoundRobin:
+		return PlaceRoundRobin, nil
+	case config.PlaceByCapacity:
+		return PlaceByCapacity, nil
+	default:
+		return 0, fmt.Errorf("invalid placement: %d", placement)
+	}
+}
+
+type multiDirOption struct {
+	placement Placement
+	fileSize  int64
+	locations map[string]string
+	onPlace   func(name, dir string) error
+	freeSpace func(dir string) (uint64, error)
+}
+
+// MultiDirOptionFunc is a function that sets an option for a MultiDirStorage.
+type MultiDirOptionFunc func(*multiDirOption) error
+
+// WithPlacement sets the placement of new files.
+func WithPlacement(placement Placement) MultiDirOptionFunc {
+	return func(opts *multiDirOption) error {
+		switch placement {
+		case PlaceRoundRobin, PlaceByCapacity:
+		default:
+			return fmt.Errorf("invalid placement: %d", placement)
+		}
+		opts.placement = placement
+		return nil
+	}
+}
+
+// WithFileSize sets the size files grow to. It is used by PlaceByCapacity to reserve space for files that are not
+// completely written yet.
+func WithFileSize(size uint64) MultiDirOptionFunc {
+	return func(opts *multiDirOption) error {
+		opts.fileSize = int64(size)
+		return nil
+	}
+}
+
+// WithLocations sets the directories of files that were placed before, by file name.
+func WithLocations(locations map[string]string) MultiDirOptionFunc {
+	return func(opts *multiDirOption) error {
+		opts.locations = locations
+		return nil
+	}
+}
+
+// WithPlacementHandler sets a function that is called whenever a new file is placed, before it is created. If it
+// returns an error the file isn't created. It is meant to persist the locations of the files.
+func WithPlacementHandler(onPlace func(name, dir string) error) MultiDirOptionFunc {
+	return func(opts *multiDirOption) error {
+		opts.onPlace = onPlace
+		return nil
+	}
+}
+
+func withFreeSpace(freeSpace func(dir string) (uint64, error)) MultiDirOptionFunc {
+	return func(opts *multiDirOption) error {
+		opts.freeSpace = freeSpace
+		return nil
+	}
+}
+
+// MultiDirStorage is a Storage that spreads label files over several directories, e.g. on different disks. It only
+// holds label files, i.e. files named by shared.InitFileName.
+//
+// Every file stays in the directory it was placed in. The locations of files are found by scanning the directories
+// and can additionally be given with WithLocations, so files in directories that are no longer configured are still
+// found.
+type MultiDirStorage struct {
+	dirs    []string
+	options *multiDirOption
+
+	mtx       sync.Mutex
+	locations map[string]string
+}
+
+// A compile time check to ensure that MultiDirStorage fully implements the Storage interface.
+var _ Storage = (*MultiDirStorage)(nil)
+
+// NewMultiDirStorage returns a Storage that places new files in the given directories.
+func NewMultiDirStorage(dirs []string, opts ...MultiDirOptionFunc) (*MultiDirStorage, error) {
+	if len(dirs) == 0 {
+		return nil, errors.New("no directories given")
+	}
+
+	options := &multiDirOption{
+		placement: PlaceRoundRobin,
+		onPlace:   func(string, string) error { return nil },
+		freeSpace: FreeSpace,
+	}
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &MultiDirStorage{
+		dirs:      dirs,
+		options:   options,
+		locations: make(map[string]string),
+	}
+
+	// A recorded directory that is missing most likely is an unmounted disk; placing its files again would
+	// silently lose the labels they contain.
+	scan := make(map[string]bool)
+	for name, dir := range options.locations {
+		if _, err := shared.ParseFileIndex(name); err != nil {
+			return nil, fmt.Errorf("invalid location of %s: %w", name, err)
+		}
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("directory of %s is not available: %w", name, err)
+		}
+		s.locations[name] = dir
+		scan[dir] = true
+	}
+	for _, dir := range dirs {
+		scan[dir] = true
+	}
+
+	for dir := range scan {
+		files, err := NewDirStorage(dir).List()
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if _, err := shared.ParseFileIndex(file.Name); err != nil {
+				continue
+			}
+			if location, ok := s.locations[file.Name]; ok && location != dir {
+				if _, err := os.Stat(filepath.Join(location, file.Name)); err == nil {
+					return nil, fmt.Errorf("file %s exists in both %s and %s", file.Name, location, dir)
+				}
+			}
+			s.locations[file.Name] = dir
+		}
+	}
+	return s, nil
+}
+
+// Locations returns the directory of every file that was placed, by file name.
+func (s *MultiDirStorage) Locations() map[string]string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	locations := make(map[string]string, len(s.locations))
+	for name, dir := range s.locations {
+		locations[name] = dir
+	}
+	return locations
+}
+
+// Dirs returns the directories new files are placed in.
+func (s *MultiDirStorage) Dirs() []string {
+	return append([]string(nil), s.dirs...)
+}
+
+// Target returns the directory a file is in or, if it doesn't exist yet, will be placed in. It returns false if the
+// directory is only selected when the file is created.
+func (s *MultiDirStorage) Target(name string) (string, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if dir, ok := s.locations[name]; ok {
+		return dir, true
+	}
+	index, err := shared.ParseFileIndex(name)
+	if err != nil || s.options.placement != PlaceRoundRobin {
+		return "", false
+	}
+	return s.dirs[index%len(s.dirs)], true
+}
+
+func (s *MultiDirStorage) location(name string) (string, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	dir, ok := s.locations[name]
+	if !ok {
+		return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return dir, nil
+}
+
+func (s *MultiDirStorage) Open(name string) (File, error) {
+	dir, err := s.location(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewDirStorage(dir).Open(name)
+}
+
+func (s *MultiDirStorage) OpenFile(name string, create bool) (File, error) {
+	dir, err := s.location(name)
+	switch {
+	case err == nil:
+		return NewDirStorage(dir).OpenFile(name, create)
+	case !create:
+		return nil, err
+	}
+
+	dir, err = s.place(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.options.onPlace(name, dir); err != nil {
+		s.mtx.Lock()
+		delete(s.locations, name)
+		s.mtx.Unlock()
+		return nil, fmt.Errorf("failed to record location of %s: %w", name, err)
+	}
+	return NewDirStorage(dir).OpenFile(name, true)
+}
+
+// place selects the directory of a new file and records it.
+func (s *MultiDirStorage) place(name string) (string, error) {
+	index, err := shared.ParseFileIndex(name)
+	if err != nil {
+		return "", fmt.Errorf("not a label file: %w", err)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if dir, ok := s.locations[name]; ok {
+		return dir, nil
+	}
+
+	var dir string
+	switch s.options.placement {
+	case PlaceRoundRobin:
+		dir = s.dirs[index%len(s.dirs)]
+	case PlaceByCapacity:
+		dir, err = s.placeByCapacityLocked()
+		if err != nil {
+			return "", err
+		}
+	}
+	s.locations[name] = dir
+	return dir, nil
+}
+
+func (s *MultiDirStorage) placeByCapacityLocked() (string, error) {
+	var best string
+	var bestCapacity int64
+	for i, dir := range s.dirs {
+		if err := os.MkdirAll(dir, shared.OwnerReadWriteExec); err != nil {
+			return "", err
+		}
+		free, err := s.options.freeSpace(dir)
+		if err != nil {
+			return "", fmt.Errorf("failed to determine free space of %s: %w", dir, err)
+		}
+
+		capacity := int64(free)
+		for name, location := range s.locations {
+			if location != dir {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(dir, name))
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				capacity -= s.options.fileSize
+			case err != nil:
+				return "", err
+			case info.Size() < s.options.fileSize:
+				capacity -= s.options.fileSize - info.Size()
+			}
+		}
+
+		if i == 0 || capacity > bestCapacity {
+			best, bestCapacity = dir, capacity
+		}
+	}
+	return best, nil
+}
+
+// List returns the files of the storage that exist, ordered by name.
+func (s *MultiDirStorage) List() ([]FileInfo, error) {
+	locations := s.Locations()
+	files := make([]FileInfo, 0, len(locations))
+	for name, dir := range locations {
+		info, err := NewDirStorage(dir).Stat(name)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		files = append(files, info)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+func (s *MultiDirStorage) Stat(name string) (FileInfo, error) {
+	dir, err := s.location(name)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return NewDirStorage(dir).Stat(name)
+}
+
+func (s *MultiDirStorage) Truncate(name string, size int64) error {
+	dir, err := s.location(name)
+	if err != nil {
+		return err
+	}
+	return NewDirStorage(dir).Truncate(name, size)
+}
+
+func (s *MultiDirStorage) Remove(name string) error {
+	dir, err := s.location(name)
+	if err != nil {
+		return err
+	}
+	if err := NewDirStorage(dir).Remove(name); err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	delete(s.locations, name)
+	s.mtx.Unlock()
+	return nil
+}
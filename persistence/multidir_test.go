@@ -0,0 +1,197 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/shared"
+)
+
+func createFile(t *testing.T, s Storage, index int, data []byte) {
+	f, err := s.OpenFile(shared.InitFileName(index), true)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func TestMultiDirStorage_RoundRobin(t *testing.T) {
+	r := require.New(t)
+	dirs := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+
+	var placed []string
+	s, err := NewMultiDirStorage(dirs, WithPlacementHandler(func(name, dir string) error {
+		placed = append(placed, dir)
+		return nil
+	}))
+	r.NoError(err)
+
+	for i := 0; i < 5; i++ {
+		createFile(t, s, i, []byte{byte(i)})
+	}
+	r.Equal([]string{dirs[0], dirs[1], dirs[2], dirs[0], dirs[1]}, placed)
+	r.FileExists(filepath.Join(dirs[1], shared.InitFileName(4)))
+
+	files, err := s.List()
+	r.NoError(err)
+	r.Len(files, 5)
+
+	// a new storage finds the files by scanning the directories
+	s, err = NewMultiDirStorage(dirs)
+	r.NoError(err)
+	r.Equal(s.Locations()[shared.InitFileName(4)], dirs[1])
+
+	// and follows recorded locations of directories that are no longer configured
+	s, err = NewMultiDirStorage(dirs[:1], WithLocations(map[string]string{shared.InitFileName(1): dirs[1]}))
+	r.NoError(err)
+	info, err := s.Stat(shared.InitFileName(1))
+	r.NoError(err)
+	r.EqualValues(1, info.Size)
+
+	r.NoError(s.Remove(shared.InitFileName(1)))
+	r.NoFileExists(filepath.Join(dirs[1], shared.InitFileName(1)))
+}
+
+func TestMultiDirStorage_ByCapacity(t *testing.T) {
+	r := require.New(t)
+	dirs := []string{t.TempDir(), t.TempDir()}
+	free := map[string]uint64{dirs[0]: 100, dirs[1]: 70}
+
+	s, err := NewMultiDirStorage(dirs,
+		WithPlacement(PlaceByCapacity),
+		WithFileSize(40),
+		withFreeSpace(func(dir string) (uint64, error) { return free[dir], nil }),
+	)
+	r.NoError(err)
+
+	// space of files that are not completely written yet is reserved
+	createFile(t, s, 0, make([]byte, 10)) // 100 vs 70
+	createFile(t, s, 1, nil)              // 70 vs 70
+	createFile(t, s, 2, nil)              // 70 vs 30
+	createFile(t, s, 3, nil)              // 30 vs 30
+
+	locations := s.Locations()
+	r.Equal(dirs[0], locations[shared.InitFileName(0)])
+	r.Equal(dirs[0], locations[shared.InitFileName(1)])
+	r.Equal(dirs[1], locations[shared.InitFileName(2)])
+	r.Equal(dirs[0], locations[shared.InitFileName(3)])
+}
+
+func TestMultiDirStorage_Errors(t *testing.T) {
+	r := require.New(t)
+	dirs := []string{t.TempDir(), t.TempDir()}
+
+	_, err := NewMultiDirStorage(nil)
+	r.Error(err)
+
+	// a recorded directory that is missing
+	_, err = NewMultiDirStorage(dirs, WithLocations(map[string]string{shared.InitFileName(0): filepath.Join(dirs[0], "missing")}))
+	r.ErrorIs(err, os.ErrNotExist)
+
+	// the same file in two directories
+	createFile(t, NewDirStorage(dirs[0]), 0, nil)
+	createFile(t, NewDirStorage(dirs[1]), 0, nil)
+	_, err = NewMultiDirStorage(dirs, WithLocations(map[string]string{shared.InitFileName(0): dirs[0]}))
+	r.Error(err)
+
+	// a file isn't created if its location can't be recorded
+	dirs = []string{t.TempDir(), t.TempDir()}
+	s, err := NewMultiDirStorage(dirs, WithPlacementHandler(func(string, string) error { return errors.New("failed") }))
+	r.NoError(err)
+	_, err = s.OpenFile(shared.InitFileName(1), true)
+	r.Error(err)
+	r.NoFileExists(filepath.Join(dirs[1], shared.InitFileName(1)))
+	_, err = s.Stat(shared.InitFileName(1))
+	r.ErrorIs(err, os.ErrNotExist)
+
+	_, err = s.OpenFile("other", true)
+	r.Error(err)
+}
+
+func TestPlacementOf(t *testing.T) {
+	r := require.New(t)
+
+	placement, err := PlacementOf(config.PlaceRoundRobin)
+	r.NoError(err)
+	r.Equal(PlaceRoundRobin, placement)
+
+	placement, err = PlacementOf(config.PlaceByCapacity)
+	r.NoError(err)
+	r.Equal(PlaceByCapacity, placement)
+
+	_, err = PlacementOf(config.FilePlacement(-1))
+	r.Error(err)
+}
+
+func TestOpenDataStorage(t *testing.T) {
+	r := require.New(t)
+	datadir := t.TempDir()
+	other := t.TempDir()
+
+	s, err := OpenDataStorage(datadir)
+	r.NoError(err)
+	r.IsType(&DirStorage{}, s)
+
+	createFile(t, NewDirStorage(datadir), 0, NewLabelFromUint64(0, labelSize))
+	createFile(t, NewDirStorage(other), 1, NewLabelFromUint64(1, labelSize))
+	data, err := json.Marshal(shared.PostMetadata{FileDirs: map[int]string{0: datadir, 1: other}})
+	r.NoError(err)
+	r.NoError(os.WriteFile(filepath.Join(datadir, shared.MetadataFileName), data, shared.OwnerReadWrite))
+
+	readers, err := GetReaders(datadir, labelSize)
+	r.NoError(err)
+	r.Len(readers, 2)
+	numLabels, err := readers[1].NumLabels()
+	r.NoError(err)
+	r.EqualValues(1, numLabels)
+	for _, reader := range readers {
+		r.NoError(reader.Close())
+	}
+}
+
+func TestLinkDataDir(t *testing.T) {
+	r := require.New(t)
+	datadir := t.TempDir()
+	other := t.TempDir()
+
+	createFile(t, NewDirStorage(datadir), 0, NewLabelFromUint64(0, labelSize))
+	createFile(t, NewDirStorage(other), 1, NewLabelFromUint64(1, labelSize))
+	data, err := json.Marshal(shared.PostMetadata{Version: shared.MetadataVersion, NumUnits: 1})
+	r.NoError(err)
+	r.NoError(os.WriteFile(filepath.Join(datadir, shared.MetadataFileName), data, shared.OwnerReadWrite))
+
+	dir, cleanup, err := LinkDataDir(datadir)
+	r.NoError(err)
+	r.Equal(datadir, dir, "the files aren't spread")
+	r.NoError(cleanup())
+	r.DirExists(datadir)
+
+	// The metadata is corrupted, the backup is used.
+	data, err = json.Marshal(shared.PostMetadata{Version: shared.MetadataVersion, NumUnits: 1, FileDirs: map[int]string{0: datadir, 1: other}})
+	r.NoError(err)
+	r.NoError(os.WriteFile(filepath.Join(datadir, shared.MetadataBackupFileName), data, shared.OwnerReadWrite))
+	r.NoError(os.WriteFile(filepath.Join(datadir, shared.MetadataFileName), []byte("{"), shared.OwnerReadWrite))
+
+	dir, cleanup, err = LinkDataDir(datadir)
+	r.NoError(err)
+	r.NotEqual(datadir, dir)
+
+	m, err := LoadMetadata(dir)
+	r.NoError(err)
+	r.EqualValues(1, m.NumUnits)
+	for index, label := range map[int]uint64{0: 0, 1: 1} {
+		content, err := os.ReadFile(filepath.Join(dir, shared.InitFileName(index)))
+		r.NoError(err)
+		r.Equal(NewLabelFromUint64(label, labelSize), content)
+	}
+
+	r.NoError(cleanup())
+	r.NoDirExists(dir)
+	r.FileExists(filepath.Join(other, shared.InitFileName(1)), "only the links are removed")
+}
@@ -1,6 +1,8 @@
 package persistence
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -23,6 +25,19 @@ func NewLabelsReader(datadir string, bitsPerLabel uint) (Reader, error) {
 	if err != nil {
 		return nil, err
 	}
+	return groupReaders(readers)
+}
+
+// NewStorageLabelsReader returns a new labels reader from the initialization files of the given storage.
+func NewStorageLabelsReader(storage Storage, bitsPerLabel uint) (Reader, error) {
+	readers, err := GetStorageReaders(storage, bitsPerLabel)
+	if err != nil {
+		return nil, err
+	}
+	return groupReaders(readers)
+}
+
+func groupReaders(readers []Reader) (Reader, error) {
 	if len(readers) == 1 {
 		return readers[0], nil
 	}
@@ -30,26 +45,43 @@ func NewLabelsReader(datadir string, bitsPerLabel uint) (Reader, error) {
 	return Group(readers)
 }
 
+// GetReaders returns a reader for every initialization file of datadir, ordered by file index. If the files are
+// spread over multiple directories they are found through the metadata in datadir.
 func GetReaders(datadir string, bitsPerLabel uint) ([]Reader, error) {
-	files, err := os.ReadDir(datadir)
-	if err != nil {
+	if _, err := os.Stat(datadir); err != nil {
 		return nil, fmt.Errorf("initialization directory not found: %w", err)
 	}
-	if len(files) == 0 {
+
+	storage, err := OpenDataStorage(datadir)
+	if err != nil {
+		return nil, err
+	}
+	readers, err := GetStorageReaders(storage, bitsPerLabel)
+	if errors.Is(err, errNoInitFiles) {
 		return nil, fmt.Errorf("initialization directory (%v) is empty", datadir)
 	}
+	return readers, err
+}
+
+var errNoInitFiles = errors.New("no initialization files")
+
+// GetStorageReaders returns a reader for every initialization file of the given storage, ordered by file index.
+func GetStorageReaders(storage Storage, bitsPerLabel uint) ([]Reader, error) {
+	files, err := storage.List()
+	if err != nil {
+		return nil, err
+	}
 
 	// Filter.
-	var initFiles []os.FileInfo
+	var initFiles []FileInfo
 	for _, file := range files {
-		info, err := file.Info()
-		if err != nil {
-			continue
-		}
-		if shared.IsInitFile(info) {
-			initFiles = append(initFiles, info)
+		if _, err := shared.ParseFileIndex(file.Name); err == nil {
+			initFiles = append(initFiles, file)
 		}
 	}
+	if len(initFiles) == 0 {
+		return nil, errNoInitFiles
+	}
 
 	// Sort.
 	sort.Sort(numericalSorter(initFiles))
@@ -57,21 +89,127 @@ func GetReaders(datadir string, bitsPerLabel uint) ([]Reader, error) {
 	// Initialize readers.
 	var readers []Reader
 	for _, file := range initFiles {
-		reader, err := NewFileReader(filepath.Join(datadir, file.Name()), bitsPerLabel)
+		f, err := storage.Open(file.Name)
 		if err != nil {
-			return nil, err
+			for _, r := range readers {
+				r.Close()
+			}
+			return nil, fmt.Errorf("failed to open file for labels reader: %w", err)
 		}
-		readers = append(readers, reader)
+		readers = append(readers, newFileReader(f, bitsPerLabel))
 	}
 
 	return readers, nil
 }
 
+// OpenDataStorage returns the storage of the label files of the initialization in datadir. If the metadata in
+// datadir records that the files are spread over multiple directories a MultiDirStorage is returned, otherwise a
+// DirStorage.
+func OpenDataStorage(datadir string) (Storage, error) {
+	m, err := readMetadata(datadir)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || len(m.FileDirs) == 0 {
+		return NewDirStorage(datadir), nil
+	}
+
+	locations := make(map[string]string, len(m.FileDirs))
+	for index, dir := range m.FileDirs {
+		locations[shared.InitFileName(index)] = dir
+	}
+	return NewMultiDirStorage([]string{datadir}, WithLocations(locations))
+}
+
+// LinkDataDir returns a directory in which every file of the initialization in datadir is found by its name, for
+// readers that only read a single directory like the native prover. If the files aren't spread over multiple
+// directories this is datadir itself. Otherwise a temporary directory is created with the metadata and links to the
+// label files at their locations, which is removed by the returned function.
+func LinkDataDir(datadir string) (string, func() error, error) {
+	m, err := readMetadata(datadir)
+	if err != nil {
+		return "", nil, err
+	}
+	if m == nil || len(m.FileDirs) == 0 {
+		return datadir, func() error { return nil }, nil
+	}
+
+	storage, err := OpenDataStorage(datadir)
+	if err != nil {
+		return "", nil, err
+	}
+	multiDir, ok := storage.(*MultiDirStorage)
+	if !ok {
+		return "", nil, fmt.Errorf("unexpected storage of %s: %T", datadir, storage)
+	}
+	locations := multiDir.Locations()
+
+	dir, err := os.MkdirTemp("", "postdata-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create directory for links: %w", err)
+	}
+	cleanup := func() error { return os.RemoveAll(dir) }
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to serialize metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, shared.MetadataFileName), data, shared.OwnerReadWrite); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	for name, location := range locations {
+		if _, err := shared.ParseFileIndex(name); err != nil {
+			continue
+		}
+		target, err := filepath.Abs(filepath.Join(location, name))
+		if err != nil {
+			cleanup()
+			return "", nil, err
+		}
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("failed to link %s: %w", target, err)
+		}
+	}
+	return dir, cleanup, nil
+}
+
+// readMetadata reads the metadata of the initialization in datadir. It returns nil if there is no metadata.
+func readMetadata(datadir string) (*shared.PostMetadata, error) {
+	m, err := LoadMetadata(datadir)
+	if errors.Is(err, ErrMetadataFileMissing) {
+		return nil, nil
+	}
+	return m, err
+}
+
 func NewLabelsWriter(datadir string, index int, bitsPerLabel uint) (*FileWriter, error) {
-	if err := os.MkdirAll(datadir, shared.OwnerReadWriteExec); err != nil {
+	return OpenLabelsWriter(NewDirStorage(datadir), index, bitsPerLabel)
+}
+
+// OpenLabelsWriter opens the file with the given index in storage for appending labels, the file is created if it
+// doesn't exist.
+func OpenLabelsWriter(storage Storage, index int, bitsPerLabel uint) (*FileWriter, error) {
+	f, err := storage.OpenFile(shared.InitFileName(index), true)
+	if err != nil {
 		return nil, err
 	}
+	return newFileWriter(f, bitsPerLabel)
+}
 
-	filename := filepath.Join(datadir, shared.InitFileName(index))
-	return NewFileWriter(filename, bitsPerLabel)
+// NewLabelsRangeWriter opens the file with the given index in datadir for overwriting labels.
+func NewLabelsRangeWriter(datadir string, index int, bitsPerLabel uint) (*RangeWriter, error) {
+	return OpenLabelsRangeWriter(NewDirStorage(datadir), index, bitsPerLabel)
+}
+
+// OpenLabelsRangeWriter opens the file with the given index in storage for overwriting labels.
+func OpenLabelsRangeWriter(storage Storage, index int, bitsPerLabel uint) (*RangeWriter, error) {
+	f, err := storage.OpenFile(shared.InitFileName(index), false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file for range writer: %w", err)
+	}
+	return newRangeWriter(f, bitsPerLabel), nil
 }
@@ -0,0 +1,29 @@
+package persistence
+
+import (
+	"errors"
+	"syscall"
+)
+
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE, it allocates space without changing the size of the file.
+const fallocKeepSize = 0x01
+
+// Preallocate allocates disk space for the file to grow to the given size, without changing its size. The size of a
+// label file is the number of labels written to it, so the file must not be extended.
+func Preallocate(f File, size int64) error {
+	fd, ok := f.(interface{ Fd() uintptr })
+	if !ok {
+		return ErrPreallocationNotSupported
+	}
+
+	for {
+		err := syscall.Fallocate(int(fd.Fd()), fallocKeepSize, 0, size)
+		switch {
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.EOPNOTSUPP):
+			return ErrPreallocationNotSupported
+		}
+		return err
+	}
+}
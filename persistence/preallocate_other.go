@@ -0,0 +1,9 @@
+//go:build !linux
+
+package persistence
+
+// Preallocate allocates disk space for the file to grow to the given size, without changing its size. It isn't
+// supported on this platform.
+func Preallocate(f File, size int64) error {
+	return ErrPreallocationNotSupported
+}
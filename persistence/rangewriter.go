@@ -0,0 +1,62 @@
+package persistence
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+// RangeWriter overwrites labels of an existing file in place. Unlike FileWriter it never appends to the file.
+type RangeWriter struct {
+	file File
+
+	bitsPerLabel uint
+}
+
+func NewRangeWriter(filename string, bitsPerLabel uint) (*RangeWriter, error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY, shared.OwnerReadWrite)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file for range writer: %w", err)
+	}
+	return newRangeWriter(dirFile{f}, bitsPerLabel), nil
+}
+
+// newRangeWriter returns a RangeWriter that overwrites labels of the given file.
+func newRangeWriter(f File, bitsPerLabel uint) *RangeWriter {
+	return &RangeWriter{
+		file:         f,
+		bitsPerLabel: bitsPerLabel,
+	}
+}
+
+// WriteAt overwrites the labels starting at the given (file relative) position. The labels must already exist.
+func (w *RangeWriter) WriteAt(position uint64, labels []byte) error {
+	bitOffset := position * uint64(w.bitsPerLabel)
+	if bitOffset%8 != 0 {
+		return fmt.Errorf("invalid `position`; expected: evenly divisible by 8 (alone, or when multiplied by `labelSize`), given: %d", position)
+	}
+
+	size, err := w.file.Size()
+	if err != nil {
+		return err
+	}
+	offset := int64(bitOffset / 8)
+	if offset+int64(len(labels)) > size {
+		return fmt.Errorf("write of %d bytes at offset %d exceeds file size %d", len(labels), offset, size)
+	}
+
+	if _, err := w.file.WriteAt(labels, offset); err != nil {
+		return fmt.Errorf("failed to write labels: %w", err)
+	}
+	return nil
+}
+
+// Close syncs the written labels to disk and closes the file.
+func (w *RangeWriter) Close() error {
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,40 @@
+package persistence
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestRangeWriter(t *testing.T) {
+	req := require.New(t)
+
+	labelSize := uint(16)
+	datadir := t.TempDir()
+
+	writer, err := NewLabelsWriter(datadir, 0, labelSize)
+	req.NoError(err)
+	req.NoError(writer.Write([]byte{0, 1, 2, 3, 4, 5, 6, 7}))
+	req.NoError(writer.Close())
+
+	rw, err := NewLabelsRangeWriter(datadir, 0, labelSize)
+	req.NoError(err)
+	req.NoError(rw.WriteAt(1, []byte{0xA, 0xB, 0xC, 0xD}))
+
+	// writes must not extend the file
+	req.Error(rw.WriteAt(3, []byte{0xE, 0xF, 0xE, 0xF}))
+	req.NoError(rw.Close())
+
+	data, err := os.ReadFile(filepath.Join(datadir, shared.InitFileName(0)))
+	req.NoError(err)
+	req.Equal([]byte{0, 1, 0xA, 0xB, 0xC, 0xD, 6, 7}, data)
+}
+
+func TestRangeWriter_MissingFile(t *testing.T) {
+	_, err := NewLabelsRangeWriter(t.TempDir(), 0, 16)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,171 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+// LabelsReaderAt reads labels at arbitrary positions of an initialization. Label i is in the file with index
+// i / fileNumLabels at offset i % fileNumLabels, which is the layout the initialization writes the files in.
+//
+// It is safe for concurrent use. Files are opened when they are first read and stay open until Close is called.
+type LabelsReaderAt struct {
+	storage       Storage
+	fileNumLabels uint64
+	numLabels     uint64
+	bytesPerLabel uint64
+
+	mtx    sync.Mutex
+	files  map[int]File
+	closed bool
+}
+
+// A compile time check to ensure that LabelsReaderAt fully implements the io.ReaderAt interface.
+var _ io.ReaderAt = (*LabelsReaderAt)(nil)
+
+// NewLabelsReaderAt returns a LabelsReaderAt for the numLabels labels of an initialization in the given storage,
+// that is split into files of fileNumLabels labels.
+func NewLabelsReaderAt(storage Storage, fileNumLabels, numLabels uint64, bitsPerLabel uint) (*LabelsReaderAt, error) {
+	if fileNumLabels == 0 {
+		return nil, errors.New("number of labels per file must be greater than 0")
+	}
+	if bitsPerLabel == 0 || bitsPerLabel%8 != 0 {
+		return nil, fmt.Errorf("invalid bits per label: %d", bitsPerLabel)
+	}
+
+	return &LabelsReaderAt{
+		storage:       storage,
+		fileNumLabels: fileNumLabels,
+		numLabels:     numLabels,
+		bytesPerLabel: uint64(bitsPerLabel / 8),
+		files:         make(map[int]File),
+	}, nil
+}
+
+// OpenLabelsReaderAt returns a LabelsReaderAt for the initialization in datadir. The layout of the files is taken from
+// its metadata.
+func OpenLabelsReaderAt(datadir string, bitsPerLabel uint) (*LabelsReaderAt, error) {
+	m, err := readMetadata(datadir)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, fmt.Errorf("metadata of %s not found: %w", datadir, fs.ErrNotExist)
+	}
+	storage, err := OpenDataStorage(datadir)
+	if err != nil {
+		return nil, err
+	}
+
+	fileNumLabels := m.MaxFileSize * 8 / uint64(bitsPerLabel)
+	numLabels := uint64(m.NumUnits) * m.LabelsPerUnit
+	return NewLabelsReaderAt(storage, fileNumLabels, numLabels, bitsPerLabel)
+}
+
+// NumLabels returns the number of labels of the initialization, including the ones that aren't written yet.
+func (r *LabelsReaderAt) NumLabels() uint64 {
+	return r.numLabels
+}
+
+// ReadLabels returns count labels starting at the label with the given index. It returns an error wrapping
+// io.ErrUnexpectedEOF if some of them aren't written yet.
+func (r *LabelsReaderAt) ReadLabels(index, count uint64) ([]byte, error) {
+	if index > r.numLabels || count > r.numLabels-index {
+		return nil, fmt.Errorf("labels %d to %d are out of range: %d labels", index, index+count, r.numLabels)
+	}
+
+	labels := make([]byte, count*r.bytesPerLabel)
+	n, err := r.ReadAt(labels, int64(index*r.bytesPerLabel))
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return nil, fmt.Errorf("%w: read %d of %d labels from %d", err, uint64(n)/r.bytesPerLabel, count, index)
+	case err != nil:
+		return nil, err
+	}
+	return labels, nil
+}
+
+// ReadAt reads len(p) bytes of labels starting at byte offset off of the whole initialization. Reading past the last
+// label returns io.EOF, reading labels that aren't written yet returns io.ErrUnexpectedEOF.
+func (r *LabelsReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	total := r.numLabels * r.bytesPerLabel
+	fileSize := r.fileNumLabels * r.bytesPerLabel
+	var n int
+	for n < len(p) {
+		pos := uint64(off) + uint64(n)
+		if pos >= total {
+			return n, io.EOF
+		}
+
+		fileIndex := int(pos / fileSize)
+		fileOffset := pos % fileSize
+		size := fileSize - fileOffset
+		if remaining := total - pos; remaining < size {
+			size = remaining
+		}
+		if remaining := uint64(len(p) - n); remaining < size {
+			size = remaining
+		}
+
+		f, err := r.file(fileIndex)
+		if errors.Is(err, fs.ErrNotExist) {
+			return n, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return n, err
+		}
+		read, err := f.ReadAt(p[n:n+int(size)], int64(fileOffset))
+		n += read
+		switch {
+		case errors.Is(err, io.EOF) && uint64(read) < size:
+			return n, io.ErrUnexpectedEOF
+		case err != nil && !errors.Is(err, io.EOF):
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (r *LabelsReaderAt) file(index int) (File, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.closed {
+		return nil, os.ErrClosed
+	}
+	if f, ok := r.files[index]; ok {
+		return f, nil
+	}
+	f, err := r.storage.Open(shared.InitFileName(index))
+	if err != nil {
+		return nil, err
+	}
+	r.files[index] = f
+	return f, nil
+}
+
+// Close closes all files opened by the reader.
+func (r *LabelsReaderAt) Close() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.closed = true
+	var closeErr error
+	for index, f := range r.files {
+		if err := f.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+		delete(r.files, index)
+	}
+	return closeErr
+}
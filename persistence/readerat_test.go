@@ -0,0 +1,89 @@
+package persistence
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestLabelsReaderAt(t *testing.T) {
+	r := require.New(t)
+
+	// 10 labels of 1 byte, in files of 4 labels
+	storage := NewMemStorage()
+	createFile(t, storage, 0, []byte{0, 1, 2, 3})
+	createFile(t, storage, 1, []byte{4, 5, 6, 7})
+	createFile(t, storage, 2, []byte{8})
+
+	reader, err := NewLabelsReaderAt(storage, 4, 10, 8)
+	r.NoError(err)
+	defer reader.Close()
+	r.EqualValues(10, reader.NumLabels())
+
+	labels, err := reader.ReadLabels(2, 5)
+	r.NoError(err)
+	r.Equal([]byte{2, 3, 4, 5, 6}, labels)
+
+	labels, err = reader.ReadLabels(8, 1)
+	r.NoError(err)
+	r.Equal([]byte{8}, labels)
+
+	// the last label isn't written yet
+	_, err = reader.ReadLabels(8, 2)
+	r.ErrorIs(err, io.ErrUnexpectedEOF)
+
+	_, err = reader.ReadLabels(8, 3)
+	r.Error(err)
+
+	// io.ReaderAt semantics
+	p := make([]byte, 4)
+	n, err := reader.ReadAt(p, 3)
+	r.NoError(err)
+	r.Equal(4, n)
+	r.Equal([]byte{3, 4, 5, 6}, p)
+
+	n, err = reader.ReadAt(p, 10)
+	r.ErrorIs(err, io.EOF)
+	r.Zero(n)
+
+	// a file that doesn't exist yet
+	r.NoError(storage.Remove(shared.InitFileName(1)))
+	reader, err = NewLabelsReaderAt(storage, 4, 10, 8)
+	r.NoError(err)
+	_, err = reader.ReadLabels(3, 2)
+	r.ErrorIs(err, io.ErrUnexpectedEOF)
+
+	r.NoError(reader.Close())
+	_, err = reader.ReadLabels(0, 1)
+	r.ErrorIs(err, os.ErrClosed)
+}
+
+func TestOpenLabelsReaderAt(t *testing.T) {
+	r := require.New(t)
+	datadir := t.TempDir()
+
+	_, err := OpenLabelsReaderAt(datadir, 8)
+	r.ErrorIs(err, os.ErrNotExist)
+
+	storage := NewDirStorage(datadir)
+	createFile(t, storage, 0, []byte{0, 1, 2})
+	createFile(t, storage, 1, []byte{3, 4, 5})
+	data, err := json.Marshal(shared.PostMetadata{LabelsPerUnit: 2, NumUnits: 3, MaxFileSize: 3})
+	r.NoError(err)
+	r.NoError(os.WriteFile(filepath.Join(datadir, shared.MetadataFileName), data, shared.OwnerReadWrite))
+
+	reader, err := OpenLabelsReaderAt(datadir, 8)
+	r.NoError(err)
+	defer reader.Close()
+	r.EqualValues(6, reader.NumLabels())
+
+	labels, err := reader.ReadLabels(1, 5)
+	r.NoError(err)
+	r.Equal([]byte{1, 2, 3, 4, 5}, labels)
+}
@@ -1,14 +1,13 @@
 package persistence
 
 import (
-	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 )
 
-type numericalSorter []os.FileInfo
+type numericalSorter []FileInfo
 
 // A compile time check to ensure that numericalSorter fully implements the sort.Interface interface.
 var _ sort.Interface = (*numericalSorter)(nil)
@@ -16,10 +15,10 @@ var _ sort.Interface = (*numericalSorter)(nil)
 func (s numericalSorter) Len() int      { return len(s) }
 func (s numericalSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 func (s numericalSorter) Less(i, j int) bool {
-	nameA := s[i].Name()
+	nameA := s[i].Name
 	nameA = strings.TrimSuffix(nameA, filepath.Ext(nameA))
 
-	nameB := s[j].Name()
+	nameB := s[j].Name
 	nameB = strings.TrimSuffix(nameB, filepath.Ext(nameB))
 
 	// Get the integer values of each filename, placed after the delimiter.
@@ -0,0 +1,147 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+// File is a file of a Storage. Reads and writes at the current offset start at the beginning of the file.
+type File interface {
+	io.ReadWriteSeeker
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+
+	// Size returns the current size of the file in bytes.
+	Size() (int64, error)
+	// Truncate changes the size of the file, it doesn't change the current offset.
+	Truncate(size int64) error
+	// Sync commits the content of the file to stable storage.
+	Sync() error
+}
+
+// ErrPreallocationNotSupported is returned by Preallocate if space can't be preallocated for a file.
+var ErrPreallocationNotSupported = errors.New("preallocation not supported")
+
+// FileInfo describes a file of a Storage.
+type FileInfo struct {
+	Name string
+	Size int64
+}
+
+// Storage is where the labels of an initialization are kept. Files are identified by their name (e.g. the one
+// returned by shared.InitFileName), methods return an error wrapping fs.ErrNotExist for files that don't exist.
+//
+// All labels are read and written through a Storage, except when generating a proof: the native prover reads the
+// labels from a single directory, see LinkDataDir.
+type Storage interface {
+	// Open opens a file for reading.
+	Open(name string) (File, error)
+	// OpenFile opens a file for reading and writing. If create is true the file is created if it doesn't exist.
+	OpenFile(name string, create bool) (File, error)
+	// List returns all files of the storage.
+	List() ([]FileInfo, error)
+	// Stat returns information about a file.
+	Stat(name string) (FileInfo, error)
+	// Truncate changes the size of a file.
+	Truncate(name string, size int64) error
+	// Remove deletes a file.
+	Remove(name string) error
+}
+
+// DirStorage is a Storage that keeps files in a directory of the local file system.
+type DirStorage struct {
+	dir string
+}
+
+// A compile time check to ensure that DirStorage fully implements the Storage interface.
+var _ Storage = (*DirStorage)(nil)
+
+// NewDirStorage returns a Storage that keeps files in the given directory. The directory is created when the first
+// file is created.
+func NewDirStorage(dir string) *DirStorage {
+	return &DirStorage{dir: dir}
+}
+
+// Dir returns the directory of the storage.
+func (s *DirStorage) Dir() string {
+	return s.dir
+}
+
+func (s *DirStorage) Open(name string) (File, error) {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return dirFile{f}, nil
+}
+
+func (s *DirStorage) OpenFile(name string, create bool) (File, error) {
+	flag := os.O_RDWR
+	if create {
+		if err := os.MkdirAll(s.dir, shared.OwnerReadWriteExec); err != nil {
+			return nil, err
+		}
+		flag |= os.O_CREATE
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, name), flag, shared.OwnerReadWrite)
+	if err != nil {
+		return nil, err
+	}
+	return dirFile{f}, nil
+}
+
+// List returns the regular files of the directory. If the directory doesn't exist the list is empty.
+func (s *DirStorage) List() ([]FileInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	files := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, FileInfo{Name: info.Name(), Size: info.Size()})
+	}
+	return files, nil
+}
+
+func (s *DirStorage) Stat(name string) (FileInfo, error) {
+	info, err := os.Stat(filepath.Join(s.dir, name))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{Name: info.Name(), Size: info.Size()}, nil
+}
+
+func (s *DirStorage) Truncate(name string, size int64) error {
+	return os.Truncate(filepath.Join(s.dir, name), size)
+}
+
+func (s *DirStorage) Remove(name string) error {
+	return os.Remove(filepath.Join(s.dir, name))
+}
+
+type dirFile struct {
+	*os.File
+}
+
+func (f dirFile) Size() (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,110 @@
+package persistence
+
+import (
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	storages := map[string]func(t *testing.T) Storage{
+		"dir": func(t *testing.T) Storage { return NewDirStorage(t.TempDir()) },
+		"mem": func(t *testing.T) Storage { return NewMemStorage() },
+	}
+
+	for name, newStorage := range storages {
+		newStorage := newStorage
+		t.Run(name, func(t *testing.T) {
+			r := require.New(t)
+			s := newStorage(t)
+
+			_, err := s.Open("missing")
+			r.ErrorIs(err, fs.ErrNotExist)
+			_, err = s.OpenFile("missing", false)
+			r.ErrorIs(err, fs.ErrNotExist)
+			_, err = s.Stat("missing")
+			r.ErrorIs(err, fs.ErrNotExist)
+			r.ErrorIs(s.Remove("missing"), fs.ErrNotExist)
+
+			f, err := s.OpenFile("a", true)
+			r.NoError(err)
+			_, err = f.Write([]byte("hello world"))
+			r.NoError(err)
+			_, err = f.WriteAt([]byte("W"), 6)
+			r.NoError(err)
+			r.NoError(f.Truncate(9))
+			size, err := f.Size()
+			r.NoError(err)
+			r.EqualValues(9, size)
+			r.NoError(f.Sync())
+			r.NoError(f.Close())
+
+			f, err = s.Open("a")
+			r.NoError(err)
+			data, err := io.ReadAll(f)
+			r.NoError(err)
+			r.Equal("hello Wor", string(data))
+			p := make([]byte, 3)
+			_, err = f.ReadAt(p, 6)
+			r.NoError(err)
+			r.Equal("Wor", string(p))
+			r.NoError(f.Close())
+
+			r.NoError(s.Truncate("a", 5))
+			info, err := s.Stat("a")
+			r.NoError(err)
+			r.Equal(FileInfo{Name: "a", Size: 5}, info)
+
+			files, err := s.List()
+			r.NoError(err)
+			r.Equal([]FileInfo{{Name: "a", Size: 5}}, files)
+
+			r.NoError(s.Remove("a"))
+			files, err = s.List()
+			r.NoError(err)
+			r.Empty(files)
+		})
+	}
+}
+
+func TestMemStorage_LabelsReaderAndWriter(t *testing.T) {
+	req := require.New(t)
+	storage := NewMemStorage()
+
+	var writtenLabels []byte
+	for i, labelGroup := range genLabelGroups(labelSize) {
+		writer, err := OpenLabelsWriter(storage, i, labelSize)
+		req.NoError(err)
+		for _, label := range labelGroup {
+			req.NoError(writer.Write(label))
+			writtenLabels = append(writtenLabels, label...)
+		}
+		req.NoError(writer.Close())
+	}
+
+	// labels can be overwritten in place, but files aren't extended
+	rangeWriter, err := OpenLabelsRangeWriter(storage, 1, labelSize)
+	req.NoError(err)
+	label := NewLabelFromUint64(42, labelSize)
+	req.NoError(rangeWriter.WriteAt(3, label))
+	req.Error(rangeWriter.WriteAt(4, label))
+	req.NoError(rangeWriter.Close())
+	copy(writtenLabels[7*labelSize/8:], label)
+
+	reader, err := NewStorageLabelsReader(storage, labelSize)
+	req.NoError(err)
+	defer reader.Close()
+
+	numLabels, err := reader.NumLabels()
+	req.NoError(err)
+	req.EqualValues(16, numLabels)
+
+	readLabels, err := io.ReadAll(reader)
+	req.NoError(err)
+	req.Equal(writtenLabels, readLabels)
+
+	_, err = NewStorageLabelsReader(NewMemStorage(), labelSize)
+	req.Error(err)
+}
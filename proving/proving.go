@@ -11,6 +11,7 @@ import (
 	"github.com/spacemeshos/post/config"
 	"github.com/spacemeshos/post/initialization"
 	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/persistence"
 	"github.com/spacemeshos/post/shared"
 )
 
@@ -34,7 +35,14 @@ func Generate(ctx context.Context, ch shared.Challenge, cfg config.Config, logge
 		provingOpts = append(provingOpts, postrs.WithPowCreator(options.powCreatorId))
 	}
 
-	result, err := postrs.GenerateProof(options.datadir, ch, logger, options.nonces, options.threads, cfg.K1, cfg.K2, cfg.PowDifficulty, options.powFlags, provingOpts...)
+	// The native prover reads all files from a single directory.
+	dir, cleanup, err := persistence.LinkDataDir(options.datadir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("linking data directory: %w", err)
+	}
+	defer cleanup()
+
+	result, err := postrs.GenerateProof(dir, ch, logger, options.nonces, options.threads, cfg.K1, cfg.K2, cfg.PowDifficulty, options.powFlags, provingOpts...)
 	if err != nil {
 		return nil, nil, fmt.Errorf("generating proof: %w", err)
 	}
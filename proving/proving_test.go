@@ -26,7 +26,7 @@ func getTestConfig(tb testing.TB) (config.Config, config.InitOpts) {
 	opts.Scrypt.N = 16 // speed up initialization
 	opts.DataDir = tb.TempDir()
 	opts.NumUnits = cfg.MinNumUnits
-	opts.ProviderID = int(postrs.CPUProviderID())
+	opts.ProviderIDs = []uint{postrs.CPUProviderID()}
 	opts.ComputeBatchSize = 1 << 14
 	return cfg, opts
 }
@@ -187,7 +187,7 @@ func Test_Generate_TestNetSettings(t *testing.T) {
 
 	opts := config.DefaultInitOpts()
 	opts.Scrypt.N = 16
-	opts.ProviderID = int(postrs.CPUProviderID())
+	opts.ProviderIDs = []uint{postrs.CPUProviderID()}
 	opts.NumUnits = 2
 	opts.DataDir = t.TempDir()
 
@@ -10,6 +10,13 @@ var (
 	ErrInitCompleted    = errors.New("already completed")
 	ErrInitNotCompleted = errors.New("not completed")
 	ErrProofNotExist    = errors.New("proof doesn't exist")
+
+	// ErrMalformedEncoding is returned when decoding a VersionedProof or VersionedProofMetadata from data that isn't
+	// a valid encoding.
+	ErrMalformedEncoding = errors.New("malformed encoding")
+	// ErrUnsupportedEncodingVersion is returned when decoding a VersionedProof or VersionedProofMetadata of an unknown
+	// version.
+	ErrUnsupportedEncodingVersion = errors.New("unsupported encoding version")
 )
 
 type ConfigMismatchError struct {
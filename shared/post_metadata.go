@@ -5,8 +5,21 @@ import (
 	"encoding/json"
 )
 
+// MetadataFileName is the name of the file the PostMetadata is stored in.
+const MetadataFileName = "postdata_metadata.json"
+
+// MetadataBackupFileName is the name of the file the previous PostMetadata is kept in, in case the current one is
+// corrupted.
+const MetadataBackupFileName = MetadataFileName + ".bak"
+
+// MetadataVersion is the version of the PostMetadata format. It is increased whenever the format changes in a way
+// that requires a migration of existing metadata.
+const MetadataVersion = 1
+
 // PostMetadata is the data associated with the PoST init procedure, persisted in the datadir next to the init files.
 type PostMetadata struct {
+	Version uint32 `json:",omitempty"`
+
 	NodeId          []byte
 	CommitmentAtxId []byte
 
@@ -16,6 +29,9 @@ type PostMetadata struct {
 	Nonce         *uint64    `json:",omitempty"`
 	NonceValue    NonceValue `json:",omitempty"`
 	LastPosition  *uint64    `json:",omitempty"`
+
+	// FileDirs is the directory of every label file by index, if the files are spread over multiple directories.
+	FileDirs map[int]string `json:",omitempty"`
 }
 
 type NonceValue []byte
@@ -0,0 +1,337 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ProofEncodingVersion is the version of the binary and JSON encoding of VersionedProof and VersionedProofMetadata.
+// It is the first byte of the binary encoding and the `Version` field of the JSON encoding.
+const ProofEncodingVersion = 1
+
+// VersionedProof is the versioned wire format of a Proof, in binary and in JSON. Decoding is strict, so that every
+// proof has exactly one binary encoding and, apart from whitespace and the order of fields, one JSON encoding. Proof
+// itself keeps the default encodings of Go.
+type VersionedProof Proof
+
+// VersionedProofMetadata is the versioned wire format of ProofMetadata, in binary and in JSON. Decoding is strict.
+// ProofMetadata itself keeps the default encodings of Go.
+type VersionedProofMetadata ProofMetadata
+
+const (
+	// MaxProofIndicesSize is the maximum size of the compressed indices of a proof that is encoded or decoded. It
+	// allows K2 up to 512 with 64 bit indices.
+	MaxProofIndicesSize = 4096
+
+	// proofHeaderSize is the size of the binary encoding of a proof without its indices:
+	// version (1) | nonce (4) | pow (8) | length of the indices (2), integers are little endian.
+	proofHeaderSize = 1 + 4 + 8 + 2
+
+	// ProofMetadataSize is the size of the binary encoding of ProofMetadata:
+	// version (1) | nodeId (32) | commitmentAtxId (32) | challenge (32) | numUnits (4) | labelsPerUnit (8), integers
+	// are little endian.
+	ProofMetadataSize = 1 + 32 + 32 + 32 + 4 + 8
+)
+
+// MarshalBinary returns the canonical binary encoding of the proof.
+func (p VersionedProof) MarshalBinary() ([]byte, error) {
+	if err := validateProofIndices(p.Indices); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, proofHeaderSize+len(p.Indices))
+	data = append(data, ProofEncodingVersion)
+	data = binary.LittleEndian.AppendUint32(data, p.Nonce)
+	data = binary.LittleEndian.AppendUint64(data, p.Pow)
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(p.Indices)))
+	data = append(data, p.Indices...)
+	return data, nil
+}
+
+// UnmarshalBinary decodes a proof from its binary encoding. It fails for any input that isn't exactly the encoding
+// returned by MarshalBinary.
+func (p *VersionedProof) UnmarshalBinary(data []byte) error {
+	if err := checkEncodingVersion(data); err != nil {
+		return err
+	}
+	if len(data) < proofHeaderSize {
+		return fmt.Errorf("%w: proof too short; expected: >= %d bytes, given: %d", ErrMalformedEncoding, proofHeaderSize, len(data))
+	}
+	size := int(binary.LittleEndian.Uint16(data[13:]))
+	if len(data) != proofHeaderSize+size {
+		return fmt.Errorf("%w: invalid proof length; expected: %d bytes, given: %d", ErrMalformedEncoding, proofHeaderSize+size, len(data))
+	}
+	indices := data[proofHeaderSize:]
+	if err := validateProofIndices(indices); err != nil {
+		return err
+	}
+
+	*p = VersionedProof{
+		Nonce:   binary.LittleEndian.Uint32(data[1:]),
+		Indices: append([]byte(nil), indices...),
+		Pow:     binary.LittleEndian.Uint64(data[5:]),
+	}
+	return nil
+}
+
+// proofJSON is the JSON encoding of VersionedProof.
+type proofJSON struct {
+	Version uint32
+	Nonce   uint32
+	Indices hexBytes
+	Pow     uint64
+}
+
+// MarshalJSON returns the JSON encoding of the proof, with the indices in hex.
+func (p VersionedProof) MarshalJSON() ([]byte, error) {
+	if err := validateProofIndices(p.Indices); err != nil {
+		return nil, err
+	}
+	return json.Marshal(proofJSON{
+		Version: ProofEncodingVersion,
+		Nonce:   p.Nonce,
+		Indices: p.Indices,
+		Pow:     p.Pow,
+	})
+}
+
+// UnmarshalJSON decodes a proof from its JSON encoding. All fields are required, their names must match exactly and
+// unknown or duplicate fields are rejected. The indices must be lowercase hex.
+func (p *VersionedProof) UnmarshalJSON(data []byte) error {
+	var v proofJSON
+	if err := decodeStrictJSON(data, &v, "Version", "Nonce", "Indices", "Pow"); err != nil {
+		return err
+	}
+	if v.Version != ProofEncodingVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedEncodingVersion, v.Version)
+	}
+	if err := validateProofIndices(v.Indices); err != nil {
+		return err
+	}
+
+	*p = VersionedProof{
+		Nonce:   v.Nonce,
+		Indices: v.Indices,
+		Pow:     v.Pow,
+	}
+	return nil
+}
+
+func validateProofIndices(indices []byte) error {
+	switch {
+	case len(indices) == 0:
+		return fmt.Errorf("%w: proof indices are empty", ErrMalformedEncoding)
+	case len(indices) > MaxProofIndicesSize:
+		return fmt.Errorf("%w: proof indices too big; expected: <= %d bytes, given: %d", ErrMalformedEncoding, MaxProofIndicesSize, len(indices))
+	}
+	return nil
+}
+
+// MarshalBinary returns the canonical binary encoding of the proof metadata.
+func (m VersionedProofMetadata) MarshalBinary() ([]byte, error) {
+	if err := m.validateLengths(); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, ProofMetadataSize)
+	data = append(data, ProofEncodingVersion)
+	data = append(data, m.NodeId...)
+	data = append(data, m.CommitmentAtxId...)
+	data = append(data, m.Challenge...)
+	data = binary.LittleEndian.AppendUint32(data, m.NumUnits)
+	data = binary.LittleEndian.AppendUint64(data, m.LabelsPerUnit)
+	return data, nil
+}
+
+// UnmarshalBinary decodes proof metadata from its binary encoding. It fails for any input that isn't exactly the
+// encoding returned by MarshalBinary.
+func (m *VersionedProofMetadata) UnmarshalBinary(data []byte) error {
+	if err := checkEncodingVersion(data); err != nil {
+		return err
+	}
+	if len(data) != ProofMetadataSize {
+		return fmt.Errorf("%w: invalid proof metadata length; expected: %d bytes, given: %d", ErrMalformedEncoding, ProofMetadataSize, len(data))
+	}
+
+	*m = VersionedProofMetadata{
+		NodeId:          append([]byte(nil), data[1:33]...),
+		CommitmentAtxId: append([]byte(nil), data[33:65]...),
+		Challenge:       append(Challenge(nil), data[65:97]...),
+		NumUnits:        binary.LittleEndian.Uint32(data[97:]),
+		LabelsPerUnit:   binary.LittleEndian.Uint64(data[101:]),
+	}
+	return nil
+}
+
+// proofMetadataJSON is the JSON encoding of VersionedProofMetadata.
+type proofMetadataJSON struct {
+	Version         uint32
+	NodeId          hexBytes
+	CommitmentAtxId hexBytes
+	Challenge       hexBytes
+	NumUnits        uint32
+	LabelsPerUnit   uint64
+}
+
+// MarshalJSON returns the JSON encoding of the proof metadata, with the ids and the challenge in hex.
+func (m VersionedProofMetadata) MarshalJSON() ([]byte, error) {
+	if err := m.validateLengths(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(proofMetadataJSON{
+		Version:         ProofEncodingVersion,
+		NodeId:          m.NodeId,
+		CommitmentAtxId: m.CommitmentAtxId,
+		Challenge:       hexBytes(m.Challenge),
+		NumUnits:        m.NumUnits,
+		LabelsPerUnit:   m.LabelsPerUnit,
+	})
+}
+
+// UnmarshalJSON decodes proof metadata from its JSON encoding. All fields are required, their names must match
+// exactly and unknown or duplicate fields are rejected. The ids and the challenge must be lowercase hex.
+func (m *VersionedProofMetadata) UnmarshalJSON(data []byte) error {
+	var v proofMetadataJSON
+	err := decodeStrictJSON(data, &v, "Version", "NodeId", "CommitmentAtxId", "Challenge", "NumUnits", "LabelsPerUnit")
+	if err != nil {
+		return err
+	}
+	if v.Version != ProofEncodingVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedEncodingVersion, v.Version)
+	}
+
+	decoded := VersionedProofMetadata{
+		NodeId:          v.NodeId,
+		CommitmentAtxId: v.CommitmentAtxId,
+		Challenge:       Challenge(v.Challenge),
+		NumUnits:        v.NumUnits,
+		LabelsPerUnit:   v.LabelsPerUnit,
+	}
+	if err := decoded.validateLengths(); err != nil {
+		return err
+	}
+	*m = decoded
+	return nil
+}
+
+func (m *VersionedProofMetadata) validateLengths() error {
+	switch {
+	case len(m.NodeId) != 32:
+		return fmt.Errorf("%w: invalid `nodeId` length; expected: 32, given: %v", ErrMalformedEncoding, len(m.NodeId))
+	case len(m.CommitmentAtxId) != 32:
+		return fmt.Errorf("%w: invalid `commitmentAtxId` length; expected: 32, given: %v", ErrMalformedEncoding, len(m.CommitmentAtxId))
+	case len(m.Challenge) != 32:
+		return fmt.Errorf("%w: invalid `challenge` length; expected: 32, given: %v", ErrMalformedEncoding, len(m.Challenge))
+	}
+	return nil
+}
+
+func checkEncodingVersion(data []byte) error {
+	switch {
+	case len(data) == 0:
+		return fmt.Errorf("%w: no data", ErrMalformedEncoding)
+	case data[0] != ProofEncodingVersion:
+		return fmt.Errorf("%w: %d", ErrUnsupportedEncodingVersion, data[0])
+	}
+	return nil
+}
+
+// decodeStrictJSON decodes a JSON object into v. The object must have exactly the given fields, each once and with its
+// name spelled exactly as given, without escapes. Trailing data is rejected.
+func decodeStrictJSON(data []byte, v any, fields ...string) error {
+	if err := checkJSONFields(data, fields); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedEncoding, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedEncoding, err)
+	}
+	return nil
+}
+
+// checkJSONFields checks that data is a single JSON object with exactly the given fields. Unlike encoding/json it
+// doesn't match names case-insensitively and doesn't accept duplicate fields.
+func checkJSONFields(data []byte, fields []string) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('{') {
+		return errors.New("not an object")
+	}
+
+	seen := make(map[string]bool, len(fields))
+	for dec.More() {
+		start := dec.InputOffset()
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name, _ := t.(string)
+		raw := string(bytes.TrimLeft(data[start:dec.InputOffset()], " \t\r\n,"))
+		switch {
+		case !containsString(fields, name) || raw != `"`+name+`"`:
+			return fmt.Errorf("unknown field %s", raw)
+		case seen[name]:
+			return fmt.Errorf("duplicate field `%s`", name)
+		}
+		seen[name] = true
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("trailing data after object")
+	}
+
+	for _, name := range fields {
+		if !seen[name] {
+			return fmt.Errorf("missing field `%s`", name)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hexBytes is encoded as a lowercase hex string in JSON.
+type hexBytes []byte
+
+func (b hexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(b))
+}
+
+func (b *hexBytes) UnmarshalJSON(data []byte) error {
+	var hexString string
+	if err := json.Unmarshal(data, &hexString); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(hexString)
+	if err != nil {
+		return err
+	}
+	// only the encoding returned by MarshalJSON is accepted, e.g. no uppercase digits or escapes
+	if string(data) != `"`+hex.EncodeToString(decoded)+`"` {
+		return fmt.Errorf("not lowercase hex: %s", data)
+	}
+	*b = decoded
+	return nil
+}
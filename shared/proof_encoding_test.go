@@ -0,0 +1,278 @@
+package shared_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+func testProof() shared.VersionedProof {
+	return shared.VersionedProof{
+		Nonce:   7,
+		Indices: []byte{0x01, 0x02, 0x03, 0xff},
+		Pow:     1<<63 + 5,
+	}
+}
+
+func testProofMetadata() shared.VersionedProofMetadata {
+	return shared.VersionedProofMetadata{
+		NodeId:          bytes.Repeat([]byte{0x01}, 32),
+		CommitmentAtxId: bytes.Repeat([]byte{0x02}, 32),
+		Challenge:       bytes.Repeat([]byte{0x03}, 32),
+		NumUnits:        4,
+		LabelsPerUnit:   1 << 32,
+	}
+}
+
+func TestVersionedProof_Binary(t *testing.T) {
+	r := require.New(t)
+	p := testProof()
+
+	data, err := p.MarshalBinary()
+	r.NoError(err)
+	r.Equal([]byte{
+		shared.ProofEncodingVersion,
+		7, 0, 0, 0, // nonce
+		5, 0, 0, 0, 0, 0, 0, 0x80, // pow
+		4, 0, // length of the indices
+		0x01, 0x02, 0x03, 0xff,
+	}, data)
+
+	var decoded shared.VersionedProof
+	r.NoError(decoded.UnmarshalBinary(data))
+	r.Equal(p, decoded)
+
+	// decoding is strict
+	r.ErrorIs(decoded.UnmarshalBinary(nil), shared.ErrMalformedEncoding)
+	r.ErrorIs(decoded.UnmarshalBinary(data[:len(data)-1]), shared.ErrMalformedEncoding)
+	r.ErrorIs(decoded.UnmarshalBinary(append(data, 0)), shared.ErrMalformedEncoding)
+	other := append([]byte(nil), data...)
+	other[0] = shared.ProofEncodingVersion + 1
+	r.ErrorIs(decoded.UnmarshalBinary(other), shared.ErrUnsupportedEncodingVersion)
+	r.Equal(p, decoded, "failed decoding doesn't modify the proof")
+
+	// size limits
+	p.Indices = nil
+	_, err = p.MarshalBinary()
+	r.ErrorIs(err, shared.ErrMalformedEncoding)
+	p.Indices = make([]byte, shared.MaxProofIndicesSize+1)
+	_, err = p.MarshalBinary()
+	r.ErrorIs(err, shared.ErrMalformedEncoding)
+	p.Indices = make([]byte, shared.MaxProofIndicesSize)
+	data, err = p.MarshalBinary()
+	r.NoError(err)
+	r.NoError(decoded.UnmarshalBinary(data))
+	r.Equal(p, decoded)
+}
+
+func TestVersionedProof_JSON(t *testing.T) {
+	r := require.New(t)
+	p := testProof()
+
+	data, err := json.Marshal(p)
+	r.NoError(err)
+	r.JSONEq(`{"Version":1,"Nonce":7,"Indices":"010203ff","Pow":9223372036854775813}`, string(data))
+
+	var decoded shared.VersionedProof
+	r.NoError(json.Unmarshal(data, &decoded))
+	r.Equal(p, decoded)
+
+	// pointers and values encode the same
+	ptrData, err := json.Marshal(&p)
+	r.NoError(err)
+	r.Equal(data, ptrData)
+
+	for _, invalid := range []string{
+		`{"Version":2,"Nonce":7,"Indices":"010203ff","Pow":5}`,
+		`{"Nonce":7,"Indices":"010203ff","Pow":5}`,
+		`{"Version":1,"Indices":"010203ff","Pow":5}`,
+		`{"Version":1,"Nonce":7,"Indices":"010203ff","Pow":5,"Other":1}`,
+		`{"Version":1,"Nonce":7,"Indices":"0102zz","Pow":5}`,
+		`{"Version":1,"Nonce":7,"Indices":"","Pow":5}`,
+		`{"Version":1,"Nonce":-1,"Indices":"010203ff","Pow":5}`,
+		`null`,
+		`[]`,
+		// every proof has a single encoding
+		`{"Version":1,"Nonce":7,"Indices":"010203FF","Pow":5}`,
+		`{"Version":1,"Nonce":7,"Indices":"\u0030\u0031\u0030203ff","Pow":5}`,
+		`{"version":1,"Nonce":7,"Indices":"010203ff","Pow":5}`,
+		`{"Version":1,"NONCE":7,"Indices":"010203ff","Pow":5}`,
+		`{"Version":1,"\u004eonce":7,"Indices":"010203ff","Pow":5}`,
+		`{"Version":1,"Nonce":7,"Nonce":8,"Indices":"010203ff","Pow":5}`,
+		`{"Version":1,"Nonce":7,"Indices":"010203ff","Pow":5,"Pow":5}`,
+		`{"Version":1,"Nonce":7.0,"Indices":"010203ff","Pow":5}`,
+		`{"Version":1,"Nonce":7,"Indices":"010203ff","Pow":5} {}`,
+	} {
+		r.Error(json.Unmarshal([]byte(invalid), &decoded), invalid)
+	}
+	r.Equal(p, decoded)
+
+	// whitespace and the order of fields don't matter, e.g. in indented files
+	r.NoError(json.Unmarshal([]byte(`{
+		"Pow": 9223372036854775813,
+		"Indices": "010203ff",
+		"Nonce": 7,
+		"Version": 1
+	}`), &decoded))
+	r.Equal(p, decoded)
+}
+
+func TestVersionedProofMetadata_Binary(t *testing.T) {
+	r := require.New(t)
+	m := testProofMetadata()
+
+	data, err := m.MarshalBinary()
+	r.NoError(err)
+	r.Len(data, shared.ProofMetadataSize)
+
+	var decoded shared.VersionedProofMetadata
+	r.NoError(decoded.UnmarshalBinary(data))
+	r.Equal(m, decoded)
+
+	r.ErrorIs(decoded.UnmarshalBinary(data[:len(data)-1]), shared.ErrMalformedEncoding)
+	r.ErrorIs(decoded.UnmarshalBinary(append(data, 0)), shared.ErrMalformedEncoding)
+	data[0] = 0
+	r.ErrorIs(decoded.UnmarshalBinary(data), shared.ErrUnsupportedEncodingVersion)
+
+	m.Challenge = m.Challenge[:31]
+	_, err = m.MarshalBinary()
+	r.ErrorIs(err, shared.ErrMalformedEncoding)
+}
+
+func TestVersionedProofMetadata_JSON(t *testing.T) {
+	r := require.New(t)
+	m := testProofMetadata()
+
+	data, err := json.Marshal(m)
+	r.NoError(err)
+	r.JSONEq(`{
+		"Version": 1,
+		"NodeId": "0101010101010101010101010101010101010101010101010101010101010101",
+		"CommitmentAtxId": "0202020202020202020202020202020202020202020202020202020202020202",
+		"Challenge": "0303030303030303030303030303030303030303030303030303030303030303",
+		"NumUnits": 4,
+		"LabelsPerUnit": 4294967296
+	}`, string(data))
+
+	var decoded shared.VersionedProofMetadata
+	r.NoError(json.Unmarshal(data, &decoded))
+	r.Equal(m, decoded)
+
+	// ids must be 32 bytes
+	var fields map[string]any
+	r.NoError(json.Unmarshal(data, &fields))
+	fields["NodeId"] = "0101"
+	invalid, err := json.Marshal(fields)
+	r.NoError(err)
+	r.ErrorIs(decoded.UnmarshalJSON(invalid), shared.ErrMalformedEncoding)
+
+	delete(fields, "NodeId")
+	invalid, err = json.Marshal(fields)
+	r.NoError(err)
+	r.ErrorIs(decoded.UnmarshalJSON(invalid), shared.ErrMalformedEncoding)
+
+	// uppercase hex
+	fields["NodeId"] = strings.Repeat("AB", 32)
+	invalid, err = json.Marshal(fields)
+	r.NoError(err)
+	r.ErrorIs(decoded.UnmarshalJSON(invalid), shared.ErrMalformedEncoding)
+
+	// names that don't match exactly
+	delete(fields, "NodeId")
+	fields["nodeId"] = strings.Repeat("01", 32)
+	invalid, err = json.Marshal(fields)
+	r.NoError(err)
+	r.ErrorIs(decoded.UnmarshalJSON(invalid), shared.ErrMalformedEncoding)
+
+	// duplicate fields
+	invalid = append(data[:len(data)-1:len(data)-1], []byte(`,"NumUnits":5}`)...)
+	r.ErrorIs(decoded.UnmarshalJSON(invalid), shared.ErrMalformedEncoding)
+	r.Equal(m, decoded)
+}
+
+func FuzzVersionedProof_UnmarshalBinary(f *testing.F) {
+	p := testProof()
+	data, err := p.MarshalBinary()
+	require.NoError(f, err)
+	f.Add(data)
+	f.Add([]byte{shared.ProofEncodingVersion})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p shared.VersionedProof
+		if err := p.UnmarshalBinary(data); err != nil {
+			return
+		}
+		// the encoding is canonical, everything that decodes encodes to the same bytes
+		encoded, err := p.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, data, encoded)
+	})
+}
+
+func FuzzVersionedProofMetadata_UnmarshalBinary(f *testing.F) {
+	m := testProofMetadata()
+	data, err := m.MarshalBinary()
+	require.NoError(f, err)
+	f.Add(data)
+	f.Add([]byte{shared.ProofEncodingVersion})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var m shared.VersionedProofMetadata
+		if err := m.UnmarshalBinary(data); err != nil {
+			return
+		}
+		encoded, err := m.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, data, encoded)
+	})
+}
+
+func FuzzVersionedProof_UnmarshalJSON(f *testing.F) {
+	p := testProof()
+	data, err := json.Marshal(p)
+	require.NoError(f, err)
+	f.Add(data)
+	f.Add([]byte(`{"Version":1}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p shared.VersionedProof
+		if err := json.Unmarshal(data, &p); err != nil {
+			return
+		}
+		encoded, err := json.Marshal(p)
+		require.NoError(t, err)
+		var decoded shared.VersionedProof
+		require.NoError(t, json.Unmarshal(encoded, &decoded))
+		require.Equal(t, p, decoded)
+	})
+}
+
+func TestProof_DefaultEncoding(t *testing.T) {
+	r := require.New(t)
+
+	// Proof and ProofMetadata keep the default JSON encoding, including their zero values
+	for _, v := range []any{shared.Proof{}, shared.ProofMetadata{}} {
+		_, err := json.Marshal(v)
+		r.NoError(err)
+	}
+
+	p := shared.Proof(testProof())
+	data, err := json.Marshal(p)
+	r.NoError(err)
+	r.JSONEq(`{"Nonce":7,"Indices":"AQID/w==","Pow":9223372036854775813}`, string(data))
+
+	var decoded shared.Proof
+	r.NoError(json.Unmarshal(data, &decoded))
+	r.Equal(p, decoded)
+
+	// the versioned encoding is only used by the wire types
+	versioned, err := json.Marshal(shared.VersionedProof(p))
+	r.NoError(err)
+	r.JSONEq(`{"Version":1,"Nonce":7,"Indices":"010203ff","Pow":9223372036854775813}`, string(versioned))
+}
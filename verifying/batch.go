@@ -0,0 +1,46 @@
+package verifying
+
+import (
+	"context"
+	"runtime"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/spacemeshos/post/shared"
+)
+
+// BatchItem is a proof and its metadata to be verified with VerifyBatch.
+type BatchItem struct {
+	Proof    *shared.Proof
+	Metadata *shared.ProofMetadata
+}
+
+// verifyBatch verifies the items with up to concurrency verifications running at the same time and returns the
+// result of every item at its index. Items that aren't verified yet when ctx is canceled fail with the error of ctx.
+func verifyBatch(ctx context.Context, items []BatchItem, concurrency int, verify func(*shared.Proof, *shared.ProofMetadata) error) []error {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	results := make([]error, len(items))
+	var eg errgroup.Group
+	eg.SetLimit(concurrency)
+	for i, item := range items {
+		if err := ctx.Err(); err != nil {
+			results[i] = err
+			continue
+		}
+
+		i, item := i, item
+		eg.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				results[i] = err
+				return nil
+			}
+			results[i] = verify(item.Proof, item.Metadata)
+			return nil
+		})
+	}
+	eg.Wait()
+	return results
+}
@@ -0,0 +1,283 @@
+//go:build goverifier
+
+package verifying
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/zeebo/blake3"
+	"go.uber.org/zap"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/internal/scrypt"
+	"github.com/spacemeshos/post/shared"
+)
+
+const (
+	// noncesPerAES is the number of nonces that share one AES cipher when proving, they form a nonce group.
+	noncesPerAES = 16
+
+	// labelLength is the length of a label in bytes.
+	labelLength = config.BitsPerLabel / 8
+)
+
+// ErrNoPowVerifier is returned by a GoProofVerifier that has no PowVerifier set.
+var ErrNoPowVerifier = errors.New("no pow verifier set")
+
+// PowVerifier checks the RandomX proof of work of a proof. It is meant to be implemented with a RandomX binding in
+// light mode, so that proofs can be verified without the native library.
+type PowVerifier interface {
+	// VerifyPow returns nil if pow is a valid proof of work for the nonce group, the first 8 bytes of the challenge and
+	// the miner id, i.e. if its RandomX hash is below the difficulty.
+	VerifyPow(pow uint64, nonceGroup uint8, challenge [8]byte, difficulty [32]byte, minerId []byte) error
+}
+
+// GoProofVerifier verifies proofs like ProofVerifier, but is written in Go: labels are computed with a Go
+// implementation of scrypt and the proof of work is checked with the PowVerifier set with WithPowVerifier. It doesn't
+// need cgo or the native library.
+//
+// It is only built with the goverifier build tag: until it is checked against the known answers of post-rs in
+// testdata/postrs_vectors.json it may disagree with the native verifier.
+type GoProofVerifier struct {
+	options *option
+}
+
+// NewGoProofVerifier creates a new proof verifier written in Go.
+//
+// This package doesn't ship a PowVerifier: it must be set with WithPowVerifier, either here or for every call to
+// Verify. Without one every proof is rejected with ErrNoPowVerifier.
+func NewGoProofVerifier(opts ...OptionFunc) (*GoProofVerifier, error) {
+	options, err := applyOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GoProofVerifier{options: options}, nil
+}
+
+// Close releases the resources of the verifier. It exists for symmetry with ProofVerifier.
+func (v *GoProofVerifier) Close() error {
+	return nil
+}
+
+// Verify ensures the validity of a proof in respect to its metadata.
+// It returns nil if the proof is valid or an error describing the failure, otherwise.
+func (v *GoProofVerifier) Verify(p *shared.Proof, m *shared.ProofMetadata, cfg config.Config, logger *zap.Logger, opts ...OptionFunc) error {
+	options := *v.options
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return err
+		}
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	switch {
+	case p == nil:
+		return errors.New("proof cannot be nil")
+	case m == nil:
+		return errors.New("metadata cannot be nil")
+	case len(m.NodeId) != 32:
+		return fmt.Errorf("%w: invalid `nodeId` length; expected: 32, given: %v", ErrInvalidArgument, len(m.NodeId))
+	case len(m.CommitmentAtxId) != 32:
+		return fmt.Errorf("%w: invalid `commitmentAtxId` length; expected: 32, given: %v", ErrInvalidArgument, len(m.CommitmentAtxId))
+	case len(m.Challenge) != 32:
+		return fmt.Errorf("%w: invalid `challenge` length; expected: 32, given: %v", ErrInvalidArgument, len(m.Challenge))
+	case len(p.Indices) == 0:
+		return fmt.Errorf("%w: proof indices are empty", ErrMalformedIndices)
+	case options.powVerifier == nil:
+		return ErrNoPowVerifier
+	}
+
+	// the proof of work is checked first, it is the cheapest way to reject a proof
+	nonceGroup := p.Nonce / noncesPerAES
+	if nonceGroup > 255 {
+		return fmt.Errorf("%w: nonce group %d is out of range", ErrInvalidPow, nonceGroup)
+	}
+	minerId := m.NodeId
+	if options.powCreatorId != nil {
+		minerId = options.powCreatorId
+	}
+	var challenge [8]byte
+	copy(challenge[:], m.Challenge)
+	if err := options.powVerifier.VerifyPow(p.Pow, uint8(nonceGroup), challenge, cfg.PowDifficulty, minerId); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPow, err)
+	}
+
+	numLabels := uint64(m.NumUnits) * m.LabelsPerUnit
+	difficulty, err := provingDifficulty(cfg.K1, numLabels)
+	if err != nil {
+		return err
+	}
+
+	bitsPerIndex := requiredBits(numLabels)
+	if expected := (bitsPerIndex*uint(cfg.K2) + 7) / 8; uint(len(p.Indices)) != expected {
+		return fmt.Errorf("%w: invalid length; expected: %d, given: %d", ErrMalformedIndices, expected, len(p.Indices))
+	}
+	indices := decompressIndices(p.Indices, bitsPerIndex, int(cfg.K2))
+
+	msbCipher, err := newProofCipher(m.Challenge, nonceGroup, p.Pow)
+	if err != nil {
+		return err
+	}
+	lsbCipher, err := newProofCipher(m.Challenge, nonceGroup, p.Pow, p.Nonce)
+	if err != nil {
+		return err
+	}
+	difficultyMsb := byte(difficulty >> 56)
+	difficultyLsb := difficulty & 0x00ff_ffff_ffff_ffff
+
+	commitment := shared.CommitmentBytes(m.NodeId, m.CommitmentAtxId)
+	label := make([]byte, labelLength)
+	out := make([]byte, aes.BlockSize)
+	for _, position := range selectIndices(len(indices), int(cfg.K3), m.Challenge, p) {
+		index := indices[position]
+		if index >= numLabels {
+			return ErrInvalidIndex{Index: position, Label: index, Err: ErrIndexOutOfRange}
+		}
+		if err := computeLabel(commitment, index, options.labelScrypt, label); err != nil {
+			return fmt.Errorf("failed to compute label %d: %w", index, err)
+		}
+
+		msbCipher.Encrypt(out, label)
+		msb := out[p.Nonce%noncesPerAES]
+		switch {
+		case msb < difficultyMsb:
+			continue
+		case msb > difficultyMsb:
+			logger.Debug("verifying: msb of label doesn't satisfy the difficulty", zap.Uint64("index", index))
+			return ErrInvalidIndex{Index: position, Label: index, Err: ErrLabelAboveDifficulty}
+		}
+
+		lsbCipher.Encrypt(out, label)
+		if lsb := binary.LittleEndian.Uint64(out) & 0x00ff_ffff_ffff_ffff; lsb >= difficultyLsb {
+			logger.Debug("verifying: lsb of label doesn't satisfy the difficulty", zap.Uint64("index", index))
+			return ErrInvalidIndex{Index: position, Label: index, Err: ErrLabelAboveDifficulty}
+		}
+	}
+	return nil
+}
+
+// VerifyBatch verifies the proofs of the items with up to concurrency verifications running at the same time; a
+// concurrency of 0 or less uses one per CPU. The returned slice holds the result of Verify for every item at its
+// index. Items that aren't verified yet when ctx is canceled fail with the error of ctx.
+func (v *GoProofVerifier) VerifyBatch(ctx context.Context, items []BatchItem, cfg config.Config, logger *zap.Logger, concurrency int, opts ...OptionFunc) []error {
+	return verifyBatch(ctx, items, concurrency, func(p *shared.Proof, m *shared.ProofMetadata) error {
+		return v.Verify(p, m, cfg, logger, opts...)
+	})
+}
+
+// provingDifficulty returns the threshold below which the prover expects K1 of numLabels labels, i.e.
+// k1 * 2^64 / numLabels.
+func provingDifficulty(k1 uint32, numLabels uint64) (uint64, error) {
+	if uint64(k1) >= numLabels {
+		return 0, fmt.Errorf("%w: K1 (%d) must be less than the number of labels (%d)", ErrInvalidArgument, k1, numLabels)
+	}
+	difficulty, _ := bits.Div64(uint64(k1), 0, numLabels)
+	return difficulty, nil
+}
+
+// requiredBits returns the number of bits needed to represent n.
+func requiredBits(n uint64) uint {
+	return uint(bits.Len64(n))
+}
+
+// decompressIndices unpacks count indices of the given number of bits each, packed least significant bit first.
+func decompressIndices(data []byte, bitsPerIndex uint, count int) []uint64 {
+	indices := make([]uint64, 0, count)
+	var pos uint
+	for i := 0; i < count; i++ {
+		var index uint64
+		for b := uint(0); b < bitsPerIndex; b++ {
+			if data[pos/8]>>(pos%8)&1 == 1 {
+				index |= 1 << b
+			}
+			pos++
+		}
+		indices = append(indices, index)
+	}
+	return indices
+}
+
+// compressIndices packs the indices with the given number of bits each, least significant bit first.
+func compressIndices(indices []uint64, bitsPerIndex uint) []byte {
+	data := make([]byte, (uint(len(indices))*bitsPerIndex+7)/8)
+	var pos uint
+	for _, index := range indices {
+		for b := uint(0); b < bitsPerIndex; b++ {
+			if index>>b&1 == 1 {
+				data[pos/8] |= 1 << (pos % 8)
+			}
+			pos++
+		}
+	}
+	return data
+}
+
+// selectIndices selects k3 of the numIndices indices of a proof pseudo randomly, seeded with the proof so that the
+// prover can't choose them. It returns the positions of the selected indices in the proof.
+func selectIndices(numIndices, k3 int, challenge []byte, p *shared.Proof) []int {
+	if k3 > numIndices {
+		k3 = numIndices
+	}
+
+	seed := blake3.New()
+	seed.Write(challenge)
+	seed.Write(binary.LittleEndian.AppendUint32(nil, p.Nonce))
+	seed.Write(p.Indices)
+	seed.Write(binary.LittleEndian.AppendUint64(nil, p.Pow))
+
+	// partial Fisher-Yates shuffle with rejection sampling to avoid modulo bias, like post-rs only random values below
+	// u16::MAX - u16::MAX % k are accepted
+	values := make([]int, numIndices)
+	for i := range values {
+		values[i] = i
+	}
+	var counter uint64
+	for i := 0; i < k3; i++ {
+		k := uint64(len(values) - i)
+		maxAllowed := uint64(math.MaxUint16) - uint64(math.MaxUint16)%k
+	sample:
+		for {
+			h := seed.Clone()
+			h.Write(binary.LittleEndian.AppendUint64(nil, counter))
+			counter++
+			hash := h.Sum(nil)
+			for j := 0; j+1 < len(hash); j += 2 {
+				rand := uint64(binary.LittleEndian.Uint16(hash[j:]))
+				if rand < maxAllowed {
+					swap := i + int(rand%k)
+					values[i], values[swap] = values[swap], values[i]
+					break sample
+				}
+			}
+		}
+	}
+	return values[:k3]
+}
+
+// newProofCipher returns the AES cipher the prover encrypts labels with, keyed with the hash of the challenge, nonce
+// group, pow and optionally the nonce.
+func newProofCipher(challenge []byte, nonceGroup uint32, pow uint64, nonce ...uint32) (cipher.Block, error) {
+	h := blake3.New()
+	h.Write(challenge)
+	h.Write(binary.LittleEndian.AppendUint32(nil, nonceGroup))
+	h.Write(binary.LittleEndian.AppendUint64(nil, pow))
+	for _, n := range nonce {
+		h.Write(binary.LittleEndian.AppendUint32(nil, n))
+	}
+	return aes.NewCipher(h.Sum(nil)[:16])
+}
+
+// computeLabel computes the label at the given index with the Go implementation of scrypt.
+func computeLabel(commitment []byte, index uint64, params config.ScryptParams, label []byte) error {
+	password := binary.LittleEndian.AppendUint64(append([]byte(nil), commitment...), index)
+	return scrypt.Key(password, nil, params.N, params.R, params.P, label)
+}
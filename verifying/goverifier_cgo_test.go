@@ -0,0 +1,181 @@
+//go:build cgo && goverifier
+
+package verifying
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/initialization"
+	"github.com/spacemeshos/post/internal/postrs"
+	"github.com/spacemeshos/post/oracle"
+	"github.com/spacemeshos/post/proving"
+	"github.com/spacemeshos/post/shared"
+)
+
+func TestGoLabels_MatchNative(t *testing.T) {
+	r := require.New(t)
+
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	commitmentAtxId[0] = 1
+	params := config.ScryptParams{N: 16, R: 1, P: 1}
+
+	wo, err := oracle.New(
+		oracle.WithProviderID(postrs.CPUProviderID()),
+		oracle.WithCommitment(oracle.CommitmentBytes(nodeId, commitmentAtxId)),
+		oracle.WithScryptParams(params),
+		oracle.WithVRFDifficulty(make([]byte, 32)),
+	)
+	r.NoError(err)
+	defer wo.Close()
+
+	res, err := wo.Positions(0, 63)
+	r.NoError(err)
+
+	commitment := shared.CommitmentBytes(nodeId, commitmentAtxId)
+	label := make([]byte, labelLength)
+	for i := uint64(0); i < 64; i++ {
+		r.NoError(computeLabel(commitment, i, params, label))
+		r.Equal(res.Output[i*labelLength:(i+1)*labelLength], label, "label %d", i)
+	}
+}
+
+func TestGoProofVerifier_MatchesNative(t *testing.T) {
+	r := require.New(t)
+
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	ch := make(shared.Challenge, 32)
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+	cfg, opts := getTestConfig(t)
+	opts.Scrypt.N = 16
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+		initialization.WithLogger(logger),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+
+	proof, proofMetadata, err := proving.Generate(
+		context.Background(),
+		ch,
+		cfg,
+		logger,
+		proving.WithDataSource(cfg, nodeId, commitmentAtxId, opts.DataDir),
+	)
+	r.NoError(err)
+
+	native, err := NewProofVerifier()
+	r.NoError(err)
+	defer native.Close()
+
+	// the proof of work is checked by the native verifier, the Go verifier is compared on everything else
+	goVerifier, err := NewGoProofVerifier(WithPowVerifier(acceptPow))
+	r.NoError(err)
+	defer goVerifier.Close()
+
+	r.NoError(native.Verify(proof, proofMetadata, cfg, logger, WithLabelScryptParams(opts.Scrypt)))
+	r.NoError(goVerifier.Verify(proof, proofMetadata, cfg, logger, WithLabelScryptParams(opts.Scrypt)))
+
+	for i := range proof.Indices {
+		proof.Indices[i] ^= 255 // flip bits in all indices
+	}
+	r.ErrorIs(native.Verify(proof, proofMetadata, cfg, logger, WithLabelScryptParams(opts.Scrypt)), ErrInvalidProof)
+	r.ErrorIs(goVerifier.Verify(proof, proofMetadata, cfg, logger, WithLabelScryptParams(opts.Scrypt)), ErrInvalidProof)
+}
+
+var updateVectors = flag.Bool("update-vectors", false, "write the known answers of the native library to "+postrsVectorsFile)
+
+// TestGoProofVerifier_GenerateVectors computes the known answers TestGoLabels_KnownAnswers and
+// TestGoProofVerifier_KnownAnswers check the Go verifier against. It must run with the real native library.
+func TestGoProofVerifier_GenerateVectors(t *testing.T) {
+	if !*updateVectors {
+		t.Skip("run with -update-vectors to write " + postrsVectorsFile)
+	}
+	r := require.New(t)
+	logger := zaptest.NewLogger(t)
+
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	for i := range nodeId {
+		nodeId[i] = byte(i)
+		commitmentAtxId[i] = byte(255 - i)
+	}
+
+	var vectors postrsVectors
+	for _, params := range []config.ScryptParams{{N: 16, R: 1, P: 1}, config.DefaultLabelParams()} {
+		wo, err := oracle.New(
+			oracle.WithProviderID(postrs.CPUProviderID()),
+			oracle.WithCommitment(oracle.CommitmentBytes(nodeId, commitmentAtxId)),
+			oracle.WithScryptParams(params),
+			oracle.WithVRFDifficulty(make([]byte, 32)),
+		)
+		r.NoError(err)
+		for _, index := range []uint64{0, 1, 255, 1 << 32} {
+			res, err := wo.Position(index)
+			r.NoError(err)
+			vectors.Labels = append(vectors.Labels, labelVector{
+				NodeId:          hex.EncodeToString(nodeId),
+				CommitmentAtxId: hex.EncodeToString(commitmentAtxId),
+				Scrypt:          params,
+				Index:           index,
+				Label:           hex.EncodeToString(res.Output),
+			})
+		}
+		r.NoError(wo.Close())
+	}
+
+	cfg, opts := getTestConfig(t)
+	cfg.K1, cfg.K2, cfg.K3 = 20, 16, 8
+	opts.Scrypt.N = 16
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+		initialization.WithLogger(logger),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+
+	native, err := NewProofVerifier()
+	r.NoError(err)
+	defer native.Close()
+	for _, ch := range []shared.Challenge{make(shared.Challenge, 32), bytes.Repeat([]byte{0xab}, 32)} {
+		proof, metadata, err := proving.Generate(context.Background(), ch, cfg, logger,
+			proving.WithDataSource(cfg, nodeId, commitmentAtxId, opts.DataDir))
+		r.NoError(err)
+		r.NoError(native.Verify(proof, metadata, cfg, logger, WithLabelScryptParams(opts.Scrypt)))
+
+		vectors.Proofs = append(vectors.Proofs, proofVector{
+			K1:            cfg.K1,
+			K2:            cfg.K2,
+			K3:            cfg.K3,
+			PowDifficulty: hex.EncodeToString(cfg.PowDifficulty[:]),
+			Scrypt:        opts.Scrypt,
+			Proof:         shared.VersionedProof(*proof),
+			Metadata:      shared.VersionedProofMetadata(*metadata),
+		})
+	}
+
+	data, err := json.MarshalIndent(vectors, "", "  ")
+	r.NoError(err)
+	r.NoError(os.MkdirAll(filepath.Dir(postrsVectorsFile), 0o755))
+	r.NoError(os.WriteFile(postrsVectorsFile, append(data, '\n'), 0o644))
+}
@@ -0,0 +1,22 @@
+//go:build goverifier
+
+package verifying
+
+import "errors"
+
+// goOption holds the options of the GoProofVerifier.
+type goOption struct {
+	// powVerifier checks the proof of work of proofs verified by a GoProofVerifier.
+	powVerifier PowVerifier
+}
+
+// WithPowVerifier sets the PowVerifier a GoProofVerifier checks the proof of work with.
+func WithPowVerifier(verifier PowVerifier) OptionFunc {
+	return func(o *option) error {
+		if verifier == nil {
+			return errors.New("pow verifier is nil")
+		}
+		o.powVerifier = verifier
+		return nil
+	}
+}
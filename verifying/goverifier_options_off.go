@@ -0,0 +1,6 @@
+//go:build !goverifier
+
+package verifying
+
+// goOption holds the options of the GoProofVerifier, which isn't built without the goverifier tag.
+type goOption struct{}
@@ -0,0 +1,267 @@
+//go:build goverifier
+
+package verifying
+
+import (
+	"context"
+	"crypto/aes"
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/shared"
+)
+
+type powVerifierFunc func(pow uint64, nonceGroup uint8, challenge [8]byte, difficulty [32]byte, minerId []byte) error
+
+func (f powVerifierFunc) VerifyPow(pow uint64, nonceGroup uint8, challenge [8]byte, difficulty [32]byte, minerId []byte) error {
+	return f(pow, nonceGroup, challenge, difficulty, minerId)
+}
+
+var acceptPow = powVerifierFunc(func(uint64, uint8, [8]byte, [32]byte, []byte) error { return nil })
+
+// generateGoProof generates a proof the way the prover does, with labels computed in Go. It shares the primitives of
+// the verifier, the known answers of post-rs are checked in goverifier_vectors_test.go.
+func generateGoProof(t *testing.T, cfg config.Config, m *shared.ProofMetadata, params config.ScryptParams) *shared.Proof {
+	numLabels := uint64(m.NumUnits) * m.LabelsPerUnit
+	commitment := shared.CommitmentBytes(m.NodeId, m.CommitmentAtxId)
+	labels := make([][]byte, numLabels)
+	for i := range labels {
+		labels[i] = make([]byte, labelLength)
+		require.NoError(t, computeLabel(commitment, uint64(i), params, labels[i]))
+	}
+
+	difficulty, err := provingDifficulty(cfg.K1, numLabels)
+	require.NoError(t, err)
+	out := make([]byte, aes.BlockSize)
+	for nonce := uint32(0); nonce < 256*noncesPerAES; nonce++ {
+		const pow = 7
+		msbCipher, err := newProofCipher(m.Challenge, nonce/noncesPerAES, pow)
+		require.NoError(t, err)
+		lsbCipher, err := newProofCipher(m.Challenge, nonce/noncesPerAES, pow, nonce)
+		require.NoError(t, err)
+
+		var indices []uint64
+		for i, label := range labels {
+			msbCipher.Encrypt(out, label)
+			msb := out[nonce%noncesPerAES]
+			if msb == byte(difficulty>>56) {
+				lsbCipher.Encrypt(out, label)
+				if binary.LittleEndian.Uint64(out)&0x00ff_ffff_ffff_ffff >= difficulty&0x00ff_ffff_ffff_ffff {
+					continue
+				}
+			} else if msb > byte(difficulty>>56) {
+				continue
+			}
+			if indices = append(indices, uint64(i)); len(indices) == int(cfg.K2) {
+				return &shared.Proof{
+					Nonce:   nonce,
+					Indices: compressIndices(indices, requiredBits(numLabels)),
+					Pow:     pow,
+				}
+			}
+		}
+	}
+	require.FailNow(t, "no proof found")
+	return nil
+}
+
+func goVerifierTestSetup(t *testing.T) (config.Config, *shared.ProofMetadata, config.ScryptParams) {
+	cfg := config.DefaultConfig()
+	cfg.K1 = 32
+	cfg.K2 = 8
+	cfg.K3 = 4
+
+	m := &shared.ProofMetadata{
+		NodeId:          make([]byte, 32),
+		CommitmentAtxId: make([]byte, 32),
+		Challenge:       make(shared.Challenge, 32),
+		NumUnits:        2,
+		LabelsPerUnit:   128,
+	}
+	m.NodeId[0] = 1
+	m.Challenge[0] = 2
+	return cfg, m, config.ScryptParams{N: 2, R: 1, P: 1}
+}
+
+func TestGoProofVerifier(t *testing.T) {
+	r := require.New(t)
+	logger := zaptest.NewLogger(t)
+	cfg, m, params := goVerifierTestSetup(t)
+	proof := generateGoProof(t, cfg, m, params)
+
+	var powNonceGroup uint8
+	var powChallenge [8]byte
+	var powMinerId []byte
+	pow := powVerifierFunc(func(pow uint64, nonceGroup uint8, challenge [8]byte, _ [32]byte, minerId []byte) error {
+		powNonceGroup, powChallenge, powMinerId = nonceGroup, challenge, minerId
+		return nil
+	})
+
+	verifier, err := NewGoProofVerifier(WithPowVerifier(pow))
+	r.NoError(err)
+	defer verifier.Close()
+	r.NoError(verifier.Verify(proof, m, cfg, logger, WithLabelScryptParams(params)))
+	r.Equal(uint8(proof.Nonce/noncesPerAES), powNonceGroup)
+	r.Equal([]byte(m.Challenge[:8]), powChallenge[:])
+	r.Equal(m.NodeId, powMinerId)
+
+	creator := make([]byte, 32)
+	r.NoError(verifier.Verify(proof, m, cfg, logger, WithLabelScryptParams(params), WithPowCreator(creator)))
+	r.Equal(creator, powMinerId)
+
+	// labels of other scrypt parameters don't satisfy the difficulty
+	err = verifier.Verify(proof, m, cfg, logger, WithLabelScryptParams(config.ScryptParams{N: 4, R: 1, P: 1}))
+	r.ErrorIs(err, ErrInvalidProof)
+	r.ErrorIs(err, ErrLabelAboveDifficulty)
+	var invalidIndex ErrInvalidIndex
+	r.ErrorAs(err, &invalidIndex)
+	r.Less(invalidIndex.Index, int(cfg.K2))
+	r.Equal(decompressIndices(proof.Indices, requiredBits(uint64(m.NumUnits)*m.LabelsPerUnit), int(cfg.K2))[invalidIndex.Index], invalidIndex.Label)
+
+	// another challenge selects other labels
+	other := *m
+	other.Challenge = make(shared.Challenge, 32)
+	r.ErrorContains(verifier.Verify(proof, &other, cfg, logger, WithLabelScryptParams(params)), "invalid proof")
+
+	// flipping the bits of the indices invalidates the proof
+	invalid := *proof
+	invalid.Indices = append([]byte(nil), proof.Indices...)
+	for i := range invalid.Indices {
+		invalid.Indices[i] ^= 255
+	}
+	err = verifier.Verify(&invalid, m, cfg, logger, WithLabelScryptParams(params))
+	r.ErrorIs(err, ErrInvalidProof)
+	r.ErrorAs(err, &invalidIndex)
+
+	// indices pointing past the labels are out of range
+	indices := make([]uint64, cfg.K2)
+	for i := range indices {
+		indices[i] = uint64(m.NumUnits) * m.LabelsPerUnit
+	}
+	invalid.Indices = compressIndices(indices, requiredBits(uint64(m.NumUnits)*m.LabelsPerUnit))
+	err = verifier.Verify(&invalid, m, cfg, logger, WithLabelScryptParams(params))
+	r.ErrorIs(err, ErrIndexOutOfRange)
+	r.ErrorAs(err, &invalidIndex)
+	r.Equal(indices[invalidIndex.Index], invalidIndex.Label)
+
+	invalid.Indices = proof.Indices[1:]
+	err = verifier.Verify(&invalid, m, cfg, logger, WithLabelScryptParams(params))
+	r.ErrorIs(err, ErrMalformedIndices)
+	r.ErrorIs(err, ErrInvalidProof)
+	r.ErrorContains(err, "invalid length")
+
+	invalid.Indices = nil
+	r.ErrorIs(verifier.Verify(&invalid, m, cfg, logger, WithLabelScryptParams(params)), ErrMalformedIndices)
+
+	// the proof of work is checked by the PowVerifier
+	reject := powVerifierFunc(func(uint64, uint8, [8]byte, [32]byte, []byte) error { return errors.New("pow too big") })
+	err = verifier.Verify(proof, m, cfg, logger, WithLabelScryptParams(params), WithPowVerifier(reject))
+	r.ErrorIs(err, ErrInvalidPow)
+	r.ErrorIs(err, ErrInvalidProof)
+	r.ErrorContains(err, "pow too big")
+
+	// invalid metadata isn't an invalid proof
+	other.NodeId = m.NodeId[:31]
+	err = verifier.Verify(proof, &other, cfg, logger, WithLabelScryptParams(params))
+	r.ErrorIs(err, ErrInvalidArgument)
+	r.NotErrorIs(err, ErrInvalidProof)
+
+	verifier, err = NewGoProofVerifier()
+	r.NoError(err)
+	r.ErrorIs(verifier.Verify(proof, m, cfg, logger, WithLabelScryptParams(params)), ErrNoPowVerifier)
+}
+
+func TestCompressIndices(t *testing.T) {
+	indices := []uint64{0, 1, 511, 256, 37}
+	data := compressIndices(indices, 9)
+	require.Len(t, data, 6)
+	require.Equal(t, indices, decompressIndices(data, 9, len(indices)))
+	require.EqualValues(t, 9, requiredBits(256))
+	require.EqualValues(t, 8, requiredBits(255))
+}
+
+func TestSelectIndices(t *testing.T) {
+	r := require.New(t)
+	p := &shared.Proof{Nonce: 1, Indices: []byte{1, 2, 3}, Pow: 4}
+
+	selected := selectIndices(8, 4, shared.ZeroChallenge, p)
+	r.Len(selected, 4)
+	r.Equal(selected, selectIndices(8, 4, shared.ZeroChallenge, p))
+
+	seen := make(map[int]bool)
+	for _, position := range selected {
+		r.GreaterOrEqual(position, 0)
+		r.Less(position, 8)
+		r.False(seen[position])
+		seen[position] = true
+	}
+
+	r.ElementsMatch([]int{0, 1, 2, 3, 4, 5, 6, 7}, selectIndices(8, 10, shared.ZeroChallenge, p))
+}
+
+func TestGoProofVerifier_VerifyBatch(t *testing.T) {
+	r := require.New(t)
+	logger := zaptest.NewLogger(t)
+	cfg, m, params := goVerifierTestSetup(t)
+	proof := generateGoProof(t, cfg, m, params)
+
+	invalid := *proof
+	invalid.Indices = append([]byte(nil), proof.Indices...)
+	for i := range invalid.Indices {
+		invalid.Indices[i] ^= 255
+	}
+
+	verifier, err := NewGoProofVerifier(WithPowVerifier(acceptPow))
+	r.NoError(err)
+	defer verifier.Close()
+
+	items := make([]BatchItem, 10)
+	for i := range items {
+		items[i] = BatchItem{Proof: proof, Metadata: m}
+		if i%3 == 0 {
+			items[i].Proof = &invalid
+		}
+	}
+	results := verifier.VerifyBatch(context.Background(), items, cfg, logger, 3, WithLabelScryptParams(params))
+	r.Len(results, len(items))
+	for i, err := range results {
+		if i%3 == 0 {
+			r.ErrorContains(err, "invalid proof", "item %d", i)
+		} else {
+			r.NoError(err, "item %d", i)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, err := range verifier.VerifyBatch(ctx, items, cfg, logger, 0, WithLabelScryptParams(params)) {
+		r.ErrorIs(err, context.Canceled)
+	}
+}
+
+func TestVerifyBatch_Concurrency(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	items := make([]BatchItem, 20)
+	results := verifyBatch(context.Background(), items, 4, func(*shared.Proof, *shared.ProofMetadata) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	require.Len(t, results, len(items))
+	require.LessOrEqual(t, maxRunning.Load(), int32(4))
+	require.Greater(t, maxRunning.Load(), int32(1))
+}
@@ -0,0 +1,106 @@
+//go:build goverifier
+
+package verifying
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/spacemeshos/post/config"
+	"github.com/spacemeshos/post/shared"
+)
+
+// postrsVectorsFile holds labels and proofs computed by the native library. It must be committed, it is written by
+// TestGoProofVerifier_GenerateVectors, which needs cgo and the real post-rs library:
+//
+//	go test -tags goverifier ./verifying -run TestGoProofVerifier_GenerateVectors -update-vectors
+//
+// The Go verifier is checked against it without cgo, so that it can't drift from post-rs unnoticed.
+var postrsVectorsFile = filepath.Join("testdata", "postrs_vectors.json")
+
+// postrsVectors are known answers of post-rs.
+type postrsVectors struct {
+	Labels []labelVector
+	Proofs []proofVector
+}
+
+// labelVector is a label computed by post-rs.
+type labelVector struct {
+	NodeId          string
+	CommitmentAtxId string
+	Scrypt          config.ScryptParams
+	Index           uint64
+	Label           string
+}
+
+// proofVector is a proof generated and verified by post-rs. Its proof of work isn't checked by the Go verifier.
+type proofVector struct {
+	K1            uint32
+	K2            uint32
+	K3            uint32
+	PowDifficulty string
+	Scrypt        config.ScryptParams
+	Proof         shared.VersionedProof
+	Metadata      shared.VersionedProofMetadata
+}
+
+func loadPostrsVectors(t *testing.T) *postrsVectors {
+	data, err := os.ReadFile(postrsVectorsFile)
+	require.NoError(t, err, "generate %s with the native library and -update-vectors", postrsVectorsFile)
+
+	var vectors postrsVectors
+	require.NoError(t, json.Unmarshal(data, &vectors))
+	require.NotEmpty(t, vectors.Labels)
+	require.NotEmpty(t, vectors.Proofs)
+	return &vectors
+}
+
+func TestGoLabels_KnownAnswers(t *testing.T) {
+	r := require.New(t)
+	vectors := loadPostrsVectors(t)
+
+	label := make([]byte, labelLength)
+	for _, v := range vectors.Labels {
+		nodeId, err := hex.DecodeString(v.NodeId)
+		r.NoError(err)
+		commitmentAtxId, err := hex.DecodeString(v.CommitmentAtxId)
+		r.NoError(err)
+
+		r.NoError(computeLabel(shared.CommitmentBytes(nodeId, commitmentAtxId), v.Index, v.Scrypt, label))
+		r.Equal(v.Label, hex.EncodeToString(label), "label %d, scrypt %+v", v.Index, v.Scrypt)
+	}
+}
+
+func TestGoProofVerifier_KnownAnswers(t *testing.T) {
+	r := require.New(t)
+	vectors := loadPostrsVectors(t)
+	logger := zaptest.NewLogger(t)
+
+	verifier, err := NewGoProofVerifier(WithPowVerifier(acceptPow))
+	r.NoError(err)
+	defer verifier.Close()
+
+	for i, v := range vectors.Proofs {
+		cfg := config.DefaultConfig()
+		cfg.K1, cfg.K2, cfg.K3 = v.K1, v.K2, v.K3
+		_, err := hex.Decode(cfg.PowDifficulty[:], []byte(v.PowDifficulty))
+		r.NoError(err)
+		proof, metadata := shared.Proof(v.Proof), shared.ProofMetadata(v.Metadata)
+
+		r.NoError(verifier.Verify(&proof, &metadata, cfg, logger, WithLabelScryptParams(v.Scrypt)), "proof %d", i)
+
+		invalid := proof
+		invalid.Indices = append([]byte(nil), proof.Indices...)
+		for j := range invalid.Indices {
+			invalid.Indices[j] ^= 255
+		}
+		err = verifier.Verify(&invalid, &metadata, cfg, logger, WithLabelScryptParams(v.Scrypt))
+		r.ErrorIs(err, ErrInvalidProof, "proof %d", i)
+	}
+}
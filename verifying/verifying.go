@@ -1,6 +1,9 @@
+//go:build cgo
+
 package verifying
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -80,16 +83,21 @@ func NewProofVerifier(opts ...OptionFunc) (*ProofVerifier, error) {
 
 // Verify ensures the validity of a proof in respect to its metadata.
 // It returns nil if the proof is valid or an error describing the failure, otherwise.
+// Invalid proofs fail with ErrInvalidProof. The native verifier doesn't report why a proof is invalid, it logs the
+// reason with the given logger.
 func (v *ProofVerifier) Verify(p *shared.Proof, m *shared.ProofMetadata, cfg config.Config, logger *zap.Logger, opts ...OptionFunc) error {
 	options, err := applyOpts(opts...)
 	if err != nil {
 		return err
 	}
 	if len(m.NodeId) != 32 {
-		return fmt.Errorf("invalid `nodeId` length; expected: 32, given: %v", len(m.NodeId))
+		return fmt.Errorf("%w: invalid `nodeId` length; expected: 32, given: %v", ErrInvalidArgument, len(m.NodeId))
 	}
 	if len(m.CommitmentAtxId) != 32 {
-		return fmt.Errorf("invalid `commitmentAtxId` length; expected: 32, given: %v", len(m.CommitmentAtxId))
+		return fmt.Errorf("%w: invalid `commitmentAtxId` length; expected: 32, given: %v", ErrInvalidArgument, len(m.CommitmentAtxId))
+	}
+	if len(p.Indices) == 0 {
+		return fmt.Errorf("%w: proof indices are empty", ErrMalformedIndices)
 	}
 
 	scryptParams := postrs.TranslateScryptParams(options.labelScrypt.N, options.labelScrypt.R, options.labelScrypt.P)
@@ -99,5 +107,21 @@ func (v *ProofVerifier) Verify(p *shared.Proof, m *shared.ProofMetadata, cfg con
 		verifyOpts = append(verifyOpts, postrs.WithPowCreator(options.powCreatorId))
 	}
 
-	return v.VerifyProof(p, m, logger, cfg.K1, cfg.K2, cfg.K3, cfg.PowDifficulty, scryptParams, verifyOpts...)
+	err = v.VerifyProof(p, m, logger, cfg.K1, cfg.K2, cfg.K3, cfg.PowDifficulty, scryptParams, verifyOpts...)
+	switch {
+	case errors.Is(err, postrs.ErrInvalidProof):
+		return ErrInvalidProof
+	case errors.Is(err, postrs.ErrInvalidArgument):
+		return ErrInvalidArgument
+	}
+	return err
+}
+
+// VerifyBatch verifies the proofs of the items with up to concurrency verifications running at the same time; a
+// concurrency of 0 or less uses one per CPU. The returned slice holds the result of Verify for every item at its
+// index. Items that aren't verified yet when ctx is canceled fail with the error of ctx.
+func (v *ProofVerifier) VerifyBatch(ctx context.Context, items []BatchItem, cfg config.Config, logger *zap.Logger, concurrency int, opts ...OptionFunc) []error {
+	return verifyBatch(ctx, items, concurrency, func(p *shared.Proof, m *shared.ProofMetadata) error {
+		return v.Verify(p, m, cfg, logger, opts...)
+	})
 }
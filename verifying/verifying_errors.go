@@ -0,0 +1,43 @@
+package verifying
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidProof is returned for proofs that are invalid. The errors below describe why a proof is invalid, they
+	// all match ErrInvalidProof with errors.Is. The native verifier only reports that a proof is invalid, it logs why.
+	ErrInvalidProof = errors.New("invalid proof")
+
+	// ErrInvalidPow is returned if the proof of work of a proof is invalid.
+	ErrInvalidPow = fmt.Errorf("%w: invalid pow", ErrInvalidProof)
+	// ErrMalformedIndices is returned if the indices of a proof can't be decoded into K2 indices.
+	ErrMalformedIndices = fmt.Errorf("%w: malformed indices", ErrInvalidProof)
+	// ErrLabelAboveDifficulty is returned with an ErrInvalidIndex if the label of an index doesn't satisfy the
+	// difficulty, i.e. the prover didn't find it.
+	ErrLabelAboveDifficulty = fmt.Errorf("%w: label above difficulty", ErrInvalidProof)
+	// ErrIndexOutOfRange is returned with an ErrInvalidIndex if an index is greater than the number of labels.
+	ErrIndexOutOfRange = fmt.Errorf("%w: index out of range", ErrInvalidProof)
+
+	// ErrInvalidArgument is returned if the proof can't be verified with the given metadata or config.
+	ErrInvalidArgument = errors.New("invalid argument")
+)
+
+// ErrInvalidIndex is returned if one of the indices of a proof is invalid. Err is the reason, it is
+// ErrLabelAboveDifficulty or ErrIndexOutOfRange.
+type ErrInvalidIndex struct {
+	// Index is the position of the index among the K2 indices of the proof.
+	Index int
+	// Label is the index of the label it points to.
+	Label uint64
+	Err   error
+}
+
+func (e ErrInvalidIndex) Error() string {
+	return fmt.Sprintf("%v: index %d (label %d)", e.Err, e.Index, e.Label)
+}
+
+func (e ErrInvalidIndex) Unwrap() error {
+	return e.Err
+}
@@ -7,7 +7,8 @@ import (
 )
 
 type option struct {
-	powFlags config.PowFlags
+	nativeOption
+	goOption
 	// scrypt parameters for labels initialization
 	labelScrypt config.ScryptParams
 
@@ -16,8 +17,8 @@ type option struct {
 
 func defaultOpts() *option {
 	return &option{
-		powFlags:    config.DefaultVerifyingPowFlags(),
-		labelScrypt: config.DefaultLabelParams(),
+		nativeOption: defaultNativeOption(),
+		labelScrypt:  config.DefaultLabelParams(),
 	}
 }
 
@@ -40,13 +41,6 @@ func WithLabelScryptParams(params config.ScryptParams) OptionFunc {
 	}
 }
 
-func WithPowFlags(flags config.PowFlags) OptionFunc {
-	return func(o *option) error {
-		o.powFlags = flags
-		return nil
-	}
-}
-
 func WithPowCreator(id []byte) OptionFunc {
 	return func(o *option) error {
 		if len(id) != 32 {
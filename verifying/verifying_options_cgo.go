@@ -0,0 +1,21 @@
+//go:build cgo
+
+package verifying
+
+import "github.com/spacemeshos/post/config"
+
+// nativeOption holds the options of the native verifier.
+type nativeOption struct {
+	powFlags config.PowFlags
+}
+
+func defaultNativeOption() nativeOption {
+	return nativeOption{powFlags: config.DefaultVerifyingPowFlags()}
+}
+
+func WithPowFlags(flags config.PowFlags) OptionFunc {
+	return func(o *option) error {
+		o.powFlags = flags
+		return nil
+	}
+}
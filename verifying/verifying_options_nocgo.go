@@ -0,0 +1,10 @@
+//go:build !cgo
+
+package verifying
+
+// nativeOption holds the options of the native verifier, which isn't available without cgo.
+type nativeOption struct{}
+
+func defaultNativeOption() nativeOption {
+	return nativeOption{}
+}
@@ -1,3 +1,5 @@
+//go:build cgo
+
 package verifying
 
 import (
@@ -31,7 +33,7 @@ func getTestConfig(tb testing.TB) (config.Config, config.InitOpts) {
 	opts := config.DefaultInitOpts()
 	opts.DataDir = tb.TempDir()
 	opts.NumUnits = cfg.MinNumUnits
-	opts.ProviderID = int(id)
+	opts.ProviderIDs = []uint{id}
 	opts.ComputeBatchSize = 1 << 14
 	return cfg, opts
 }
@@ -105,7 +107,74 @@ func Test_Verify_Detects_invalid_proof(t *testing.T) {
 	r.NoError(err)
 	defer verifier.Close()
 
-	r.ErrorContains(verifier.Verify(proof, proofMetadata, cfg, zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))), "invalid proof")
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+	r.ErrorIs(verifier.Verify(proof, proofMetadata, cfg, logger), ErrInvalidProof)
+
+	proof.Indices = nil
+	r.ErrorIs(verifier.Verify(proof, proofMetadata, cfg, logger), ErrMalformedIndices)
+
+	invalidMetadata := *proofMetadata
+	invalidMetadata.NodeId = nodeId[:31]
+	r.ErrorIs(verifier.Verify(proof, &invalidMetadata, cfg, logger), ErrInvalidArgument)
+}
+
+func Test_VerifyBatch(t *testing.T) {
+	r := require.New(t)
+
+	nodeId := make([]byte, 32)
+	commitmentAtxId := make([]byte, 32)
+	ch := make(shared.Challenge, 32)
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.DebugLevel))
+	cfg, opts := getTestConfig(t)
+	init, err := initialization.NewInitializer(
+		initialization.WithNodeId(nodeId),
+		initialization.WithCommitmentAtxId(commitmentAtxId),
+		initialization.WithConfig(cfg),
+		initialization.WithInitOpts(opts),
+		initialization.WithLogger(logger),
+	)
+	r.NoError(err)
+	r.NoError(init.Initialize(context.Background()))
+
+	proof, proofMetadata, err := proving.Generate(
+		context.Background(),
+		ch,
+		cfg,
+		logger,
+		proving.WithDataSource(cfg, nodeId, commitmentAtxId, opts.DataDir),
+	)
+	r.NoError(err)
+
+	invalid := *proof
+	invalid.Indices = append([]byte(nil), proof.Indices...)
+	for i := range invalid.Indices {
+		invalid.Indices[i] ^= 255 // flip bits in all indices
+	}
+
+	verifier, err := NewProofVerifier()
+	r.NoError(err)
+	defer verifier.Close()
+
+	items := make([]BatchItem, 8)
+	for i := range items {
+		items[i] = BatchItem{Proof: proof, Metadata: proofMetadata}
+		if i%2 == 1 {
+			items[i].Proof = &invalid
+		}
+	}
+	results := verifier.VerifyBatch(context.Background(), items, cfg, logger, 4)
+	r.Len(results, len(items))
+	for i, err := range results {
+		if i%2 == 1 {
+			r.ErrorContains(err, "invalid proof", "item %d", i)
+		} else {
+			r.NoError(err, "item %d", i)
+		}
+	}
+
+	r.NoError(verifier.Close())
+	r.ErrorContains(verifier.Verify(proof, proofMetadata, cfg, logger), "closed")
 }
 
 func TestVerifyPow(t *testing.T) {